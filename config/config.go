@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -39,6 +40,40 @@ const (
 	SMTP_FROM                   = "SMTP_FROM"
 	SMTP_PASSWORD               = "SMTP_PASSWORD"
 	SMTP_LOGIN                  = "SMTP_LOGIN"
+	PROXY_ROUTES_FILE           = "PROXY_ROUTES_FILE"
+	PROXY_TIMEOUT               = "PROXY_TIMEOUT"
+	OIDC_ISSUER                 = "OIDC_ISSUER"
+	OIDC_AUDIENCE               = "OIDC_AUDIENCE"
+	OIDC_SIGNING_ALG            = "OIDC_SIGNING_ALG"
+	OIDC_KEY_ROTATION_DAYS      = "OIDC_KEY_ROTATION_DAYS"
+	OIDC_ID_TOKEN_EXPIRES_IN    = "OIDC_ID_TOKEN_EXPIRES_IN"
+	OAUTH_TOKEN_FORMAT          = "OAUTH_TOKEN_FORMAT"
+	LOGIN_MAX_FAILURES          = "LOGIN_MAX_FAILURES"
+	LOGIN_IP_MAX_FAILURES       = "LOGIN_IP_MAX_FAILURES"
+	LOGIN_FAILURE_WINDOW        = "LOGIN_FAILURE_WINDOW"
+	LOGIN_LOCKOUT_DURATION      = "LOGIN_LOCKOUT_DURATION"
+	REGISTRATION_ENABLED        = "REGISTRATION_ENABLED"
+	REGISTRATION_DEFAULT_ROLE   = "REGISTRATION_DEFAULT_ROLE"
+	VERIFY_EMAIL_EXPIRES_IN     = "VERIFY_EMAIL_EXPIRES_IN"
+	VERIFY_EMAIL_RESEND_AFTER   = "VERIFY_EMAIL_RESEND_AFTER"
+	IMPERSONATION_EXPIRES_IN    = "IMPERSONATION_EXPIRES_IN"
+	PASSWORD_MIN_LENGTH         = "PASSWORD_MIN_LENGTH"
+	PASSWORD_MIN_CLASSES        = "PASSWORD_MIN_CLASSES"
+	PASSWORD_HISTORY            = "PASSWORD_HISTORY"
+	PASSWORD_BLOCKLIST_FILE     = "PASSWORD_BLOCKLIST_FILE"
+	DEVICE_SIGNIN_ALERTS        = "DEVICE_SIGNIN_ALERTS"
+	DEVICE_REQUIRE_MFA          = "DEVICE_REQUIRE_MFA"
+	AUTH_BACKENDS               = "AUTH_BACKENDS"
+	LDAP_URL                    = "LDAP_URL"
+	LDAP_START_TLS              = "LDAP_START_TLS"
+	LDAP_BIND_DN                = "LDAP_BIND_DN"
+	LDAP_BIND_PASSWORD          = "LDAP_BIND_PASSWORD"
+	LDAP_BASE_DN                = "LDAP_BASE_DN"
+	LDAP_USER_FILTER            = "LDAP_USER_FILTER"
+	LDAP_GROUP_ATTRIBUTE        = "LDAP_GROUP_ATTRIBUTE"
+	LDAP_GROUP_ROLES            = "LDAP_GROUP_ROLES"
+	LDAP_DEFAULT_ROLE           = "LDAP_DEFAULT_ROLE"
+	LDAP_TIMEOUT                = "LDAP_TIMEOUT"
 )
 
 // Config blueprint microservice
@@ -51,6 +86,15 @@ type Config struct {
 	HTTP          Http
 	Nats          Nats
 	Smtp          SMTP
+	Proxy         Proxy
+	OIDC          OIDC
+	Lockout       Lockout
+	Registration  Registration
+	Impersonation Impersonation
+	Passwords     PasswordPolicy
+	Devices       Devices
+	Auth          Authentication
+	LDAP          LDAP
 }
 
 type Setting struct {
@@ -118,6 +162,8 @@ type Http struct {
 	Port                    string
 	OAuthTokenExpiresIn     int
 	OAuthLongTokenExpiresIn int
+	// opaque (default) or jwt access tokens
+	OAuthTokenFormat string
 	APP_REPORTS             string
 }
 
@@ -129,6 +175,107 @@ type SMTP struct {
 	SMTP_LOGIN    string
 }
 
+// Reverse Proxy Config
+type Proxy struct {
+	// json file with the declarative upstream route table
+	RoutesFile string
+	// default upstream timeout in seconds
+	Timeout int
+}
+
+// OpenID Connect Provider Config
+type OIDC struct {
+	// issuer of the tokens, the base url by default
+	Issuer string
+	// audience of the id tokens issued without an OAuth client
+	Audience string
+	// RS256 or EdDSA
+	SigningAlg string
+	// how many days a signing key is used before it's rotated
+	KeyRotationDays int
+	// id token expiration in seconds
+	IdTokenExpiresIn int
+}
+
+// Failed Logins Lockout Config
+type Lockout struct {
+	// failed logins of a username before it's locked out, 0 disables the lockout
+	MaxFailures int
+	// failed logins from a client ip before it's locked out, 0 disables the lockout
+	IPMaxFailures int
+	// seconds a failed login is counted for
+	FailureWindow int
+	// seconds a lockout lasts
+	Duration int
+}
+
+// Public Registration Config
+type Registration struct {
+	// the public signup is off unless enabled
+	Enabled bool
+	// role of the registered users
+	DefaultRole string
+	// seconds an email verification link is valid
+	VerificationExpiresIn int
+	// seconds between two verification emails to the same address
+	ResendInterval int
+}
+
+// Admin Impersonation Config
+type Impersonation struct {
+	// seconds an impersonation session lasts, it can't be refreshed
+	ExpiresIn int
+}
+
+// Password Policy Config
+type PasswordPolicy struct {
+	// characters of a password
+	MinLength int
+	// character classes of a password among lowercase, uppercase, digits and symbols
+	MinClasses int
+	// previous passwords of a user that can't be reused, 0 allows any
+	History int
+	// file of common and breached passwords that are refused, one per line
+	BlocklistFile string
+}
+
+// Known Devices Config
+type Devices struct {
+	// email the users signing in from a device never seen before
+	SigninAlerts bool
+	// logins from devices the user didn't trust need MFA, users without MFA get a code by email
+	RequireMfa bool
+}
+
+// Authentication Backends Config
+type Authentication struct {
+	// backends checking the password logins in order, local and ldap
+	Backends []string
+}
+
+// LDAP / Active Directory Config
+type LDAP struct {
+	// ldap:// or ldaps:// url of the directory
+	URL string
+	// upgrade the ldap:// connection with StartTLS
+	StartTLS bool
+	// service account searching the users, the search is anonymous without it
+	BindDN       string
+	BindPassword string
+	// where the users are searched
+	BaseDN string
+	// filter finding a user, %s is the escaped username e.g. (sAMAccountName=%s) for Active Directory
+	UserFilter string
+	// attribute of the user entry listing its groups
+	GroupAttribute string
+	// <group dn>=<role> pairs separated by ;, the first group of the user in the list gives its role
+	GroupRoles string
+	// role of the users in none of the groups, they can't login when it's empty
+	DefaultRole string
+	// seconds to connect and to get each answer
+	Timeout int
+}
+
 
 // NewConfig get config from env
 func NewConfig() *Config {
@@ -143,7 +290,39 @@ func NewConfig() *Config {
 	gprc := GRPC{}
 	mysql := MySQL{}
 	nats := Nats{}
+	http.OAuthTokenFormat = "opaque"
 	smtp := SMTP{}
+	proxy := Proxy{}
+	proxy.RoutesFile = "config/proxy_routes.json"
+	proxy.Timeout = 30
+	oidc := OIDC{}
+	oidc.Audience = "greenlync-api-gateway"
+	oidc.SigningAlg = "RS256"
+	oidc.KeyRotationDays = 30
+	oidc.IdTokenExpiresIn = 3600
+	lockout := Lockout{}
+	lockout.MaxFailures = 5
+	lockout.IPMaxFailures = 50
+	lockout.FailureWindow = 900
+	lockout.Duration = 900
+	registration := Registration{}
+	registration.DefaultRole = "User"
+	registration.VerificationExpiresIn = 86400
+	registration.ResendInterval = 60
+	impersonation := Impersonation{}
+	impersonation.ExpiresIn = 900
+	passwords := PasswordPolicy{}
+	passwords.MinLength = 8
+	passwords.MinClasses = 2
+	passwords.History = 5
+	devices := Devices{}
+	devices.SigninAlerts = true
+	auth := Authentication{}
+	auth.Backends = []string{"local"}
+	ldap := LDAP{}
+	ldap.UserFilter = "(uid=%s)"
+	ldap.GroupAttribute = "memberOf"
+	ldap.Timeout = 10
 
 	c := &Config{
 		HTTP:          http,
@@ -153,6 +332,15 @@ func NewConfig() *Config {
 		MySQL:         mysql,
 		Nats:          nats,
 		Smtp:          smtp,
+		Proxy:         proxy,
+		OIDC:          oidc,
+		Lockout:       lockout,
+		Registration:  registration,
+		Impersonation: impersonation,
+		Passwords:     passwords,
+		Devices:       devices,
+		Auth:          auth,
+		LDAP:          ldap,
 	}
 
 	parseError := map[string]string{
@@ -217,6 +405,11 @@ func NewConfig() *Config {
 		parseError[OAUTH_LONG_TOKEN_EXPIRES_IN] = OAUTH_LONG_TOKEN_EXPIRES_IN
 	}
 
+	oauthTokenFormat := os.Getenv(OAUTH_TOKEN_FORMAT)
+	if oauthTokenFormat != "" {
+		c.HTTP.OAuthTokenFormat = oauthTokenFormat
+	}
+
 	reportData := os.Getenv(APP_REPORTS)
 	if httpPort != "" {
 		c.HTTP.APP_REPORTS = reportData
@@ -333,6 +526,154 @@ func NewConfig() *Config {
 		parseError[SMTP_LOGIN] = SMTP_LOGIN
 	}
 
+	// optional, the gateway runs without upstream routes if the file doesn't exist
+	proxyRoutesFile := os.Getenv(PROXY_ROUTES_FILE)
+	if proxyRoutesFile != "" {
+		c.Proxy.RoutesFile = proxyRoutesFile
+	}
+
+	proxyTimeout, err := strconv.ParseInt(os.Getenv(PROXY_TIMEOUT), 10, 64)
+	if err == nil {
+		c.Proxy.Timeout = int(proxyTimeout)
+	}
+
+	// optional, the OpenID Connect provider defaults work out of the box
+	c.OIDC.Issuer = c.HTTP.BaseUrl
+	oidcIssuer := os.Getenv(OIDC_ISSUER)
+	if oidcIssuer != "" {
+		c.OIDC.Issuer = oidcIssuer
+	}
+
+	oidcAudience := os.Getenv(OIDC_AUDIENCE)
+	if oidcAudience != "" {
+		c.OIDC.Audience = oidcAudience
+	}
+
+	oidcSigningAlg := os.Getenv(OIDC_SIGNING_ALG)
+	if oidcSigningAlg != "" {
+		c.OIDC.SigningAlg = oidcSigningAlg
+	}
+
+	oidcKeyRotationDays, err := strconv.ParseInt(os.Getenv(OIDC_KEY_ROTATION_DAYS), 10, 64)
+	if err == nil {
+		c.OIDC.KeyRotationDays = int(oidcKeyRotationDays)
+	}
+
+	oidcIdTokenExpiresIn, err := strconv.ParseInt(os.Getenv(OIDC_ID_TOKEN_EXPIRES_IN), 10, 64)
+	if err == nil {
+		c.OIDC.IdTokenExpiresIn = int(oidcIdTokenExpiresIn)
+	}
+
+	// optional, the lockout defaults are safe for most deployments
+	loginMaxFailures, err := strconv.ParseInt(os.Getenv(LOGIN_MAX_FAILURES), 10, 64)
+	if err == nil {
+		c.Lockout.MaxFailures = int(loginMaxFailures)
+	}
+
+	loginIPMaxFailures, err := strconv.ParseInt(os.Getenv(LOGIN_IP_MAX_FAILURES), 10, 64)
+	if err == nil {
+		c.Lockout.IPMaxFailures = int(loginIPMaxFailures)
+	}
+
+	loginFailureWindow, err := strconv.ParseInt(os.Getenv(LOGIN_FAILURE_WINDOW), 10, 64)
+	if err == nil {
+		c.Lockout.FailureWindow = int(loginFailureWindow)
+	}
+
+	loginLockoutDuration, err := strconv.ParseInt(os.Getenv(LOGIN_LOCKOUT_DURATION), 10, 64)
+	if err == nil {
+		c.Lockout.Duration = int(loginLockoutDuration)
+	}
+
+	// optional, the public registration is disabled by default
+	registrationEnabled, err := strconv.ParseBool(os.Getenv(REGISTRATION_ENABLED))
+	if err == nil {
+		c.Registration.Enabled = registrationEnabled
+	}
+
+	registrationDefaultRole := os.Getenv(REGISTRATION_DEFAULT_ROLE)
+	if registrationDefaultRole != "" {
+		c.Registration.DefaultRole = registrationDefaultRole
+	}
+
+	emailVerificationExpiresIn, err := strconv.ParseInt(os.Getenv(VERIFY_EMAIL_EXPIRES_IN), 10, 64)
+	if err == nil {
+		c.Registration.VerificationExpiresIn = int(emailVerificationExpiresIn)
+	}
+
+	emailVerificationResendInterval, err := strconv.ParseInt(os.Getenv(VERIFY_EMAIL_RESEND_AFTER), 10, 64)
+	if err == nil {
+		c.Registration.ResendInterval = int(emailVerificationResendInterval)
+	}
+
+	impersonationExpiresIn, err := strconv.ParseInt(os.Getenv(IMPERSONATION_EXPIRES_IN), 10, 64)
+	if err == nil {
+		c.Impersonation.ExpiresIn = int(impersonationExpiresIn)
+	}
+
+	passwordMinLength, err := strconv.ParseInt(os.Getenv(PASSWORD_MIN_LENGTH), 10, 64)
+	if err == nil {
+		c.Passwords.MinLength = int(passwordMinLength)
+	}
+
+	passwordMinClasses, err := strconv.ParseInt(os.Getenv(PASSWORD_MIN_CLASSES), 10, 64)
+	if err == nil {
+		c.Passwords.MinClasses = int(passwordMinClasses)
+	}
+
+	passwordHistory, err := strconv.ParseInt(os.Getenv(PASSWORD_HISTORY), 10, 64)
+	if err == nil {
+		c.Passwords.History = int(passwordHistory)
+	}
+
+	c.Passwords.BlocklistFile = os.Getenv(PASSWORD_BLOCKLIST_FILE)
+
+	deviceSigninAlerts, err := strconv.ParseBool(os.Getenv(DEVICE_SIGNIN_ALERTS))
+	if err == nil {
+		c.Devices.SigninAlerts = deviceSigninAlerts
+	}
+
+	deviceRequireMfa, err := strconv.ParseBool(os.Getenv(DEVICE_REQUIRE_MFA))
+	if err == nil {
+		c.Devices.RequireMfa = deviceRequireMfa
+	}
+
+	// optional, the users authenticate against the database unless another backend is listed
+	authBackends := os.Getenv(AUTH_BACKENDS)
+	if authBackends != "" {
+		c.Auth.Backends = strings.Split(authBackends, ",")
+		for i, backend := range c.Auth.Backends {
+			c.Auth.Backends[i] = strings.TrimSpace(backend)
+		}
+	}
+
+	c.LDAP.URL = os.Getenv(LDAP_URL)
+	c.LDAP.BindDN = os.Getenv(LDAP_BIND_DN)
+	c.LDAP.BindPassword = os.Getenv(LDAP_BIND_PASSWORD)
+	c.LDAP.BaseDN = os.Getenv(LDAP_BASE_DN)
+	c.LDAP.GroupRoles = os.Getenv(LDAP_GROUP_ROLES)
+	c.LDAP.DefaultRole = os.Getenv(LDAP_DEFAULT_ROLE)
+
+	ldapStartTLS, err := strconv.ParseBool(os.Getenv(LDAP_START_TLS))
+	if err == nil {
+		c.LDAP.StartTLS = ldapStartTLS
+	}
+
+	ldapUserFilter := os.Getenv(LDAP_USER_FILTER)
+	if ldapUserFilter != "" {
+		c.LDAP.UserFilter = ldapUserFilter
+	}
+
+	ldapGroupAttribute := os.Getenv(LDAP_GROUP_ATTRIBUTE)
+	if ldapGroupAttribute != "" {
+		c.LDAP.GroupAttribute = ldapGroupAttribute
+	}
+
+	ldapTimeout, err := strconv.ParseInt(os.Getenv(LDAP_TIMEOUT), 10, 64)
+	if err == nil {
+		c.LDAP.Timeout = int(ldapTimeout)
+	}
+
 	exitParse := false
 	for k, v := range parseError {
 		if v == "" {
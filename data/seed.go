@@ -12,8 +12,7 @@ import (
 	model "greenlync-api-gateway/model/common/v1"
 	"greenlync-api-gateway/pkg/db"
 	"greenlync-api-gateway/pkg/logger"
-
-	"golang.org/x/crypto/bcrypt"
+	"greenlync-api-gateway/pkg/oauth2"
 )
 
 var (
@@ -85,7 +84,7 @@ func main() {
 
 func seedAdminUser(dbSess *db.MysqlDB, username, password string) error {
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := oauth2.EncryptPassword(password)
 	if err != nil {
 		return fmt.Errorf("failed to hash password: %w", err)
 	}
@@ -96,7 +95,8 @@ func seedAdminUser(dbSess *db.MysqlDB, username, password string) error {
 		Email:        username + "@greenlync.com",
 		FirstName:    "Admin",
 		LastName:     "User",
-		PasswordHash: string(hashedPassword),
+		PasswordHash: hashedPassword,
+		AuthSource:   model.AuthSource_Local,
 		Role:         "admin",
 		IsActive:     true,
 	}
@@ -180,6 +180,21 @@ func seedRolesAndPermissions(dbSess *db.MysqlDB) error {
 		{"config.read", "Read configuration", "config", "read"},
 		{"config.write", "Update configuration", "config", "write"},
 		{"logs.read", "Read system logs", "logs", "read"},
+		{"routes.read", "Read proxy routes", "routes", "read"},
+		{"routes.manage", "Manage proxy routes", "routes", "manage"},
+		{"usage.read", "Read usage of all consumers", "usage", "read"},
+		{"clients.read", "Read OAuth clients", "clients", "read"},
+		{"clients.manage", "Manage OAuth clients", "clients", "manage"},
+		{"keys.read", "Read token signing keys", "keys", "read"},
+		{"keys.manage", "Rotate token signing keys", "keys", "manage"},
+		{"users.impersonate", "Impersonate users", "users", "impersonate"},
+		{"myusage.read", "Read own usage and quotas", "myusage", "read"},
+		{"myapikeys.read", "Read own API keys", "myapikeys", "read"},
+		{"myapikeys.manage", "Create and revoke own API keys", "myapikeys", "manage"},
+		{"mymfa.read", "Read own MFA status", "mymfa", "read"},
+		{"mymfa.manage", "Enroll, confirm and disable own MFA", "mymfa", "manage"},
+		{"mydevices.read", "Read own known devices", "mydevices", "read"},
+		{"mydevices.manage", "Trust and forget own known devices", "mydevices", "manage"},
 	}
 
 	for _, permData := range permissions {
@@ -279,6 +294,11 @@ func seedDefaultConfig(dbSess *db.MysqlDB) error {
 		{"auth.session_timeout", "3600", "Session timeout in seconds", model.ValueType_Integer, false},
 		{"auth.max_login_attempts", "5", "Maximum login attempts before lockout", model.ValueType_Integer, false},
 		{"system.maintenance_mode", "false", "System maintenance mode", model.ValueType_Boolean, false},
+		{"ratelimit.enabled", "true", "Enforce the rate limits", model.ValueType_Boolean, false},
+		{"ratelimit.ip", "300/1m", "Rate limit per client IP (rate/period[/burst])", model.ValueType_String, false},
+		{"ratelimit.user", "600/1m", "Default rate limit per user (rate/period[/burst])", model.ValueType_String, false},
+		{"ratelimit.role.Admin", "1200/1m", "Rate limit per Admin user (rate/period[/burst])", model.ValueType_String, false},
+		{"quota.user", "10000/day,200000/month", "Default call quota per user (calls/day or calls/month, comma separated)", model.ValueType_String, false},
 	}
 
 	for _, configData := range configs {
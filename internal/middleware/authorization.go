@@ -2,7 +2,9 @@ package middleware
 
 import (
 	"strings"
+	"greenlync-api-gateway/pkg/authz"
 	"greenlync-api-gateway/pkg/errors"
+	"greenlync-api-gateway/pkg/oauth2"
 	"greenlync-api-gateway/utils"
 
 	"github.com/gofiber/fiber/v2"
@@ -16,10 +18,18 @@ func (m *Middleware) Authorization(resource string) fiber.Handler {
 		if !ok {
 			return m.App.HttpResponseInternalServerErrorRequest(c, errors.ErrCouldNotParseClientCfg)
 		}
-		ok = m.Authz.Enforcer.HasNamedPolicy("p", client.Scope, r[0], r[1])
+		// the destructive resources are refused to impersonation sessions whatever the role allows
+		if client.ImpersonatorId != 0 && oauth2.IsDestructive(resource) {
+			return m.App.HttpResponseForbidden(c, errors.ErrImpersonationRestricted)
+		}
+		ok = client.Allows(resource) && m.Authz.Enforcer.HasNamedPolicy("p", client.Scope, r[0], r[1])
 		if !ok {
 			return m.App.HttpResponseForbidden(c, errors.ErrUnauthorizedToAccessResource)
 		}
-		return c.Next()
+		// the client can always check how much of its quotas is left
+		if resource == authz.Resources_MyUsage_Read {
+			return c.Next()
+		}
+		return m.Quota(c)
 	}
 }
@@ -37,3 +37,12 @@ func (m *Middleware) BasicAuthParser(c *fiber.Ctx) error {
 	}
 	return m.App.HttpResponseUnauthorized(c, errors.ErrInvalidBasicAuth)
 }
+
+// same as BasicAuthParser but lets requests without an Authorization header through,
+// e.g. public OAuth clients identify themselves with a client_id instead
+func (m *Middleware) OptionalBasicAuthParser(c *fiber.Ctx) error {
+	if c.Get("Authorization") == "" {
+		return c.Next()
+	}
+	return m.BasicAuthParser(c)
+}
@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"strings"
 	"greenlync-api-gateway/pkg/errors"
+	"greenlync-api-gateway/pkg/oauth2"
+	"greenlync-api-gateway/utils"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/gofiber/fiber/v2"
@@ -41,6 +43,16 @@ func (m *Middleware) HeaderReader(c *fiber.Ctx) error {
 		} else {
 			return m.App.HttpResponseInternalServerErrorRequest(c, errors.ErrCouldNotParseClientCfg)
 		}
+	} else if apiKey := c.Get(oauth2.ApiKeyHeader); apiKey != "" {
+		// machine clients authenticate with an API key instead of a session
+		cfg, err := m.OAuth2.InspectApiKey(context.Background(), apiKey, utils.GetRealIP(c))
+		if err != nil {
+			if err == errors.ErrInvalidApiKey {
+				return m.App.HttpResponseUnauthorized(c, err)
+			}
+			return m.App.HttpResponseInternalServerErrorRequest(c, err)
+		}
+		c.Locals("client", cfg)
 	}
 
 	return c.Next()
@@ -3,11 +3,16 @@
 package middleware
 
 import (
+	"sync/atomic"
+
 	"greenlync-api-gateway/pkg/authz"
+	"greenlync-api-gateway/pkg/cache"
 	"greenlync-api-gateway/pkg/http"
 	"greenlync-api-gateway/pkg/logger"
 	"greenlync-api-gateway/pkg/nats"
 	"greenlync-api-gateway/pkg/oauth2"
+	"greenlync-api-gateway/pkg/ratelimit"
+	"greenlync-api-gateway/pkg/usage"
 
 	"gorm.io/gorm"
 )
@@ -25,17 +30,30 @@ type Middleware struct {
 	Nats *nats.Nats
 	// zab logger for log to files and stdout
 	Log *logger.Logger
+	// Cache
+	Cache *cache.Cache
+	// Distributed rate limiter
+	Limiter *ratelimit.Limiter
+	// rate limits loaded from the config store
+	rateLimits atomic.Pointer[ratelimit.Limits]
+	// Quota tracking and usage metering
+	Meter *usage.Meter
+	// quotas loaded from the config store
+	quotas atomic.Pointer[usage.Quotas]
 }
 
-func NewMiddleware(app *http.App, db *gorm.DB, authz *authz.Authz, oauth2 *oauth2.OAuth2, log *logger.Logger, nats *nats.Nats) *Middleware {
+func NewMiddleware(app *http.App, db *gorm.DB, authz *authz.Authz, oauth2 *oauth2.OAuth2, log *logger.Logger, nats *nats.Nats, cache *cache.Cache, meter *usage.Meter) *Middleware {
 
 	m := &Middleware{
-		App:    app,
-		DB:     db,
-		Authz:  authz,
-		OAuth2: oauth2,
-		Log:    log,
-		Nats:   nats,
+		App:     app,
+		DB:      db,
+		Authz:   authz,
+		OAuth2:  oauth2,
+		Log:     log,
+		Nats:    nats,
+		Cache:   cache,
+		Limiter: ratelimit.NewLimiter(cache.GetRedisClient()),
+		Meter:   meter,
 	}
 
 	return m
@@ -3,12 +3,21 @@ package middleware
 import (
 	"strings"
 	"greenlync-api-gateway/pkg/errors"
+	"greenlync-api-gateway/pkg/oauth2"
 	"greenlync-api-gateway/utils"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 func (m *Middleware) Protect(c *fiber.Ctx) error {
+	// the API key was already verified by the HeaderReader
+	if c.Get(oauth2.ApiKeyHeader) != "" && c.Get("Authorization") == "" && c.Query("access_token") == "" {
+		if _, ok := utils.GetClient(c); !ok {
+			return m.App.HttpResponseUnauthorized(c, errors.ErrInvalidApiKey)
+		}
+		return c.Next()
+	}
+
 	// in case the access token is not in the header, check if it's in the query
 	if accessToken := c.Query("access_token"); accessToken != "" {
 		if _, ok := utils.GetToken(c); !ok {
@@ -0,0 +1,137 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Distributed rate limiting per client ip, user, role and route
+
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/errors"
+	"greenlync-api-gateway/pkg/ratelimit"
+	"greenlync-api-gateway/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Rate limit response headers (IETF RateLimit header fields draft)
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+	HeaderRateLimitPolicy    = "RateLimit-Policy"
+)
+
+type rateLimitCheck struct {
+	key   string
+	limit *ratelimit.Limit
+}
+
+// ReloadRateLimits loads the ratelimit.* configs into the limits used by the middlewares
+func (m *Middleware) ReloadRateLimits() error {
+	configs := []*model.Config{}
+	err := m.DB.Where("`key` LIKE ?", ratelimit.ConfigPrefix+"%").Find(&configs).Error
+	if err != nil {
+		return err
+	}
+
+	limits, err := ratelimit.NewLimits(configs)
+	m.rateLimits.Store(limits)
+
+	return err
+}
+
+// RateLimit limits the requests per client ip and per authenticated user,
+// the user limit depends on the user role unless the user has its own limit
+func (m *Middleware) RateLimit(c *fiber.Ctx) error {
+	limits := m.rateLimits.Load()
+	if limits == nil || !limits.Enabled {
+		return c.Next()
+	}
+
+	checks := make([]rateLimitCheck, 0, 2)
+	if limits.IP != nil {
+		checks = append(checks, rateLimitCheck{ratelimit.LimitKey("ip", utils.GetRealIP(c)), limits.IP})
+	}
+	if client, ok := utils.GetClient(c); ok {
+		if limit := limits.ForUser(client.ClientId, client.Scope); limit != nil {
+			checks = append(checks, rateLimitCheck{ratelimit.LimitKey("user", fmt.Sprint(client.ClientId)), limit})
+		}
+	}
+
+	return m.enforceRateLimits(c, checks)
+}
+
+// RateLimitRoute limits the requests per user on the route, anonymous requests are limited per ip
+func (m *Middleware) RateLimitRoute(route string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		limits := m.rateLimits.Load()
+		if limits == nil || !limits.Enabled {
+			return c.Next()
+		}
+
+		limit := limits.ForRoute(route)
+		if limit == nil {
+			return c.Next()
+		}
+
+		id := "ip:" + utils.GetRealIP(c)
+		if client, ok := utils.GetClient(c); ok {
+			id = fmt.Sprint("user:", client.ClientId)
+		}
+
+		return m.enforceRateLimits(c, []rateLimitCheck{{ratelimit.LimitKey("route_"+route, id), limit}})
+	}
+}
+
+// enforceRateLimits consumes one request of every limit and reports the most restrictive one,
+// the gateway fails open when redis is unavailable
+func (m *Middleware) enforceRateLimits(c *fiber.Ctx, checks []rateLimitCheck) error {
+	var current *ratelimit.Result
+	for _, check := range checks {
+		res, err := m.Limiter.Allow(context.Background(), check.key, check.limit)
+		if err != nil {
+			m.Log.Logger.Errorf("rate limit %s: %v", check.key, err)
+			continue
+		}
+
+		if current == nil || mostRestrictive(res, current) {
+			current = res
+		}
+	}
+
+	if current == nil {
+		return c.Next()
+	}
+
+	c.Set(HeaderRateLimitLimit, strconv.Itoa(current.Limit.Burst))
+	c.Set(HeaderRateLimitRemaining, strconv.Itoa(current.Remaining))
+	c.Set(HeaderRateLimitReset, strconv.Itoa(ceilSeconds(current.ResetAfter)))
+	c.Set(HeaderRateLimitPolicy, fmt.Sprintf("%d;w=%d;burst=%d", current.Limit.Rate, ceilSeconds(current.Limit.Period), current.Limit.Burst))
+
+	if !current.Allowed {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(ceilSeconds(current.RetryAfter)))
+		return m.App.HttpResponseTooManyRequests(c, errors.ErrTooManyRequests)
+	}
+
+	return c.Next()
+}
+
+// a rejected result wins over an allowed one, then the longest wait, then the fewest remaining requests
+func mostRestrictive(a, b *ratelimit.Result) bool {
+	if a.Allowed != b.Allowed {
+		return !a.Allowed
+	}
+	if !a.Allowed {
+		return a.RetryAfter > b.RetryAfter
+	}
+	return a.Remaining < b.Remaining
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
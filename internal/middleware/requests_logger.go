@@ -22,8 +22,10 @@ func (m *Middleware) RequestsLogger(c *fiber.Ctx) error {
 	if ok {
 		sessionId = cfg.SessionId
 		clientId = cfg.ClientId
-		// new activity
-		m.OAuth2.NewActivity(sessionId)
+		// new activity, API keys have no session to keep active
+		if cfg.ApiKeyId == 0 {
+			m.OAuth2.NewActivity(sessionId)
+		}
 	}
 
 	// Next() proceeds to the next middleware or route handler
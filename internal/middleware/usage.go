@@ -0,0 +1,118 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Usage quotas and metering per consumer
+
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/errors"
+	"greenlync-api-gateway/pkg/http"
+	"greenlync-api-gateway/pkg/proxy"
+	"greenlync-api-gateway/pkg/usage"
+	"greenlync-api-gateway/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Quota response headers, reporting the quota closest to exhaustion
+const (
+	HeaderQuotaLimit     = "X-Quota-Limit"
+	HeaderQuotaRemaining = "X-Quota-Remaining"
+	HeaderQuotaReset     = "X-Quota-Reset"
+)
+
+// ReloadQuotas loads the quota.* configs into the quotas used by the middleware
+func (m *Middleware) ReloadQuotas() error {
+	configs := []*model.Config{}
+	err := m.DB.Where("`key` LIKE ?", usage.ConfigPrefix+"%").Find(&configs).Error
+	if err != nil {
+		return err
+	}
+
+	quotas, err := usage.NewQuotas(configs)
+	m.quotas.Store(quotas)
+
+	return err
+}
+
+// Quotas returns the quotas loaded from the config store
+func (m *Middleware) Quotas() *usage.Quotas {
+	return m.quotas.Load()
+}
+
+// Quota enforces the user quotas, it runs once the route is matched and the client authorized so
+// rejected calls don't consume them. Calls made with an API key or a client token are counted against
+// the quotas of its user, the gateway fails open when redis is unavailable
+func (m *Middleware) Quota(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c)
+	if !ok {
+		return c.Next()
+	}
+
+	quotas := m.Quotas()
+	if quotas == nil {
+		return c.Next()
+	}
+
+	consumer := usage.UserConsumer(client.ClientId)
+	now := time.Now()
+	status, allowed, err := m.Meter.Consume(context.Background(), consumer, quotas.ForUser(client.ClientId, client.Scope), now)
+	if err != nil {
+		m.Log.Logger.Errorf("quota %s: %v", consumer, err)
+		return c.Next()
+	}
+	if len(status) == 0 {
+		return c.Next()
+	}
+
+	closest := status[0]
+	for _, s := range status {
+		if s.Remaining < closest.Remaining {
+			closest = s
+		}
+	}
+	c.Set(HeaderQuotaLimit, fmt.Sprintf("%d/%s", closest.Calls, closest.Period))
+	c.Set(HeaderQuotaRemaining, strconv.FormatInt(closest.Remaining, 10))
+	c.Set(HeaderQuotaReset, strconv.FormatInt(closest.ResetAt.Unix(), 10))
+
+	if !allowed {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(ceilSeconds(closest.ResetAt.Sub(now))))
+		return m.App.HttpResponseTooManyRequests(c, errors.ErrQuotaExceeded)
+	}
+
+	return c.Next()
+}
+
+// Usage meters the call per consumer and route, calls made with an API key or a client token are
+// metered per key or client. Anonymous requests aren't metered
+func (m *Middleware) Usage(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c)
+	if !ok {
+		return c.Next()
+	}
+
+	now := time.Now()
+	err := c.Next()
+
+	// upstream calls are metered by route name, gateway endpoints by their path pattern
+	route := c.Route().Path
+	if r, ok := c.Locals(http.LocalsRoute).(*proxy.Route); ok {
+		route = r.Name
+	}
+	consumer := usage.UserConsumer(client.ClientId)
+	if client.ApiKeyId != 0 {
+		consumer = usage.ApiKeyConsumer(client.ApiKeyId)
+	} else if client.ClientSecretId != "" {
+		consumer = usage.ClientConsumer(client.ClientSecretId)
+	}
+	if rerr := m.Meter.Record(context.Background(), consumer, client.ClientId, route, now); rerr != nil {
+		m.Log.Logger.Errorf("usage %s: %v", consumer, rerr)
+	}
+
+	return err
+}
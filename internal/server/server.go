@@ -2,6 +2,7 @@ package server
 
 import (
 	// "encoding/json"
+	"time"
 
 	"github.com/go-co-op/gocron"
 	"github.com/go-playground/validator/v10"
@@ -22,7 +23,9 @@ import (
 	"greenlync-api-gateway/pkg/manager"
 	"greenlync-api-gateway/pkg/nats"
 	"greenlync-api-gateway/pkg/oauth2"
+	"greenlync-api-gateway/pkg/proxy"
 	"greenlync-api-gateway/pkg/smtp"
+	"greenlync-api-gateway/pkg/usage"
 	// Removed influxdb, news, and support imports
 	// fiber local middleware
 	//"greenlync-api-gateway/pkg/fiber/middleware/jaeger"
@@ -67,6 +70,8 @@ type Server struct {
 	Smtp *smtp.SMTP
 	// Go-Cron
 	Cron *gocron.Scheduler
+	// Reverse proxy to upstream services
+	Proxy *proxy.Proxy
 }
 
 func NewServer(local *i18n.Lang, log *logger.Logger, cache *cache.Cache, db *gorm.DB, authz *authz.Authz, nats *nats.Nats, validate *validator.Validate, cfg *config.Config, smtp *smtp.SMTP, cron *gocron.Scheduler) *Server {
@@ -78,17 +83,78 @@ func NewServer(local *i18n.Lang, log *logger.Logger, cache *cache.Cache, db *gor
 	manager.SetMaxWebsocketConnections()
 
 	// OAuth2
-	oauth2 := oauth2.NewOAuth2(cache, db, cfg, log)
+	oauth2Server := oauth2.NewOAuth2(cache, db, cfg, log)
+
+	// a configured blocklist that can't be read would silently allow the common passwords
+	if cfg.Passwords.BlocklistFile != "" {
+		err := oauth2Server.Passwords.LoadBlocklist(cfg.Passwords.BlocklistFile)
+		if err != nil {
+			log.Logger.Fatalf("failed to load the password blocklist: %v", err)
+		}
+	}
+
+	err := oauth2Server.UseAuthenticators(cfg.Auth.Backends, cfg.LDAP)
+	if err != nil {
+		log.Logger.Fatalf("failed to set up the authentication backends: %v", err)
+	}
+
+	// keys signing the id tokens, rotated while the previous key stays published for the longest token lifetime
+	overlap := time.Duration(max(cfg.OIDC.IdTokenExpiresIn, cfg.HTTP.OAuthTokenExpiresIn, cfg.HTTP.OAuthLongTokenExpiresIn)) * time.Second
+	keys, err := oauth2.NewKeySet(db, log, cfg.OIDC.SigningAlg, time.Duration(cfg.OIDC.KeyRotationDays)*24*time.Hour, overlap, cron)
+	if err != nil {
+		log.Logger.Errorf("failed to load the token signing keys, id tokens are disabled: %v", err)
+	} else {
+		oauth2Server.Keys = keys
+	}
+
+	// JWT access tokens are verified locally against the revocation list, tokens already issued
+	// stay verifiable even when the gateway is switched back to opaque tokens
+	if keys != nil {
+		revocations, err := oauth2.NewRevocationList(cache.GetRedisClient(), log)
+		if err != nil {
+			log.Logger.Errorf("failed to load the token revocation list: %v", err)
+		} else {
+			oauth2Server.Revocations = revocations
+			go revocations.Watch()
+		}
+	}
+	if cfg.HTTP.OAuthTokenFormat != oauth2.TokenFormatOpaque && (cfg.HTTP.OAuthTokenFormat != oauth2.TokenFormatJWT || oauth2Server.Revocations == nil) {
+		log.Logger.Errorf("%s access tokens can't be issued, falling back to opaque tokens", cfg.HTTP.OAuthTokenFormat)
+		oauth2Server.TokenFormat = oauth2.TokenFormatOpaque
+	}
 
 	// Removed InfluxDB, News, and Support for minimal boilerplate
 
+	// Reverse proxy with the declarative upstream route table
+	proxy := proxy.NewProxy(cfg, log)
+	if err := proxy.LoadFile(cfg.Proxy.RoutesFile); err != nil {
+		log.Logger.Errorf("failed to load proxy routes: %v", err)
+	}
+
+	// Quotas and usage metering
+	meter, err := usage.NewMeter(cache.GetRedisClient(), db, log, cron)
+	if err != nil {
+		log.Logger.Fatalf("failed to start usage metering: %v", err)
+	}
+
 	// middleware
-	middleware := middleware.NewMiddleware(app, db, authz, oauth2, log, nats)
+	middleware := middleware.NewMiddleware(app, db, authz, oauth2Server, log, nats, cache, meter)
 	// v1 HTTP
-	newHttp := v1.NewHTTP(app, db, log, cache, nats, authz, oauth2, newHub, middleware, smtp, cfg, validate, cron)
+	newHttp := v1.NewHTTP(app, db, log, cache, nats, authz, oauth2Server, newHub, middleware, smtp, cfg, validate, cron, proxy)
+
+	// a missing default role would fail every sign up and the admin role would be given to anyone
+	if cfg.Registration.Enabled {
+		err = newHttp.ValidateRegistration()
+		if err != nil {
+			log.Logger.Fatalf("invalid registration settings: %v", err)
+		}
+	}
 
 	// start Monitoring Sessions Activity
-	go oauth2.MonitoryActivity()
+	go oauth2Server.MonitoryActivity()
+
+	// start Monitoring Upstreams Health
+	go proxy.MonitorUpstreams()
 
 	server := &Server{
 		App:           app,
@@ -101,9 +167,10 @@ func NewServer(local *i18n.Lang, log *logger.Logger, cache *cache.Cache, db *gor
 		Nats:          nats,
 		Hub:           newHub,
 		Authz:         authz,
-		OAuth2:        oauth2,
+		OAuth2:        oauth2Server,
 		Smtp:          smtp,
 		Cron:          cron,
+		Proxy:         proxy,
 	}
 
 	return server
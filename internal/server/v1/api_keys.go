@@ -0,0 +1,196 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Personal API keys of the current user, restricted to a subset of the user's resources
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/errors"
+	"greenlync-api-gateway/pkg/oauth2"
+	"greenlync-api-gateway/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type CrtApiKey struct {
+	Name      string     `json:"name" validate:"required,max=100" example:"ci"`
+	Resources []string   `json:"resources" validate:"required,min=1,dive,required" example:"usage_read"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// ApiKeyCreated is returned once when the key is created, the key itself can't be read again
+type ApiKeyCreated struct {
+	*model.ApiKey
+	Key string `json:"key"`
+}
+
+// @Id				GetMyApiKeys
+// @Description	Get the API keys of the current user
+// @Tags			ApiKeys
+// @Accept			json
+// @Produce		json
+// @Success		200	{array}		model.ApiKey
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Router			/api/v1/me/api-keys [get]
+func (s *HttpServer) GetMyApiKeys(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c)
+	if !ok {
+		return s.App.HttpResponseInternalServerErrorRequest(c, errors.ErrCouldNotParseClientCfg)
+	}
+
+	apiKeys := []*model.ApiKey{}
+	err := s.DB.Where("user_id = ?", client.ClientId).Order("id DESC").Find(&apiKeys).Error
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	return s.App.HttpResponseOK(c, apiKeys)
+}
+
+// @Id				CreateMyApiKey
+// @Description	Create an API key for the current user, the key is only returned in this response.
+// @Description	The key can only use the given resources, which must be granted to the user's role
+// @Tags			ApiKeys
+// @Accept			json
+// @Produce		json
+// @Success		201	{object}	v1.ApiKeyCreated
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			body	body	v1.CrtApiKey	true	"API Key Request Body"
+// @Router			/api/v1/me/api-keys [post]
+func (s *HttpServer) CreateMyApiKey(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c)
+	if !ok {
+		return s.App.HttpResponseInternalServerErrorRequest(c, errors.ErrCouldNotParseClientCfg)
+	}
+
+	data := &CrtApiKey{}
+	err := c.BodyParser(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	err = s.Validate.Struct(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, utils.ValidatorMessage(err))
+	}
+
+	if data.ExpiresAt != nil && !data.ExpiresAt.After(time.Now()) {
+		return s.App.HttpResponseBadRequest(c, fmt.Errorf("expires_at should be in the future"))
+	}
+
+	// a key can't be given more than its creator is allowed to use
+	for _, resource := range data.Resources {
+		if !client.Allows(resource) {
+			return s.App.HttpResponseBadRequest(c, fmt.Errorf("resource %s isn't granted to your role", resource))
+		}
+	}
+	err = s.validateResources(client.Scope, data.Resources)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	key, hash, err := oauth2.GenerateApiKey()
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	apiKey := &model.ApiKey{
+		UserId:    client.ClientId,
+		Name:      data.Name,
+		Prefix:    key[:len(oauth2.ApiKeyPrefix)+8],
+		Hash:      hash,
+		Resources: data.Resources,
+		ExpiresAt: data.ExpiresAt,
+	}
+
+	err = s.DB.Create(apiKey).Error
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	s.queueApiKeyOperationLog(c, "create_api_key", apiKey)
+
+	return s.App.HttpResponseCreated(c, &ApiKeyCreated{ApiKey: apiKey, Key: key})
+}
+
+// @Id				RevokeMyApiKey
+// @Description	Revoke an API key of the current user
+// @Tags			ApiKeys
+// @Accept			json
+// @Produce		json
+// @Success		200	{object}	model.ApiKey
+// @Failure		404	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			api_key_id	path	int	true	"API Key ID"
+// @Router			/api/v1/me/api-keys/{api_key_id} [delete]
+func (s *HttpServer) RevokeMyApiKey(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c)
+	if !ok {
+		return s.App.HttpResponseInternalServerErrorRequest(c, errors.ErrCouldNotParseClientCfg)
+	}
+
+	apiKeyId, err := c.ParamsInt("api_key_id")
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, errors.ErrInvalidID)
+	}
+
+	apiKey := &model.ApiKey{}
+	err = s.DB.Where("id = ? AND user_id = ?", apiKeyId, client.ClientId).First(apiKey).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return s.App.HttpResponseNotFound(c, err)
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	if apiKey.RevokedAt == nil {
+		err = s.OAuth2.RevokeApiKey(context.Background(), apiKey)
+		if err != nil {
+			return s.App.HttpResponseInternalServerErrorRequest(c, err)
+		}
+
+		s.queueApiKeyOperationLog(c, "revoke_api_key", apiKey)
+	}
+
+	return s.App.HttpResponseOK(c, apiKey)
+}
+
+// validateResources checks the role is granted every resource
+func (s *HttpServer) validateResources(role string, resources []string) error {
+	for _, resource := range resources {
+		r := strings.Split(resource, "_")
+		if len(r) != 2 || !s.Authz.Enforcer.HasNamedPolicy("p", role, r[0], r[1]) {
+			return fmt.Errorf("resource %s isn't granted to the role %s", resource, role)
+		}
+	}
+	return nil
+}
+
+func (s *HttpServer) queueApiKeyOperationLog(c *fiber.Ctx, action string, apiKey *model.ApiKey) {
+	cfg, ok := utils.GetClient(c)
+	if !ok {
+		return
+	}
+
+	s.queueSystemOperationLog(&model.OperationsLog{
+		Action:     action,
+		Resource:   "api_key",
+		ResourceId: fmt.Sprint(apiKey.Id),
+		UserId:     cfg.ClientId,
+		Method:     c.Method(),
+		URL:        c.OriginalURL(),
+		IpAddress:  utils.GetRealIP(c),
+		UserAgent:  c.Get("User-Agent"),
+		SessionId:  cfg.SessionId,
+	})
+}
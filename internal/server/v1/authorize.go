@@ -0,0 +1,348 @@
+// Developer: zeelrupapara@gmail.com
+// Description: OAuth2 authorization code flow with PKCE for first- and third-party apps
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/errors"
+	"greenlync-api-gateway/pkg/oauth2"
+	"greenlync-api-gateway/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type AuthorizeRequest struct {
+	ResponseType        string `json:"response_type" query:"response_type" validate:"required,eq=code" example:"code"`
+	ClientId            string `json:"client_id" query:"client_id" validate:"required"`
+	RedirectUri         string `json:"redirect_uri" query:"redirect_uri" validate:"required,url"`
+	Scope               string `json:"scope" query:"scope" example:"usage_read"`
+	State               string `json:"state" query:"state"`
+	CodeChallenge       string `json:"code_challenge" query:"code_challenge" validate:"required,min=43,max=128"`
+	CodeChallengeMethod string `json:"code_challenge_method" query:"code_challenge_method" validate:"required,eq=S256" example:"S256"`
+	Nonce               string `json:"nonce" query:"nonce" validate:"max=255"`
+	// only used when the user answers the consent
+	Approve bool `json:"approve" query:"-"`
+}
+
+type ConsentClient struct {
+	ClientId     string `json:"client_id"`
+	Name         string `json:"name"`
+	IsFirstParty bool   `json:"is_first_party"`
+}
+
+// Consent is what the consent screen shows the user before they approve the client
+type Consent struct {
+	Client          *ConsentClient `json:"client"`
+	Scopes          []string       `json:"scopes"`
+	RedirectUri     string         `json:"redirect_uri"`
+	State           string         `json:"state"`
+	ConsentRequired bool           `json:"consent_required"`
+}
+
+type AuthorizeResponse struct {
+	// redirect uri with the code (or the error) and state query params
+	RedirectUri string `json:"redirect_uri"`
+}
+
+// @Id				GetAuthorize
+// @Description	Validate an authorization request and get the data for the consent screen of the signed in user
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Param			response_type			query		string	true	"code"
+// @Param			client_id				query		string	true	"client id"
+// @Param			redirect_uri			query		string	true	"registered redirect uri"
+// @Param			scope					query		string	false	"space separated scopes, all the client scopes by default"
+// @Param			state					query		string	false	"opaque value returned to the client"
+// @Param			code_challenge			query		string	true	"PKCE code challenge"
+// @Param			code_challenge_method	query		string	true	"S256"
+// @Param			nonce					query		string	false	"OpenID Connect nonce echoed in the id token"
+// @Success		200						{object}	v1.Consent
+// @Failure		400						{object}	http.HttpResponse
+// @Failure		403						{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Router			/auth/v1/oauth2/authorize [get]
+func (s *HttpServer) GetAuthorize(c *fiber.Ctx) error {
+	cfg, err := s.consentingUser(c)
+	if err != nil {
+		return s.httpResponseConsentError(c, err)
+	}
+
+	req := &AuthorizeRequest{}
+	err = c.QueryParser(req)
+	if err != nil {
+		return s.App.HttpResponseBadQueryParams(c, err)
+	}
+
+	client, resources, err := s.validateAuthorizeRequest(req)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+	if resources == nil {
+		resources = cfg.Resources
+	}
+
+	return s.App.HttpResponseOK(c, &Consent{
+		Client: &ConsentClient{
+			ClientId:     client.ClientId,
+			Name:         client.Name,
+			IsFirstParty: client.IsFirstParty,
+		},
+		Scopes:          resources,
+		RedirectUri:     req.RedirectUri,
+		State:           req.State,
+		ConsentRequired: !client.IsFirstParty,
+	})
+}
+
+// @Id				Authorize
+// @Description	Answer the consent of the signed in user, returns the redirect uri with a single-use code
+// @Description	when approved or with error=access_denied otherwise
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Param			body	body		v1.AuthorizeRequest	true	"Authorization Request Body"
+// @Success		200		{object}	v1.AuthorizeResponse
+// @Failure		400		{object}	http.HttpResponse
+// @Failure		403		{object}	http.HttpResponse
+// @Failure		500		{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Router			/auth/v1/oauth2/authorize [post]
+func (s *HttpServer) Authorize(c *fiber.Ctx) error {
+	cfg, err := s.consentingUser(c)
+	if err != nil {
+		return s.httpResponseConsentError(c, err)
+	}
+
+	req := &AuthorizeRequest{}
+	err = c.BodyParser(req)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	client, resources, err := s.validateAuthorizeRequest(req)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+	// a first-party client gets the resources of the session, a restricted session stays restricted
+	if resources == nil {
+		resources = cfg.Resources
+	}
+
+	// the redirect uri is registered, from here on errors are reported to the client
+	redirect, _ := url.Parse(req.RedirectUri)
+	query := redirect.Query()
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+
+	if !req.Approve && !client.IsFirstParty {
+		query.Set("error", "access_denied")
+		redirect.RawQuery = query.Encode()
+		return s.App.HttpResponseOK(c, &AuthorizeResponse{RedirectUri: redirect.String()})
+	}
+
+	// a restricted client can't get more than the signed in session is allowed
+	for _, resource := range resources {
+		if !cfg.Allows(resource) {
+			return s.App.HttpResponseBadRequest(c, fmt.Errorf("resource %s isn't granted to your session", resource))
+		}
+	}
+	err = s.validateResources(cfg.Scope, resources)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	code, err := s.OAuth2.NewAuthorizationCode(context.Background(), &oauth2.AuthorizationCode{
+		ClientId:      client.ClientId,
+		UserId:        cfg.ClientId,
+		RedirectUri:   req.RedirectUri,
+		Resources:     resources,
+		CodeChallenge: req.CodeChallenge,
+		Nonce:         req.Nonce,
+	})
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	query.Set("code", code)
+	redirect.RawQuery = query.Encode()
+
+	s.queueOAuthClientOperationLog(c, "authorize_client", client)
+
+	return s.App.HttpResponseOK(c, &AuthorizeResponse{RedirectUri: redirect.String()})
+}
+
+// consentingUser returns the session of the user answering the consent, API keys and client
+// tokens act for a program and can't approve clients on behalf of the user. Impersonation
+// sessions can't either, the code would be exchanged for a regular session of the user
+func (s *HttpServer) consentingUser(c *fiber.Ctx) (*oauth2.Config, error) {
+	cfg, ok := utils.GetClient(c)
+	if !ok {
+		return nil, errors.ErrCouldNotParseClientCfg
+	}
+
+	if cfg.ApiKeyId != 0 || cfg.ClientSecretId != "" {
+		return nil, errors.ErrConsentRequiresUser
+	}
+	if cfg.ImpersonatorId != 0 {
+		return nil, errors.ErrImpersonationRestricted
+	}
+
+	return cfg, nil
+}
+
+func (s *HttpServer) httpResponseConsentError(c *fiber.Ctx, err error) error {
+	switch err {
+	case errors.ErrConsentRequiresUser, errors.ErrImpersonationRestricted:
+		return s.App.HttpResponseForbidden(c, err)
+	default:
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+}
+
+// validateAuthorizeRequest checks the client may use the code flow with the redirect uri
+// and returns the granted resources, nil for first-party clients which aren't restricted
+func (s *HttpServer) validateAuthorizeRequest(req *AuthorizeRequest) (*model.OAuthClient, []string, error) {
+	err := s.Validate.Struct(req)
+	if err != nil {
+		return nil, nil, utils.ValidatorMessage(err)
+	}
+
+	client := &model.OAuthClient{}
+	err = s.DB.Where("client_id = ? AND is_active = ?", req.ClientId, true).First(client).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil, errors.ErrInvalidClient
+		}
+		return nil, nil, err
+	}
+
+	if !client.HasGrant(model.GrantType_AuthorizationCode) {
+		return nil, nil, errors.ErrUnauthorizedGrant
+	}
+
+	if !client.HasRedirectUri(req.RedirectUri) {
+		return nil, nil, errors.ErrInvalidRedirectUri
+	}
+
+	if client.IsFirstParty && req.Scope == "" {
+		return client, nil, nil
+	}
+
+	resources, err := oauth2.ParseScope(req.Scope, client.Scopes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return client, resources, nil
+}
+
+// authorizationCodeToken exchanges an authorization code for a session of the user who
+// approved it, confidential clients authenticate with basic auth and public ones send their client_id
+func (s *HttpServer) authorizationCodeToken(c *fiber.Ctx, clientId, secret string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	client := &model.OAuthClient{}
+	var err error
+	if clientId != "" {
+		client, err = s.OAuth2.AuthenticateClient(ctx, clientId, secret)
+	} else {
+		err = s.DB.Where("client_id = ? AND is_active = ? AND is_public = ?", c.FormValue("client_id"), true, true).First(client).Error
+		if err == gorm.ErrRecordNotFound {
+			err = errors.ErrInvalidClient
+		}
+	}
+	if err != nil {
+		if err == errors.ErrInvalidClient {
+			return s.App.HttpResponseUnauthorized(c, err)
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	if !client.HasGrant(model.GrantType_AuthorizationCode) {
+		return s.App.HttpResponseBadRequest(c, errors.ErrUnauthorizedGrant)
+	}
+
+	authCode, err := s.OAuth2.ExchangeAuthorizationCode(ctx, c.FormValue("code"))
+	if err != nil {
+		if err == errors.ErrInvalidGrant {
+			return s.App.HttpResponseBadRequest(c, err)
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	if authCode.ClientId != client.ClientId || authCode.RedirectUri != c.FormValue("redirect_uri") ||
+		!oauth2.VerifyCodeVerifier(c.FormValue("code_verifier"), authCode.CodeChallenge) {
+		return s.App.HttpResponseBadRequest(c, errors.ErrInvalidGrant)
+	}
+
+	user := &model.User{}
+	err = s.DB.Where("id = ? AND is_active = ?", authCode.UserId, true).First(user).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return s.App.HttpResponseUnauthorized(c, fmt.Errorf("the account has been deactivated"))
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	// the sessions policy of the role applies to the sessions of the clients too
+	err = s.admitSession(ctx, c, user)
+	if err != nil {
+		return s.httpResponseAdmitError(c, err)
+	}
+
+	cfg := &oauth2.Config{
+		ClientId:       user.Id,
+		ClientSecretId: client.ClientId,
+		Email:          user.Email,
+		Scope:          user.Role,
+		Resources:      authCode.Resources,
+		IpAddress:      utils.GetRealIP(c),
+		ExpiresIn:      s.OAuth2.TokenExpiresIn,
+		UserAgent:      utils.GetUserAgent(c),
+		Nonce:          authCode.Nonce,
+	}
+
+	_, err = s.OAuth2.PasswordCredentialsToken(ctx, cfg)
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, fiber.ErrInternalServerError)
+	}
+
+	s.queueSystemOperationLog(&model.OperationsLog{
+		Action:     "login",
+		Resource:   "session",
+		ResourceId: client.ClientId,
+		UserId:     cfg.ClientId,
+		Method:     "POST",
+		URL:        c.OriginalURL(),
+		IpAddress:  cfg.IpAddress,
+		UserAgent:  c.Get("User-Agent"),
+		SessionId:  cfg.SessionId,
+	})
+
+	scope := cfg.Scope
+	if cfg.Resources != nil {
+		scope = strings.Join(cfg.Resources, " ")
+	}
+
+	return s.App.HttpResponseOK(c, &LoginResponse{
+		UserId:       cfg.ClientId,
+		AccessToken:  cfg.AccessToken,
+		RefreshToken: cfg.RefreshToken,
+		SessionId:    cfg.SessionId,
+		ExpiresIn:    int32(cfg.ExpiresIn),
+		Scope:        scope,
+		IpAddress:    cfg.IpAddress,
+		IdToken:      cfg.IdToken,
+	})
+}
@@ -3,11 +3,19 @@
 package v1
 
 import (
+	"fmt"
 	"strconv"
+	"strings"
 	model "greenlync-api-gateway/model/common/v1"
 	"greenlync-api-gateway/pkg/errors"
+	"greenlync-api-gateway/pkg/nats"
+	"greenlync-api-gateway/pkg/oauth2"
+	"greenlync-api-gateway/pkg/ratelimit"
+	"greenlync-api-gateway/pkg/usage"
+	"greenlync-api-gateway/utils"
 
 	"github.com/gofiber/fiber/v2"
+	natsio "github.com/nats-io/nats.go"
 	"gorm.io/gorm"
 )
 
@@ -16,6 +24,64 @@ type ConfigUpdatePayload struct {
 	Value string `json:"value" validate:"required"`
 }
 
+// ConfigCreatePayload represents the payload for creating a config
+type ConfigCreatePayload struct {
+	Key           string          `json:"key" validate:"required" example:"ratelimit.role.User"`
+	Value         string          `json:"value" validate:"required" example:"600/1m"`
+	ValueType     model.ValueType `json:"value_type"`
+	Description   string          `json:"description"`
+	ConfigGroupId int32           `json:"config_group_id" validate:"required"`
+	IsPublic      bool            `json:"is_public"`
+}
+
+//	@Id				CreateConfig
+//	@Description	Create Config e.g. a per user or per route rate limit
+//	@Tags			Config
+//	@Accept			json
+//	@Produce		json
+//	@Success		201	{object}	model.Config
+//	@Failure		400	{object}	http.HttpResponse
+//	@Failure		500	{object}	http.HttpResponse
+//	@Security		BearerAuth
+//	@Param			body	body	v1.ConfigCreatePayload	true	"Config Request Body"
+//	@Router			/api/v1/configs [post]
+func (s *HttpServer) CreateConfig(c *fiber.Ctx) error {
+	payload := &ConfigCreatePayload{}
+	err := c.BodyParser(payload)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	err = s.Validate.Struct(payload)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, utils.ValidatorMessage(err))
+	}
+
+	config := &model.Config{
+		Key:           payload.Key,
+		Value:         payload.Value,
+		ValueType:     payload.ValueType,
+		Description:   payload.Description,
+		ConfigGroupId: payload.ConfigGroupId,
+		IsPublic:      payload.IsPublic,
+		RecordType:    model.RecordType_User,
+	}
+
+	err = validateConfig(config)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	err = s.DB.Create(config).Error
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	s.broadcastConfigs()
+
+	return s.App.HttpResponseCreated(c, config)
+}
+
 // Simplified UpdateConfig for boilerplate - removes complex trading logic
 func (s *HttpServer) UpdateConfig(c *fiber.Ctx) error {
 	configId, err := strconv.Atoi(c.Params("config_id"))
@@ -46,11 +112,18 @@ func (s *HttpServer) UpdateConfig(c *fiber.Ctx) error {
 	// Simple update - no complex validation for boilerplate
 	config.Value = payload.Value
 
+	err = validateConfig(config)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
 	err = s.DB.Save(config).Error
 	if err != nil {
 		return s.App.HttpResponseInternalServerErrorRequest(c, err)
 	}
 
+	s.broadcastConfigs()
+
 	// Create a simple config update event for event-driven architecture
 	event := &model.Event{
 		Type:    model.EventType_SystemAlert, // Using available event type
@@ -148,4 +221,73 @@ func (s *HttpServer) GetConfigsBelongToGroup(c *fiber.Ctx) error {
 	}
 
 	return s.App.HttpResponseOK(c, configs)
-}
\ No newline at end of file
+}
+// validateConfig rejects values the gateway couldn't use for the configs it reads at runtime
+func validateConfig(config *model.Config) error {
+	if strings.HasPrefix(config.Key, ratelimit.ConfigPrefix) {
+		_, err := ratelimit.NewLimits([]*model.Config{config})
+		return err
+	}
+
+	if strings.HasPrefix(config.Key, usage.ConfigPrefix) {
+		_, err := usage.NewQuotas([]*model.Config{config})
+		return err
+	}
+
+	if strings.HasPrefix(config.Key, oauth2.MfaConfigPrefix) {
+		_, err := oauth2.NewMfaRoles([]*model.Config{config})
+		return err
+	}
+
+	if strings.HasPrefix(config.Key, oauth2.SessionsConfigPrefix) {
+		_, err := oauth2.NewSessionPolicies([]*model.Config{config})
+		return err
+	}
+
+	return nil
+}
+
+// reload the settings the gateway caches from the config store
+func (s *HttpServer) reloadConfigs() {
+	err := s.Middleware.ReloadRateLimits()
+	if err != nil {
+		s.Log.Logger.Errorf("error loading rate limits: %v", err)
+	}
+
+	err = s.Middleware.ReloadQuotas()
+	if err != nil {
+		s.Log.Logger.Errorf("error loading quotas: %v", err)
+	}
+
+	err = s.OAuth2.ReloadMfaRoles()
+	if err != nil {
+		s.Log.Logger.Errorf("error loading mfa roles: %v", err)
+	}
+
+	err = s.OAuth2.ReloadSessionPolicies()
+	if err != nil {
+		s.Log.Logger.Errorf("error loading session policies: %v", err)
+	}
+}
+
+// reload locally then tell the other gateway replicas to reload the configs
+func (s *HttpServer) broadcastConfigs() {
+	s.reloadConfigs()
+
+	err := s.Nats.NC.Publish(nats.SubjectConfigsReload, nil)
+	if err != nil {
+		s.Log.Logger.Errorf("error publishing to %s: %v", nats.SubjectConfigsReload, err)
+	}
+}
+
+// every replica reloads its cached configs whenever a config changes on any of them
+func (s *HttpServer) subscribeConfigs() error {
+	_, err := s.Nats.NC.Subscribe(nats.SubjectConfigsReload, func(msg *natsio.Msg) {
+		s.reloadConfigs()
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't subscribe to %s: %w", nats.SubjectConfigsReload, err)
+	}
+
+	return nil
+}
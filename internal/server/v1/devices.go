@@ -0,0 +1,251 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Known devices of the users, new sign-in alerts and the devices the users trust
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/errors"
+	"greenlync-api-gateway/pkg/oauth2"
+	"greenlync-api-gateway/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type UptMyDevice struct {
+	// trusted devices don't need MFA when DEVICE_REQUIRE_MFA is set
+	Trusted bool `json:"trusted"`
+}
+
+// loginDevice returns the device the request signs in from
+func (s *HttpServer) loginDevice(c *fiber.Ctx, userId int32) *model.KnownDevice {
+	ua := utils.UserAgentParser(utils.GetUserAgent(c))
+	return oauth2.NewKnownDevice(userId, ua.Name, ua.OS, ua.Channel, utils.GetRealIP(c))
+}
+
+// deviceTrusted reports whether the user trusted the device the request signs in from
+func (s *HttpServer) deviceTrusted(ctx context.Context, c *fiber.Ctx, userId int32) (bool, error) {
+	device, err := s.OAuth2.GetKnownDevice(ctx, userId, s.loginDevice(c, userId).Fingerprint)
+	if err != nil {
+		return false, err
+	}
+
+	return device != nil && device.Trusted, nil
+}
+
+// recordDevice records the device of a successful login and reports whether it's new to the user.
+// The user is alerted unless it's their first device, failures are only logged since the session
+// is issued already
+func (s *HttpServer) recordDevice(c *fiber.Ctx, user *model.User, sessionId string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	device := s.loginDevice(c, user.Id)
+	isNew, err := s.OAuth2.SeenDevice(ctx, device)
+	if err != nil {
+		s.Log.Logger.Errorf("error recording the device of user %d: %v", user.Id, err)
+		return false
+	}
+	if !isNew {
+		return false
+	}
+
+	var count int64
+	err = s.DB.WithContext(ctx).Model(&model.KnownDevice{}).Where("user_id = ?", user.Id).Count(&count).Error
+	if err != nil {
+		s.Log.Logger.Errorf("error counting the devices of user %d: %v", user.Id, err)
+		return true
+	}
+	if count <= 1 {
+		return true
+	}
+
+	s.queueSystemOperationLog(&model.OperationsLog{
+		Action:     "new_device_login",
+		Resource:   "device",
+		ResourceId: fmt.Sprint(device.Id),
+		UserId:     user.Id,
+		Method:     c.Method(),
+		URL:        c.OriginalURL(),
+		IpAddress:  device.IpAddress,
+		UserAgent:  c.Get("User-Agent"),
+		SessionId:  sessionId,
+	})
+
+	s.emitSecurityEvent(model.EventType_NewDeviceLogin, user.Id, sessionId, device.IpAddress, map[string]interface{}{
+		"device_id": device.Id,
+		"browser":   device.Browser,
+		"os":        device.OS,
+		"channel":   device.Channel,
+		"subnet":    device.Subnet,
+	})
+
+	if s.Cfg.Devices.SigninAlerts {
+		accountName := strings.TrimSpace(user.FirstName + " " + user.LastName)
+		if accountName == "" {
+			accountName = user.Username
+		}
+
+		err = s.Smtp.SendNewSignInEmail(user, user.Email, accountName, device.Browser, device.OS, device.IpAddress, device.LastSeenAt)
+		if err != nil {
+			s.Log.Logger.Errorf("error alerting user %d of the new device: %v", user.Id, err)
+		}
+	}
+
+	return true
+}
+
+// @Id				GetMyDevices
+// @Description	Get the devices the current user signed in from, the most recent first
+// @Tags			Me
+// @Accept			json
+// @Produce		json
+// @Success		200	{array}		model.KnownDevice
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Router			/api/v1/me/devices [get]
+func (s *HttpServer) GetMyDevices(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c)
+	if !ok {
+		return s.App.HttpResponseInternalServerErrorRequest(c, errors.ErrCouldNotParseClientCfg)
+	}
+
+	devices := []*model.KnownDevice{}
+	err := s.DB.Where("user_id = ?", client.ClientId).Order("last_seen_at DESC").Find(&devices).Error
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	return s.App.HttpResponseOK(c, devices)
+}
+
+// @Id				UpdateMyDevice
+// @Description	Trust or distrust a device of the current user
+// @Tags			Me
+// @Accept			json
+// @Produce		json
+// @Success		200	{object}	model.KnownDevice
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		404	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			device_id	path	int				true	"Device ID"
+// @Param			body		body	v1.UptMyDevice	true	"Device Request Body"
+// @Router			/api/v1/me/devices/{device_id} [put]
+func (s *HttpServer) UpdateMyDevice(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c)
+	if !ok {
+		return s.App.HttpResponseInternalServerErrorRequest(c, errors.ErrCouldNotParseClientCfg)
+	}
+
+	data := &UptMyDevice{}
+	err := c.BodyParser(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	device, err := s.getMyDevice(c, client.ClientId)
+	if err != nil {
+		return s.httpResponseDeviceError(c, err)
+	}
+
+	device.Trusted = data.Trusted
+	err = s.DB.Model(device).Update("trusted", device.Trusted).Error
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	action := "distrust_device"
+	if device.Trusted {
+		action = "trust_device"
+	}
+	s.queueDeviceOperationLog(c, action, device)
+
+	return s.App.HttpResponseOK(c, device)
+}
+
+// @Id				DeleteMyDevice
+// @Description	Forget a device of the current user, the next sign in from it is alerted as a new device
+// @Tags			Me
+// @Accept			json
+// @Produce		json
+// @Success		204
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		404	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			device_id	path	int	true	"Device ID"
+// @Router			/api/v1/me/devices/{device_id} [delete]
+func (s *HttpServer) DeleteMyDevice(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c)
+	if !ok {
+		return s.App.HttpResponseInternalServerErrorRequest(c, errors.ErrCouldNotParseClientCfg)
+	}
+
+	device, err := s.getMyDevice(c, client.ClientId)
+	if err != nil {
+		return s.httpResponseDeviceError(c, err)
+	}
+
+	err = s.DB.Delete(device).Error
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	s.queueDeviceOperationLog(c, "delete_device", device)
+
+	return s.App.HttpResponseNoContent(c)
+}
+
+// getMyDevice returns the device of the device_id param, the devices of the other users are
+// reported as missing
+func (s *HttpServer) getMyDevice(c *fiber.Ctx, userId int32) (*model.KnownDevice, error) {
+	deviceId, err := c.ParamsInt("device_id")
+	if err != nil {
+		return nil, errors.ErrInvalidID
+	}
+
+	device := &model.KnownDevice{}
+	err = s.DB.Where("id = ? AND user_id = ?", deviceId, userId).First(device).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return device, nil
+}
+
+func (s *HttpServer) httpResponseDeviceError(c *fiber.Ctx, err error) error {
+	switch err {
+	case errors.ErrInvalidID:
+		return s.App.HttpResponseBadRequest(c, err)
+	case gorm.ErrRecordNotFound:
+		return s.App.HttpResponseNotFound(c, err)
+	default:
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+}
+
+func (s *HttpServer) queueDeviceOperationLog(c *fiber.Ctx, action string, device *model.KnownDevice) {
+	cfg, ok := utils.GetClient(c)
+	if !ok {
+		return
+	}
+
+	s.queueSystemOperationLog(&model.OperationsLog{
+		Action:     action,
+		Resource:   "device",
+		ResourceId: fmt.Sprint(device.Id),
+		UserId:     cfg.ClientId,
+		Method:     c.Method(),
+		URL:        c.OriginalURL(),
+		IpAddress:  utils.GetRealIP(c),
+		UserAgent:  c.Get("User-Agent"),
+		SessionId:  cfg.SessionId,
+	})
+}
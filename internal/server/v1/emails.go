@@ -395,6 +395,7 @@ func (s *HttpServer) CreateInEmail(c *fiber.Ctx) error {
 		URL:       c.OriginalURL(),
 		IpAddress: cfg.IpAddress,
 		UserAgent: c.Get("User-Agent"),
+		SessionId: cfg.SessionId,
 	})
 
 	return s.App.HttpResponseOK(c, emails[0])
@@ -540,6 +541,7 @@ func (s *HttpServer) UpdateInEmail(c *fiber.Ctx) error {
 		URL:       c.OriginalURL(),
 		IpAddress: cfg.IpAddress,
 		UserAgent: c.Get("User-Agent"),
+		SessionId: cfg.SessionId,
 	})
 
 	return s.App.HttpResponseOK(c, emails[0])
@@ -626,6 +628,7 @@ func (s *HttpServer) DeleteInEmail(c *fiber.Ctx) error {
 		URL:       c.OriginalURL(),
 		IpAddress: cfg.IpAddress,
 		UserAgent: c.Get("User-Agent"),
+		SessionId: cfg.SessionId,
 	})
 
 	return s.App.HttpResponseNoContent(c)
@@ -662,6 +665,7 @@ func (s *HttpServer) TestSMTPEmail(c *fiber.Ctx) error {
 		URL:       c.OriginalURL(),
 		IpAddress: cfg.IpAddress,
 		UserAgent: c.Get("User-Agent"),
+		SessionId: cfg.SessionId,
 	})
 
 	return s.App.HttpResponseNoContent(c)
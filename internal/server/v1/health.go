@@ -5,6 +5,7 @@ package v1
 
 import (
 	"context"
+	"fmt"
 	"greenlync-api-gateway/pkg/monitor"
 	"time"
 
@@ -86,6 +87,33 @@ func (s *HttpServer) CheckReadiness(c *fiber.Ctx) error {
 		}
 	}
 
+	// Check proxy upstreams, they're reported but don't fail readiness, taking the gateway out of
+	// rotation wouldn't bring an upstream back
+	if s.Proxy != nil {
+		for _, route := range s.Proxy.Table().Routes() {
+			healthy := 0
+			for _, t := range route.Targets() {
+				if t.Healthy() {
+					healthy++
+				}
+			}
+
+			if healthy > 0 {
+				checks["route_"+route.Name] = map[string]interface{}{
+					"status":    "healthy",
+					"type":      "upstream",
+					"upstreams": fmt.Sprintf("%d/%d", healthy, len(route.Targets())),
+				}
+			} else {
+				checks["route_"+route.Name] = map[string]interface{}{
+					"status": "unhealthy",
+					"error":  "no healthy upstream",
+					"type":   "upstream",
+				}
+			}
+		}
+	}
+
 	if !allHealthy {
 		healthStatus["status"] = "not_ready"
 		return c.Status(503).JSON(healthStatus)
@@ -14,6 +14,7 @@ import (
 	"greenlync-api-gateway/pkg/manager"
 	"greenlync-api-gateway/pkg/nats"
 	"greenlync-api-gateway/pkg/oauth2"
+	"greenlync-api-gateway/pkg/proxy"
 	"greenlync-api-gateway/pkg/smtp"
 	"time"
 
@@ -49,13 +50,17 @@ type HttpServer struct {
 	Validate *validator.Validate
 	// Go-Cron
 	Cron *gocron.Scheduler
+	// Reverse proxy to upstream services
+	Proxy *proxy.Proxy
 	// operations channel
 	operationCh chan *model.OperationsLog
+	// system alerts channel, raised while proxying so they're never written on the request path
+	alertCh chan *model.Event
 	// Server start time for uptime tracking
 	StartTime time.Time
 }
 
-func NewHTTP(app *http.App, db *gorm.DB, log *logger.Logger, cache *cache.Cache, nats *nats.Nats, authz *authz.Authz, oauth *oauth2.OAuth2, hub *manager.Hub, middleware *middleware.Middleware, smtp *smtp.SMTP, cfg *config.Config, validate *validator.Validate, cron *gocron.Scheduler) *HttpServer {
+func NewHTTP(app *http.App, db *gorm.DB, log *logger.Logger, cache *cache.Cache, nats *nats.Nats, authz *authz.Authz, oauth *oauth2.OAuth2, hub *manager.Hub, middleware *middleware.Middleware, smtp *smtp.SMTP, cfg *config.Config, validate *validator.Validate, cron *gocron.Scheduler, proxy *proxy.Proxy) *HttpServer {
 
 	h := &HttpServer{
 		Middleware:      middleware,
@@ -71,16 +76,43 @@ func NewHTTP(app *http.App, db *gorm.DB, log *logger.Logger, cache *cache.Cache,
 		Validate:        validate,
 		Cron:            cron,
 		Cfg:             cfg,
+		Proxy:           proxy,
 		operationCh:     make(chan *model.OperationsLog),
+		alertCh:         make(chan *model.Event, 100),
 		StartTime:       time.Now(),
 	}
 
 	hub.SetErrorHandler(h.WSErrorHandler)
+	proxy.SetOnCircuitChange(h.publishCircuitAlert)
 	// TODO: Implement session deletion callback for event-driven architecture
 	// oauth.SetOnSessionDelete(h.publishClientDisconnected)
 
 	// Removed NATS system router (trading-specific)
 	go h.writeSystemOperationsLogs()
+	go h.writeSystemAlerts()
+
+	// load the routes managed through the admin api and follow changes made on other replicas
+	err := h.reloadProxyRoutes()
+	if err != nil {
+		log.Logger.Errorf("error loading proxy routes: %v", err)
+	}
+	err = h.subscribeProxyRoutes()
+	if err != nil {
+		log.Logger.Error(err)
+	}
+
+	// load the settings cached from the config store and follow their changes
+	h.reloadConfigs()
+	err = h.subscribeConfigs()
+	if err != nil {
+		log.Logger.Error(err)
+	}
+
+	// close the websockets of the sessions logged out on the other replicas
+	err = h.subscribeWsDisconnect()
+	if err != nil {
+		log.Logger.Error(err)
+	}
 
 	return h
 }
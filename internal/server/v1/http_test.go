@@ -13,8 +13,10 @@ import (
 	"greenlync-api-gateway/pkg/manager"
 	"greenlync-api-gateway/pkg/nats"
 	"greenlync-api-gateway/pkg/oauth2"
+	"greenlync-api-gateway/pkg/proxy"
 	"greenlync-api-gateway/pkg/redis"
 	"greenlync-api-gateway/pkg/smtp"
+	"greenlync-api-gateway/pkg/usage"
 	"io"
 	"net/http"
 	"testing"
@@ -108,14 +110,20 @@ func NewTestServer(t *testing.T) *HttpServer {
 	// OAuth2
 	oauth2 := oauth2.NewOAuth2(cacheClient, dbSess.DB, cfg, log)
 	// middleware
-	middleware := middleware.NewMiddleware(app, dbSess.DB, authz, oauth2, log, nats)
+	meter, err := usage.NewMeter(redisClient, dbSess.DB, log, corn)
+	require.NoError(t, err)
+
+	middleware := middleware.NewMiddleware(app, dbSess.DB, authz, oauth2, log, nats, cacheClient, meter)
 
 	// go-corn
 	cron := gocron.NewScheduler(time.UTC)
 	cron.StartAsync()
 
+	// Reverse proxy
+	proxy := proxy.NewProxy(cfg, log)
+
 	// v1 HTTP
-	newHttp := NewHTTP(app, dbSess.DB, log, cacheClient, nats, authz, oauth2, newHub, middleware, smtp, cfg, validate, cron)
+	newHttp := NewHTTP(app, dbSess.DB, log, cacheClient, nats, authz, oauth2, newHub, middleware, smtp, cfg, validate, cron, proxy)
 
 	newHttp.RegisterV1()
 
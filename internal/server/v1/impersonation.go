@@ -0,0 +1,181 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Admin impersonation of a user to reproduce their issues, audited and notified to the user
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/authz"
+	"greenlync-api-gateway/pkg/errors"
+	"greenlync-api-gateway/pkg/oauth2"
+	"greenlync-api-gateway/pkg/shortuuid"
+	"greenlync-api-gateway/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type Impersonate struct {
+	// why the user is impersonated, e.g. the support ticket, it's sent to the user
+	Reason string `json:"reason" validate:"required,max=500" example:"ticket #4521, checkout fails"`
+}
+
+// ImpersonationResponse is the session acting as the user, it has no refresh token and ends
+// when its access token expires
+type ImpersonationResponse struct {
+	UserId         int32  `json:"user_id"`
+	AccessToken    string `json:"access_token"`
+	SessionId      string `json:"session_id"`
+	ExpiresIn      int32  `json:"expires_in"`
+	Scope          string `json:"scope"`
+	ImpersonatorId int32  `json:"impersonator_id"`
+}
+
+// @Id				ImpersonateUser
+// @Description	Start a time-boxed session acting as the user. The session can't delete data, manage keys, MFA or
+// @Description	change the password, every operation it does is logged with the admin and the user is notified
+// @Tags			Users
+// @Accept			json
+// @Produce		json
+// @Success		201	{object}	v1.ImpersonationResponse
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		403	{object}	http.HttpResponse
+// @Failure		404	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			user_id	path	int				true	"User ID"
+// @Param			body	body	v1.Impersonate	true	"Impersonate Request Body"
+// @Router			/api/v1/system/users/{user_id}/impersonate [post]
+func (s *HttpServer) ImpersonateUser(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c)
+	if !ok {
+		return s.App.HttpResponseInternalServerErrorRequest(c, errors.ErrCouldNotParseClientCfg)
+	}
+
+	// an impersonation session can't start another one
+	if client.ImpersonatorId != 0 {
+		return s.App.HttpResponseForbidden(c, errors.ErrImpersonationRestricted)
+	}
+
+	data := &Impersonate{}
+	err := c.BodyParser(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	data.Reason = strings.TrimSpace(data.Reason)
+	err = s.Validate.Struct(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, utils.ValidatorMessage(err))
+	}
+
+	user, err := s.getUser(c)
+	if err != nil {
+		return s.httpResponseUserError(c, err)
+	}
+
+	// admins aren't impersonated, neither are the accounts that can't log in nor the ones whose
+	// role would give the impersonator more than their own
+	if user.Id == client.ClientId || strings.EqualFold(user.Role, authz.Roles_Admin) || !user.IsActive ||
+		!s.roleWithin(user.Role, client.Scope) {
+		return s.App.HttpResponseForbidden(c, errors.ErrCannotImpersonate)
+	}
+
+	admin := &model.User{}
+	err = s.DB.First(admin, client.ClientId).Error
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	// the session can't outlive a regular access token
+	expiresIn := s.OAuth2.TokenExpiresIn
+	if s.Cfg.Impersonation.ExpiresIn > 0 && s.Cfg.Impersonation.ExpiresIn < expiresIn {
+		expiresIn = s.Cfg.Impersonation.ExpiresIn
+	}
+
+	// the session isn't counted by the sessions policy of the user, it would evict their own sessions
+	cfg := &oauth2.Config{
+		ClientId:       user.Id,
+		Scope:          user.Role,
+		IpAddress:      utils.GetRealIP(c),
+		ExpiresIn:      expiresIn,
+		UserAgent:      utils.GetUserAgent(c),
+		ImpersonatorId: client.ClientId,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	_, err = s.OAuth2.PasswordCredentialsToken(ctx, cfg)
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+	expiresAt := time.Now().Add(time.Duration(cfg.ExpiresIn) * time.Second)
+
+	s.queueSystemOperationLog(&model.OperationsLog{
+		Action:      "impersonate",
+		Resource:    "user",
+		ResourceId:  fmt.Sprint(user.Id),
+		UserId:      client.ClientId,
+		Method:      c.Method(),
+		URL:         c.OriginalURL(),
+		IpAddress:   utils.GetRealIP(c),
+		UserAgent:   c.Get("User-Agent"),
+		RequestBody: data.Reason,
+		SessionId:   client.SessionId,
+	})
+
+	s.emitSecurityEvent(model.EventType_UserImpersonated, user.Id, cfg.SessionId, utils.GetRealIP(c), map[string]interface{}{
+		"impersonator_id":         admin.Id,
+		"impersonator_username":   admin.Username,
+		"impersonator_session_id": client.SessionId,
+		"reason":                  data.Reason,
+		"expires_at":              expiresAt,
+	})
+
+	s.notifyImpersonation(user, admin, data.Reason, expiresAt)
+
+	return s.App.HttpResponseCreated(c, &ImpersonationResponse{
+		UserId:         cfg.ClientId,
+		AccessToken:    cfg.AccessToken,
+		SessionId:      cfg.SessionId,
+		ExpiresIn:      int32(cfg.ExpiresIn),
+		Scope:          cfg.Scope,
+		ImpersonatorId: cfg.ImpersonatorId,
+	})
+}
+
+// roleWithin reports whether every resource of the role is granted to the other role too
+func (s *HttpServer) roleWithin(role, other string) bool {
+	for _, rule := range s.Authz.Enforcer.GetFilteredNamedPolicy("p", 0, role) {
+		if len(rule) != 3 || !s.Authz.Enforcer.HasNamedPolicy("p", other, rule[1], rule[2]) {
+			return false
+		}
+	}
+	return true
+}
+
+// notifyImpersonation tells the user in their in-app inbox who accessed the account and why, a
+// failure is only logged since the impersonation is audited anyway
+func (s *HttpServer) notifyImpersonation(user, admin *model.User, reason string, expiresAt time.Time) {
+	mail := &model.Mail{
+		CommonId: shortuuid.New(),
+		UserId:   admin.Id,
+		ToUserId: user.Id,
+		OwnerId:  user.Id,
+		Subject:  "Your account was accessed by support",
+		Body: fmt.Sprintf("%s accessed your account on %s until %s at the latest.\nReason: %s",
+			admin.Username, time.Now().UTC().Format(time.RFC1123), expiresAt.UTC().Format(time.RFC1123), reason),
+		Type:   model.MailType_notification,
+		Status: model.MailStatus_sent,
+	}
+
+	err := s.DB.Create(mail).Error
+	if err != nil {
+		s.Log.Logger.Errorf("error notifying user %d of the impersonation by %d: %v", user.Id, admin.Id, err)
+	}
+}
@@ -0,0 +1,122 @@
+// Developer: zeelrupapara@gmail.com
+// Description: OAuth2 token introspection (RFC 7662) and revocation (RFC 7009) for registered clients
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/errors"
+	"greenlync-api-gateway/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// authenticateClient returns the registered client authenticated with the basic auth credentials
+func (s *HttpServer) authenticateClient(ctx context.Context, c *fiber.Ctx) (*model.OAuthClient, error) {
+	clientId, _ := c.Locals("username").(string)
+	secret, _ := c.Locals("password").(string)
+
+	return s.OAuth2.AuthenticateClient(ctx, clientId, secret)
+}
+
+// @Id				Introspect
+// @Description	Get the state of an access or refresh token issued by the gateway, inactive tokens only have active=false
+// @Tags			Auth
+// @Accept			x-www-form-urlencoded
+// @Produce		json
+// @Param			token			formData	string	true	"access or refresh token"
+// @Param			token_type_hint	formData	string	false	"access_token or refresh_token"
+// @Success		200				{object}	oauth2.Introspection
+// @Failure		400				{object}	http.HttpResponse
+// @Failure		401				{object}	http.HttpResponse
+// @Failure		500				{object}	http.HttpResponse
+// @Security		BasicAuth
+// @Router			/auth/v1/oauth2/introspect [post]
+func (s *HttpServer) Introspect(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	_, err := s.authenticateClient(ctx, c)
+	if err != nil {
+		if err == errors.ErrInvalidClient {
+			return s.App.HttpResponseUnauthorized(c, err)
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	token := c.FormValue("token")
+	if token == "" {
+		return s.App.HttpResponseBadRequest(c, fmt.Errorf("token %s", errors.RequiredField))
+	}
+
+	introspection, err := s.OAuth2.Introspect(ctx, token, c.FormValue("token_type_hint"))
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(introspection)
+}
+
+// @Id				Revoke
+// @Description	Revoke an access or refresh token issued to the client, revoking a refresh token logs its session out.
+// @Description	Unknown or already revoked tokens are ignored
+// @Tags			Auth
+// @Accept			x-www-form-urlencoded
+// @Produce		json
+// @Param			token			formData	string	true	"access or refresh token"
+// @Param			token_type_hint	formData	string	false	"access_token or refresh_token"
+// @Success		200
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		401	{object}	http.HttpResponse
+// @Failure		403	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BasicAuth
+// @Router			/auth/v1/oauth2/revoke [post]
+func (s *HttpServer) Revoke(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	client, err := s.authenticateClient(ctx, c)
+	if err != nil {
+		if err == errors.ErrInvalidClient {
+			return s.App.HttpResponseUnauthorized(c, err)
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	token := c.FormValue("token")
+	if token == "" {
+		return s.App.HttpResponseBadRequest(c, fmt.Errorf("token %s", errors.RequiredField))
+	}
+
+	sessionId, err := s.OAuth2.RevokeToken(ctx, token, c.FormValue("token_type_hint"), client)
+	if err != nil {
+		if err == errors.ErrUnauthorizedClient {
+			return s.App.HttpResponseForbidden(c, err)
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	if sessionId != "" {
+		// logout from the websocket if there is a connection
+		s.disconnectWs(sessionId, 0, nil)
+
+		s.queueSystemOperationLog(&model.OperationsLog{
+			Action:     "revoke_token",
+			Resource:   "session",
+			ResourceId: client.ClientId,
+			Method:     c.Method(),
+			URL:        c.OriginalURL(),
+			IpAddress:  utils.GetRealIP(c),
+			UserAgent:  c.Get("User-Agent"),
+			SessionId:  sessionId,
+		})
+	}
+
+	return s.App.HttpResponseOK(c, nil)
+}
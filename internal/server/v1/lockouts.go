@@ -0,0 +1,168 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Brute-force protection of the password logins, delays and lockouts per account and client ip
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/errors"
+	"greenlync-api-gateway/pkg/oauth2"
+	"greenlync-api-gateway/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// loginLocked reports whether the password login of the subject has to wait because of the
+// previous failures, the Retry-After header is set when it does. Logins are let through if redis
+// is unreachable
+func (s *HttpServer) loginLocked(c *fiber.Ctx, subject string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	wait, _, err := s.OAuth2.Logins.Check(ctx, subject, utils.GetRealIP(c))
+	if err != nil {
+		s.Log.Logger.Errorf("error checking the failed logins of %s: %v", subject, err)
+		return false
+	}
+	if wait <= 0 {
+		return false
+	}
+
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return true
+}
+
+// loginFailed counts a failed password login, every lockout it causes is logged and raised as a
+// system alert. The failures are counted per account, userId is 0 when the username doesn't exist
+func (s *HttpServer) loginFailed(c *fiber.Ctx, username string, userId int32) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	ip := utils.GetRealIP(c)
+	locked, err := s.OAuth2.Logins.Fail(ctx, oauth2.LoginSubject(username, userId), ip)
+	if err != nil {
+		s.Log.Logger.Errorf("error counting the failed logins of %s: %v", oauth2.LoginSubject(username, userId), err)
+		return
+	}
+
+	for _, subject := range locked {
+		s.queueSystemOperationLog(&model.OperationsLog{
+			Action:     "lockout",
+			Resource:   "login",
+			ResourceId: subject,
+			UserId:     userId,
+			Method:     c.Method(),
+			URL:        c.OriginalURL(),
+			IpAddress:  ip,
+			UserAgent:  c.Get("User-Agent"),
+		})
+
+		s.emitSecurityEvent(model.EventType_SystemAlert, userId, "", ip, map[string]interface{}{
+			"reason":     "login_lockout",
+			"subject":    subject,
+			"expires_in": int(s.OAuth2.Logins.LockoutDuration().Seconds()),
+		})
+	}
+}
+
+// loginSucceeded forgets the failed logins of the account
+func (s *HttpServer) loginSucceeded(userId int32) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	err := s.OAuth2.Logins.Succeed(ctx, oauth2.AccountSubject(userId))
+	if err != nil {
+		s.Log.Logger.Errorf("error resetting the failed logins of user %d: %v", userId, err)
+	}
+}
+
+// @Id				GetAllLockouts
+// @Description	Get the accounts, usernames and client ips locked out after too many failed logins
+// @Tags			Lockouts
+// @Accept			json
+// @Produce		json
+// @Success		200	{array}		oauth2.Lockout
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Router			/api/v1/system/lockouts [get]
+func (s *HttpServer) GetAllLockouts(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	lockouts, err := s.OAuth2.Logins.Lockouts(ctx)
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	return s.App.HttpResponseOK(c, lockouts)
+}
+
+// @Id				Unlock
+// @Description	Lift the lockout of an account, a username or a client ip and forget its failed logins
+// @Tags			Lockouts
+// @Accept			json
+// @Produce		json
+// @Success		200
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			user_id		query	int		false	"user id to unlock"
+// @Param			username	query	string	false	"username to unlock, its account when it has one"
+// @Param			ip			query	string	false	"client ip to unlock"
+// @Router			/api/v1/system/lockouts [delete]
+func (s *HttpServer) Unlock(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c)
+	if !ok {
+		return s.App.HttpResponseInternalServerErrorRequest(c, errors.ErrCouldNotParseClientCfg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	subject := ""
+	switch {
+	case c.Query("user_id") != "":
+		userId, err := strconv.Atoi(c.Query("user_id"))
+		if err != nil {
+			return s.App.HttpResponseBadQueryParams(c, fmt.Errorf("user_id: %w", err))
+		}
+		subject = oauth2.AccountSubject(int32(userId))
+	case c.Query("username") != "":
+		// the failures of an existing account are counted on the account
+		user := &model.User{}
+		err := s.DB.WithContext(ctx).Where("username = ?", c.Query("username")).Limit(1).Find(user).Error
+		if err != nil {
+			return s.App.HttpResponseInternalServerErrorRequest(c, err)
+		}
+		subject = oauth2.LoginSubject(c.Query("username"), user.Id)
+	case c.Query("ip") != "":
+		subject = oauth2.IPSubject(c.Query("ip"))
+	default:
+		return s.App.HttpResponseBadRequest(c, fmt.Errorf("user_id, username or ip %s", errors.RequiredField))
+	}
+
+	err := s.OAuth2.Logins.Unlock(ctx, subject)
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	s.queueSystemOperationLog(&model.OperationsLog{
+		Action:     "unlock",
+		Resource:   "login",
+		ResourceId: subject,
+		UserId:     client.ClientId,
+		Method:     c.Method(),
+		URL:        c.OriginalURL(),
+		IpAddress:  utils.GetRealIP(c),
+		UserAgent:  c.Get("User-Agent"),
+		SessionId:  client.SessionId,
+	})
+
+	return s.App.HttpResponseOK(c, nil)
+}
@@ -0,0 +1,227 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Self-service profile and sessions of the current user
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/errors"
+	"greenlync-api-gateway/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type UptMyProfile struct {
+	FirstName   string `json:"first_name" validate:"max=100" example:"Alice"`
+	LastName    string `json:"last_name" validate:"max=100"`
+	CompanyName string `json:"company_name" validate:"max=255"`
+	Phone       string `json:"phone" validate:"max=20"`
+	Address     string `json:"address"`
+}
+
+// MySession is an active session of the current user, the tokens aren't exposed
+type MySession struct {
+	// Id of the session, used to revoke it
+	Id           string            `json:"id"`
+	SessionId    string            `json:"session_id"`
+	IpAddress    string            `json:"ip_address"`
+	StartedAt    time.Time         `json:"started_at"`
+	LastActivity time.Time         `json:"last_activity"`
+	Device       string            `json:"device" example:"Chrome/120.0.0.0"`
+	OS           string            `json:"os" example:"Windows"`
+	Channel      model.ChannelType `json:"channel"`
+	// the session of this request
+	Current bool `json:"current"`
+	// admin impersonating the user in the session
+	ImpersonatorId int32 `json:"impersonator_id,omitempty"`
+}
+
+// @Id				GetMyProfile
+// @Description	Get the profile of the current user
+// @Tags			Me
+// @Accept			json
+// @Produce		json
+// @Success		200	{object}	model.User
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Router			/api/v1/me [get]
+func (s *HttpServer) GetMyProfile(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c)
+	if !ok {
+		return s.App.HttpResponseInternalServerErrorRequest(c, errors.ErrCouldNotParseClientCfg)
+	}
+
+	user := &model.User{}
+	err := s.DB.First(user, client.ClientId).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return s.App.HttpResponseNotFound(c, err)
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	return s.App.HttpResponseOK(c, user)
+}
+
+// @Id				UpdateMyProfile
+// @Description	Update the profile of the current user, the username, email and role are changed by an admin
+// @Tags			Me
+// @Accept			json
+// @Produce		json
+// @Success		200	{object}	model.User
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			body	body	v1.UptMyProfile	true	"Profile Request Body"
+// @Router			/api/v1/me [put]
+func (s *HttpServer) UpdateMyProfile(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c)
+	if !ok {
+		return s.App.HttpResponseInternalServerErrorRequest(c, errors.ErrCouldNotParseClientCfg)
+	}
+
+	data := &UptMyProfile{}
+	err := c.BodyParser(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	err = s.Validate.Struct(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, utils.ValidatorMessage(err))
+	}
+
+	user := &model.User{}
+	err = s.DB.First(user, client.ClientId).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return s.App.HttpResponseNotFound(c, err)
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	user.FirstName = data.FirstName
+	user.LastName = data.LastName
+	user.CompanyName = data.CompanyName
+	user.Phone = data.Phone
+	user.Address = data.Address
+
+	err = s.DB.Model(user).
+		Select("first_name", "last_name", "company_name", "phone", "address").
+		Updates(user).Error
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	s.queueSystemOperationLog(&model.OperationsLog{
+		Action:     "update_profile",
+		Resource:   "user",
+		ResourceId: fmt.Sprint(user.Id),
+		UserId:     user.Id,
+		Method:     c.Method(),
+		URL:        c.OriginalURL(),
+		IpAddress:  utils.GetRealIP(c),
+		UserAgent:  c.Get("User-Agent"),
+		SessionId:  client.SessionId,
+	})
+
+	return s.App.HttpResponseOK(c, user)
+}
+
+// @Id				GetMySessions
+// @Description	Get the active sessions of the current user with their device
+// @Tags			Me
+// @Accept			json
+// @Produce		json
+// @Success		200	{array}		v1.MySession
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Router			/api/v1/me/sessions [get]
+func (s *HttpServer) GetMySessions(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c)
+	if !ok {
+		return s.App.HttpResponseInternalServerErrorRequest(c, errors.ErrCouldNotParseClientCfg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	sessions, err := s.OAuth2.GetAllActiveSessionsCountByClientId(ctx, client.ClientId)
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+	mySessions := make([]*MySession, 0, len(sessions))
+	for _, v := range sessions {
+		ua := utils.UserAgentParser(v.UserAgent)
+		mySessions = append(mySessions, &MySession{
+			Id:             v.Id,
+			SessionId:      v.SessionId,
+			IpAddress:      v.IpAddress,
+			StartedAt:      v.StartedAt,
+			LastActivity:   v.LastActivity,
+			Device:         ua.Device,
+			OS:             ua.OS,
+			Channel:        ua.Channel,
+			Current:        v.SessionId == client.SessionId,
+			ImpersonatorId: v.ImpersonatorId,
+		})
+	}
+
+	return s.App.HttpResponseOK(c, mySessions)
+}
+
+// @Id				RevokeMySession
+// @Description	Log out one of the other sessions of the current user, the current session logs out with /auth/v1/oauth2/logout
+// @Tags			Me
+// @Accept			json
+// @Produce		json
+// @Success		204
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		404	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			id	path	string	true	"Session ID"
+// @Router			/api/v1/me/sessions/{id} [delete]
+func (s *HttpServer) RevokeMySession(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c)
+	if !ok {
+		return s.App.HttpResponseInternalServerErrorRequest(c, errors.ErrCouldNotParseClientCfg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	// sessions of the other users are reported as missing
+	cfg, ok, err := s.OAuth2.GetActiveSessionById(ctx, c.Params("id"))
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+	if !ok || cfg.ClientId != client.ClientId {
+		return s.App.HttpResponseNotFound(c, errors.ErrSessionNotFound)
+	}
+
+	if cfg.SessionId == client.SessionId {
+		return s.App.HttpResponseBadRequest(c, errors.ErrCannotRevokeCurrentSession)
+	}
+
+	s.killClientSession(cfg, SessionDescionnectionReason_SessionKilled)
+
+	s.queueSystemOperationLog(&model.OperationsLog{
+		Action:     "revoke_session",
+		Resource:   "session",
+		ResourceId: cfg.SessionId,
+		UserId:     client.ClientId,
+		Method:     c.Method(),
+		URL:        c.OriginalURL(),
+		IpAddress:  utils.GetRealIP(c),
+		UserAgent:  c.Get("User-Agent"),
+		SessionId:  client.SessionId,
+	})
+
+	return s.App.HttpResponseNoContent(c)
+}
@@ -0,0 +1,567 @@
+// Developer: zeelrupapara@gmail.com
+// Description: TOTP multi-factor authentication, the second login step and the enrollment of the current user
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/errors"
+	"greenlync-api-gateway/pkg/oauth2"
+	"greenlync-api-gateway/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// MfaChallengeResponse is returned by the login instead of a session when a second factor is needed
+type MfaChallengeResponse struct {
+	MfaRequired bool   `json:"mfa_required"`
+	MfaToken    string `json:"mfa_token"`
+	ExpiresIn   int32  `json:"expires_in"`
+	// MFA is mandatory for the role, enroll with the mfa token before verifying a code
+	EnrollmentRequired bool `json:"enrollment_required"`
+	// the device is unknown and the user has no MFA, verify the code emailed to the user
+	EmailCode bool `json:"email_code"`
+}
+
+type MfaVerify struct {
+	MfaToken string `json:"mfa_token" validate:"required"`
+	// TOTP code of the authenticator app
+	Code string `json:"code" validate:"required_without=RecoveryCode" example:"123456"`
+	// used instead of the code when the authenticator app is lost
+	RecoveryCode string `json:"recovery_code" example:"abcde-12345"`
+}
+
+type MfaEnroll struct {
+	MfaToken string `json:"mfa_token" validate:"required"`
+}
+
+type MfaCode struct {
+	Code         string `json:"code" validate:"required_without=RecoveryCode" example:"123456"`
+	RecoveryCode string `json:"recovery_code" example:"abcde-12345"`
+}
+
+// TotpEnrollment is the secret to add to the authenticator app, the uri is usually shown as a QR code
+type TotpEnrollment struct {
+	Secret string `json:"secret"`
+	Uri    string `json:"uri"`
+}
+
+type MfaStatus struct {
+	Enabled bool `json:"enabled"`
+	// enrolled but not confirmed with a first code yet
+	Pending bool `json:"pending"`
+	// MFA is mandatory for the role of the user
+	Required          bool       `json:"required"`
+	RecoveryCodesLeft int        `json:"recovery_codes_left"`
+	ConfirmedAt       *time.Time `json:"confirmed_at"`
+}
+
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// newMfaChallenge returns the challenge the user answers before a session is issued, nil when
+// the user has no MFA and neither the role nor an untrusted device requires it
+func (s *HttpServer) newMfaChallenge(c *fiber.Ctx, user *model.User, rememberMe bool) (*MfaChallengeResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	mfa, err := s.OAuth2.GetMfa(ctx, user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	enabled := mfa != nil && mfa.ConfirmedAt != nil
+	challenge := &oauth2.MfaChallenge{
+		UserId:             user.Id,
+		RememberMe:         rememberMe,
+		EnrollmentRequired: !enabled && s.OAuth2.MfaRequired(user.Role),
+	}
+
+	// the devices the user didn't trust need a second factor as well. Users without MFA get a code
+	// by email, enrolling there would let the password alone set the second factor of the account
+	if !enabled && !challenge.EnrollmentRequired {
+		if !s.Cfg.Devices.RequireMfa {
+			return nil, nil
+		}
+		trusted, err := s.deviceTrusted(ctx, c, user.Id)
+		if err != nil {
+			return nil, err
+		}
+		if trusted {
+			return nil, nil
+		}
+
+		err = s.sendDeviceCode(ctx, c, user)
+		if err != nil {
+			return nil, err
+		}
+		challenge.EmailCode = true
+	}
+
+	token, err := s.OAuth2.NewMfaChallenge(ctx, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MfaChallengeResponse{
+		MfaRequired:        true,
+		MfaToken:           token,
+		ExpiresIn:          int32(oauth2.MfaChallengeTTL),
+		EnrollmentRequired: challenge.EnrollmentRequired,
+		EmailCode:          challenge.EmailCode,
+	}, nil
+}
+
+// sendDeviceCode emails the user the code verifying the unknown device they sign in from
+func (s *HttpServer) sendDeviceCode(ctx context.Context, c *fiber.Ctx, user *model.User) error {
+	code, err := s.OAuth2.NewDeviceCode(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+
+	accountName := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if accountName == "" {
+		accountName = user.Username
+	}
+
+	device := s.loginDevice(c, user.Id)
+	return s.Smtp.SendDeviceCodeEmail(user, user.Email, accountName, code, device.Browser, device.OS, device.IpAddress,
+		time.Duration(oauth2.MfaChallengeTTL)*time.Second)
+}
+
+// totpEnrollment starts the TOTP enrollment of the user
+func (s *HttpServer) totpEnrollment(ctx context.Context, userId int32) (*TotpEnrollment, error) {
+	user := &model.User{}
+	err := s.DB.WithContext(ctx).First(user, userId).Error
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := s.OAuth2.EnrollTotp(ctx, user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	account := user.Email
+	if account == "" {
+		account = user.Username
+	}
+
+	return &TotpEnrollment{
+		Secret: secret,
+		Uri:    oauth2.TotpURI(oauth2.TotpIssuer, account, secret),
+	}, nil
+}
+
+// httpResponseMfaError maps the MFA errors to their status
+func (s *HttpServer) httpResponseMfaError(c *fiber.Ctx, err error) error {
+	switch err {
+	case errors.ErrInvalidMfaCode, errors.ErrMfaAlreadyEnabled, errors.ErrMfaNotEnrolled:
+		return s.App.HttpResponseBadRequest(c, err)
+	case errors.ErrMfaRequired:
+		return s.App.HttpResponseForbidden(c, err)
+	case errors.ErrLoginLocked:
+		return s.App.HttpResponseTooManyRequests(c, err)
+	default:
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+}
+
+// verifyMyMfa checks a code of the signed in user, the wrong codes lock the account out like at login
+// so a stolen session can't guess its way to the MFA settings
+func (s *HttpServer) verifyMyMfa(ctx context.Context, c *fiber.Ctx, userId int32, code, recoveryCode string) error {
+	if s.loginLocked(c, oauth2.AccountSubject(userId)) {
+		return errors.ErrLoginLocked
+	}
+
+	err := s.OAuth2.VerifyMfa(ctx, userId, code, recoveryCode)
+	if err == errors.ErrInvalidMfaCode {
+		s.loginFailed(c, "", userId)
+	}
+
+	return err
+}
+
+func (s *HttpServer) queueMfaOperationLog(c *fiber.Ctx, action string, userId int32, sessionId string) {
+	s.queueSystemOperationLog(&model.OperationsLog{
+		Action:     action,
+		Resource:   "mfa",
+		ResourceId: fmt.Sprint(userId),
+		UserId:     userId,
+		Method:     c.Method(),
+		URL:        c.OriginalURL(),
+		IpAddress:  utils.GetRealIP(c),
+		UserAgent:  c.Get("User-Agent"),
+		SessionId:  sessionId,
+	})
+}
+
+// @Id				EnrollMfaChallenge
+// @Description	Start the TOTP enrollment of a user whose role requires MFA, with the mfa token of the login.
+// @Description	The first code verified with /auth/v1/oauth2/mfa/verify confirms the enrollment
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Success		200	{object}	v1.TotpEnrollment
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		401	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Param			body	body	v1.MfaEnroll	true	"MFA Enroll Request Body"
+// @Router			/auth/v1/oauth2/mfa/enroll [post]
+func (s *HttpServer) EnrollMfaChallenge(c *fiber.Ctx) error {
+	data := &MfaEnroll{}
+	err := c.BodyParser(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	err = s.Validate.Struct(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, utils.ValidatorMessage(err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	challenge, err := s.OAuth2.GetMfaChallenge(ctx, data.MfaToken)
+	if err != nil {
+		if err == errors.ErrInvalidMfaToken {
+			return s.App.HttpResponseUnauthorized(c, err)
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+	if !challenge.EnrollmentRequired {
+		return s.App.HttpResponseBadRequest(c, errors.ErrMfaAlreadyEnabled)
+	}
+
+	enrollment, err := s.totpEnrollment(ctx, challenge.UserId)
+	if err != nil {
+		return s.httpResponseMfaError(c, err)
+	}
+
+	return s.App.HttpResponseOK(c, enrollment)
+}
+
+// @Id				VerifyMfa
+// @Description	Second login step, verify a TOTP code, a recovery code or the code emailed for an unknown device with
+// @Description	the mfa token of the login to get the session.
+// @Description	The login that confirms a new enrollment also returns the recovery codes, they aren't shown again
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Success		200	{object}	v1.LoginResponse
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		401	{object}	http.HttpResponse
+// @Failure		429	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Param			body	body	v1.MfaVerify	true	"MFA Verify Request Body"
+// @Router			/auth/v1/oauth2/mfa/verify [post]
+func (s *HttpServer) VerifyMfa(c *fiber.Ctx) error {
+	data := &MfaVerify{}
+	err := c.BodyParser(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	err = s.Validate.Struct(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, utils.ValidatorMessage(err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	challenge, err := s.OAuth2.GetMfaChallenge(ctx, data.MfaToken)
+	if err != nil {
+		if err == errors.ErrInvalidMfaToken {
+			return s.App.HttpResponseUnauthorized(c, err)
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	// the wrong codes lock the account out like wrong passwords, new challenges can't be used to
+	// keep guessing
+	if s.loginLocked(c, oauth2.AccountSubject(challenge.UserId)) {
+		return s.App.HttpResponseTooManyRequests(c, errors.ErrLoginLocked)
+	}
+
+	// the attempt is counted before the code is checked, too many drop the challenge
+	err = s.OAuth2.AttemptMfaChallenge(ctx, data.MfaToken)
+	if err != nil {
+		if err == errors.ErrInvalidMfaToken {
+			return s.App.HttpResponseUnauthorized(c, err)
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	var recoveryCodes []string
+	switch {
+	case challenge.EmailCode:
+		err = s.OAuth2.VerifyDeviceCode(ctx, challenge.UserId, data.Code)
+	case challenge.EnrollmentRequired:
+		recoveryCodes, err = s.OAuth2.ConfirmTotp(ctx, challenge.UserId, data.Code)
+	default:
+		err = s.OAuth2.VerifyMfa(ctx, challenge.UserId, data.Code, data.RecoveryCode)
+	}
+	if err != nil {
+		if err == errors.ErrInvalidMfaCode {
+			s.loginFailed(c, "", challenge.UserId)
+			return s.App.HttpResponseUnauthorized(c, err)
+		}
+		return s.httpResponseMfaError(c, err)
+	}
+	s.loginSucceeded(challenge.UserId)
+
+	err = s.OAuth2.ConsumeMfaChallenge(ctx, data.MfaToken)
+	if err != nil {
+		if err == errors.ErrInvalidMfaToken {
+			return s.App.HttpResponseUnauthorized(c, err)
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	user := &model.User{}
+	err = s.DB.First(user, challenge.UserId).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return s.App.HttpResponseUnauthorized(c, errors.ErrInvalidMfaToken)
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	// the account could have been deactivated since the first step
+	if !user.IsActive {
+		return s.App.HttpResponseUnauthorized(c, fmt.Errorf("the account has been deactivated"))
+	}
+
+	if challenge.EnrollmentRequired {
+		s.queueMfaOperationLog(c, "enable_mfa", user.Id, "")
+	}
+	if data.RecoveryCode != "" {
+		s.queueMfaOperationLog(c, "use_mfa_recovery_code", user.Id, "")
+	}
+
+	return s.passwordSession(c, user, challenge.RememberMe, recoveryCodes)
+}
+
+// @Id				GetMyMfa
+// @Description	Get the MFA status of the current user
+// @Tags			Mfa
+// @Accept			json
+// @Produce		json
+// @Success		200	{object}	v1.MfaStatus
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Router			/api/v1/me/mfa [get]
+func (s *HttpServer) GetMyMfa(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c)
+	if !ok {
+		return s.App.HttpResponseInternalServerErrorRequest(c, errors.ErrCouldNotParseClientCfg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	mfa, err := s.OAuth2.GetMfa(ctx, client.ClientId)
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	status := &MfaStatus{Required: s.OAuth2.MfaRequired(client.Scope)}
+	if mfa != nil {
+		status.Enabled = mfa.ConfirmedAt != nil
+		status.Pending = mfa.ConfirmedAt == nil
+		status.RecoveryCodesLeft = len(mfa.RecoveryCodes)
+		status.ConfirmedAt = mfa.ConfirmedAt
+	}
+
+	return s.App.HttpResponseOK(c, status)
+}
+
+// @Id				EnrollMyMfa
+// @Description	Start the TOTP enrollment of the current user, MFA is enabled once a first code is confirmed.
+// @Description	Enrolling again replaces an unconfirmed enrollment
+// @Tags			Mfa
+// @Accept			json
+// @Produce		json
+// @Success		200	{object}	v1.TotpEnrollment
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Router			/api/v1/me/mfa [post]
+func (s *HttpServer) EnrollMyMfa(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c)
+	if !ok {
+		return s.App.HttpResponseInternalServerErrorRequest(c, errors.ErrCouldNotParseClientCfg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	enrollment, err := s.totpEnrollment(ctx, client.ClientId)
+	if err != nil {
+		return s.httpResponseMfaError(c, err)
+	}
+
+	return s.App.HttpResponseOK(c, enrollment)
+}
+
+// @Id				ConfirmMyMfa
+// @Description	Enable MFA with a first code of the authenticator app, the recovery codes are only returned in this response
+// @Tags			Mfa
+// @Accept			json
+// @Produce		json
+// @Success		200	{object}	v1.RecoveryCodes
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			body	body	v1.MfaCode	true	"MFA Code Request Body"
+// @Router			/api/v1/me/mfa/confirm [post]
+func (s *HttpServer) ConfirmMyMfa(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c)
+	if !ok {
+		return s.App.HttpResponseInternalServerErrorRequest(c, errors.ErrCouldNotParseClientCfg)
+	}
+
+	data := &MfaCode{}
+	err := c.BodyParser(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	err = s.Validate.Struct(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, utils.ValidatorMessage(err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	codes, err := s.OAuth2.ConfirmTotp(ctx, client.ClientId, data.Code)
+	if err != nil {
+		return s.httpResponseMfaError(c, err)
+	}
+
+	s.queueMfaOperationLog(c, "enable_mfa", client.ClientId, client.SessionId)
+
+	return s.App.HttpResponseOK(c, &RecoveryCodes{RecoveryCodes: codes})
+}
+
+// @Id				RegenerateMyRecoveryCodes
+// @Description	Replace the recovery codes of the current user, a code of the authenticator app is needed
+// @Tags			Mfa
+// @Accept			json
+// @Produce		json
+// @Success		200	{object}	v1.RecoveryCodes
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		429	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			body	body	v1.MfaCode	true	"MFA Code Request Body"
+// @Router			/api/v1/me/mfa/recovery-codes [post]
+func (s *HttpServer) RegenerateMyRecoveryCodes(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c)
+	if !ok {
+		return s.App.HttpResponseInternalServerErrorRequest(c, errors.ErrCouldNotParseClientCfg)
+	}
+
+	data := &MfaCode{}
+	err := c.BodyParser(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+	if data.Code == "" {
+		return s.App.HttpResponseBadRequest(c, fmt.Errorf("code %s", errors.RequiredField))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	err = s.verifyMyMfa(ctx, c, client.ClientId, data.Code, "")
+	if err != nil {
+		return s.httpResponseMfaError(c, err)
+	}
+
+	codes, err := s.OAuth2.RegenerateRecoveryCodes(ctx, client.ClientId)
+	if err != nil {
+		return s.httpResponseMfaError(c, err)
+	}
+
+	s.queueMfaOperationLog(c, "regenerate_mfa_recovery_codes", client.ClientId, client.SessionId)
+
+	return s.App.HttpResponseOK(c, &RecoveryCodes{RecoveryCodes: codes})
+}
+
+// @Id				DisableMyMfa
+// @Description	Disable MFA of the current user with a code of the authenticator app or a recovery code,
+// @Description	not allowed when MFA is mandatory for the role. An unconfirmed enrollment is dropped without a code
+// @Tags			Mfa
+// @Accept			json
+// @Produce		json
+// @Success		200
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		403	{object}	http.HttpResponse
+// @Failure		429	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			body	body	v1.MfaCode	false	"MFA Code Request Body"
+// @Router			/api/v1/me/mfa [delete]
+func (s *HttpServer) DisableMyMfa(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c)
+	if !ok {
+		return s.App.HttpResponseInternalServerErrorRequest(c, errors.ErrCouldNotParseClientCfg)
+	}
+
+	data := &MfaCode{}
+	if len(c.Body()) != 0 {
+		err := c.BodyParser(data)
+		if err != nil {
+			return s.App.HttpResponseBadRequest(c, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	mfa, err := s.OAuth2.GetMfa(ctx, client.ClientId)
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+	if mfa == nil {
+		return s.App.HttpResponseBadRequest(c, errors.ErrMfaNotEnrolled)
+	}
+
+	if mfa.ConfirmedAt != nil {
+		if s.OAuth2.MfaRequired(client.Scope) {
+			return s.App.HttpResponseForbidden(c, errors.ErrMfaRequired)
+		}
+
+		err = s.Validate.Struct(data)
+		if err != nil {
+			return s.App.HttpResponseBadRequest(c, utils.ValidatorMessage(err))
+		}
+
+		err = s.verifyMyMfa(ctx, c, client.ClientId, data.Code, data.RecoveryCode)
+		if err != nil {
+			return s.httpResponseMfaError(c, err)
+		}
+	}
+
+	err = s.OAuth2.DisableMfa(ctx, client.ClientId)
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	if mfa.ConfirmedAt != nil {
+		s.queueMfaOperationLog(c, "disable_mfa", client.ClientId, client.SessionId)
+	}
+
+	return s.App.HttpResponseOK(c, nil)
+}
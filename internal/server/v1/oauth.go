@@ -5,6 +5,7 @@ package v1
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 	model "greenlync-api-gateway/model/common/v1"
 	"greenlync-api-gateway/pkg/errors"
@@ -21,8 +22,8 @@ import (
 const (
 	GRANT_TYPE_CLIENT_CREDENTIALS = "client_credentials"
 	GRANT_TYPE_PASSWORD           = "password"
+	GRANT_TYPE_AUTHORIZATION_CODE = "authorization_code"
 )
-const MAX_SESSIONS = 5
 
 type User struct {
 	Username string `json:"username"`
@@ -37,6 +38,12 @@ type LoginResponse struct {
 	ExpiresIn    int32  `json:"expires_in"`
 	IpAddress    string `json:"ip_address"`
 	Scope        string `json:"scope"`
+	// OpenID Connect id token, set when the gateway has signing keys
+	IdToken string `json:"id_token,omitempty"`
+	// only returned by the login that confirmed the MFA enrollment
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+	// the user never signed in from the device before
+	NewDevice bool `json:"new_device,omitempty"`
 }
 
 type SessionEvent struct {
@@ -47,11 +54,15 @@ type SessionEvent struct {
 }
 
 //	@Id				Login
-//	@Description	Login using account credentials passed using basic auth method
+//	@Description	Login using account credentials passed using basic auth method, users with MFA get an mfa token
+//	@Description	to verify a code with /auth/v1/oauth2/mfa/verify instead of the session
 //	@Tags			Auth
 //	@Accept			json
 //	@Produce		json
 //	@Success		200	{object}	v1.LoginResponse
+//	@Success		200	{object}	v1.MfaChallengeResponse
+//	@Failure		403	{object}	http.HttpResponse
+//	@Failure		429	{object}	http.HttpResponse
 //	@Failure		500	{object}	http.HttpResponse
 //	@Security		BasicAuth
 //	@Authorization:	Basic username:password
@@ -68,28 +79,30 @@ func (s *HttpServer) Login(c *fiber.Ctx) error {
 		return s.App.HttpResponseBadRequest(c, fmt.Errorf("grant_type %s", errors.RequiredField))
 	}
 
-	user := &model.User{}
-	query := s.DB
+	// registered clients authenticate with their client id and client secret
 	if grantType == GRANT_TYPE_CLIENT_CREDENTIALS {
-		query = query.Where("username = ?", username)
-	} else {
-		query = query.Where("id = ? OR username = ?", username, username)
+		return s.clientCredentialsToken(c, username, password)
 	}
-	err := query.First(user).Error
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return s.App.HttpResponseUnauthorized(c, fmt.Errorf("incorrect password or username"))
-		}
-		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	if grantType != GRANT_TYPE_PASSWORD {
+		return s.App.HttpResponseBadRequest(c, fmt.Errorf("unsupported grant_type %s", grantType))
 	}
 
-	var ok bool
-	if grantType == GRANT_TYPE_CLIENT_CREDENTIALS || grantType == GRANT_TYPE_PASSWORD {
-		// Simplified password check for boilerplate - just compare password hash
-		ok = oauth2.ComparePassword(user.PasswordHash, password)
+	// failed logins delay the next ones, too many lock the account or the client ip out
+	if s.loginLocked(c, oauth2.UserSubject(username)) {
+		return s.App.HttpResponseTooManyRequests(c, errors.ErrLoginLocked)
 	}
-	if !ok {
-		return s.App.HttpResponseUnauthorized(c, fmt.Errorf("incorrect username or password"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	// the authentication backends check the password, the database or the directory
+	user, err := s.OAuth2.Authenticate(ctx, username, password)
+	// an account is locked whatever name it's logged in with, the right password included
+	if user != nil && s.loginLocked(c, oauth2.AccountSubject(user.Id)) {
+		return s.App.HttpResponseTooManyRequests(c, errors.ErrLoginLocked)
+	}
+	if err != nil {
+		return s.httpResponseLoginError(c, username, user, err)
 	}
 
 	// check account is active
@@ -97,27 +110,99 @@ func (s *HttpServer) Login(c *fiber.Ctx) error {
 		return s.App.HttpResponseUnauthorized(c, fmt.Errorf("the account has been deactivated"))
 	}
 
-	// Simplified session management for boilerplate
-	// TODO: Implement proper multi-session management
-	oldestSession, count := s.OAuth2.GetActiveSessionsCountByClientId(user.Id)
-	
-	// Simple single session limit for boilerplate
-	if count >= 1 {
-		// kill the oldest session
-		s.killClientSession(oldestSession, SessionDescionnectionReason_SessionsLimit)
+	// users with MFA get a challenge instead of a session, the failed logins are only forgotten
+	// once the second factor is verified
+	challenge, err := s.newMfaChallenge(c, user, rememberMe)
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+	if challenge != nil {
+		return s.App.HttpResponseOK(c, challenge)
+	}
+	s.loginSucceeded(user.Id)
+
+	return s.passwordSession(c, user, rememberMe, nil)
+}
+
+// httpResponseLoginError responds to a failed password login, the wrong credentials count for
+// the lockout of the account
+func (s *HttpServer) httpResponseLoginError(c *fiber.Ctx, username string, user *model.User, err error) error {
+	switch err {
+	case errors.ErrInvalidCredentials:
+		var userId int32
+		if user != nil {
+			userId = user.Id
+		}
+		s.loginFailed(c, username, userId)
+		return s.App.HttpResponseUnauthorized(c, err)
+	case errors.ErrDirectoryAccount:
+		return s.App.HttpResponseForbidden(c, err)
+	default:
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+}
+
+// admitSession applies the sessions policy of the role to a new session of the user, it logs out
+// the sessions making room for it or returns ErrSessionsLimit
+func (s *HttpServer) admitSession(ctx context.Context, c *fiber.Ctx, user *model.User) error {
+	channel := utils.UserAgentParser(utils.GetUserAgent(c)).Channel
+	active, err := s.OAuth2.GetAllActiveSessionsCountByClientId(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+	// the impersonation sessions don't take the room of the user
+	sessions := make([]*oauth2.Config, 0, len(active))
+	for _, session := range active {
+		if session.ImpersonatorId == 0 {
+			sessions = append(sessions, session)
+		}
+	}
+	evict, ok := s.OAuth2.SessionPolicy(user.Role).Admit(sessions, channel, func(cfg *oauth2.Config) model.ChannelType {
+		return utils.UserAgentParser(cfg.UserAgent).Channel
+	})
+	if !ok {
+		return errors.ErrSessionsLimit
+	}
+
+	for _, session := range evict {
+		s.killClientSession(session, SessionDescionnectionReason_SessionsLimit)
 
 		// log the operation
 		s.queueSystemOperationLog(&model.OperationsLog{
-			Action:    "logout",
-			Resource:  "session",
-			UserId:    oldestSession.ClientId,
-			Method:    "DELETE",
-			URL:       c.OriginalURL(),
-			IpAddress: oldestSession.IpAddress,
-			UserAgent: c.Get("User-Agent"),
+			Action:     "logout",
+			Resource:   "session",
+			ResourceId: session.SessionId,
+			UserId:     session.ClientId,
+			Method:     "DELETE",
+			URL:        c.OriginalURL(),
+			IpAddress:  session.IpAddress,
+			UserAgent:  session.UserAgent,
 		})
 	}
 
+	return nil
+}
+
+// httpResponseAdmitError responds to a session the sessions policy didn't admit
+func (s *HttpServer) httpResponseAdmitError(c *fiber.Ctx, err error) error {
+	if err == errors.ErrSessionsLimit {
+		return s.App.HttpResponseForbidden(c, err)
+	}
+	return s.App.HttpResponseInternalServerErrorRequest(c, err)
+}
+
+// passwordSession starts a session of the authenticated user, recovery codes are only set when the
+// login confirmed the MFA enrollment
+func (s *HttpServer) passwordSession(c *fiber.Ctx, user *model.User, rememberMe bool, recoveryCodes []string) error {
+	ctxTimeout, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	// the sessions policy of the role makes room for the new session or rejects the login
+	err := s.admitSession(ctxTimeout, c, user)
+	if err != nil {
+		return s.httpResponseAdmitError(c, err)
+	}
+
 	// Simplified role handling for boilerplate
 	// Use the role field from User model directly
 	role := &model.Role{
@@ -138,21 +223,22 @@ func (s *HttpServer) Login(c *fiber.Ctx) error {
 		cfg.ExpiresIn = s.OAuth2.LongTokenExpiresIn
 	}
 
-	ctxTimeout, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
 	_, err = s.OAuth2.PasswordCredentialsToken(ctxTimeout, cfg)
 	if err != nil {
 		return s.App.HttpResponseInternalServerErrorRequest(c, fiber.ErrInternalServerError)
 	}
 
 	res := &LoginResponse{
-		UserId:       cfg.ClientId,
-		AccessToken:  cfg.AccessToken,
-		RefreshToken: cfg.RefreshToken,
-		SessionId:    cfg.SessionId,
-		ExpiresIn:    int32(cfg.ExpiresIn),
-		Scope:        role.Desc,
-		IpAddress:    cfg.IpAddress,
+		UserId:        cfg.ClientId,
+		AccessToken:   cfg.AccessToken,
+		RefreshToken:  cfg.RefreshToken,
+		SessionId:     cfg.SessionId,
+		ExpiresIn:     int32(cfg.ExpiresIn),
+		Scope:         role.Desc,
+		IpAddress:     cfg.IpAddress,
+		IdToken:       cfg.IdToken,
+		RecoveryCodes: recoveryCodes,
+		NewDevice:     s.recordDevice(c, user, cfg.SessionId),
 	}
 
 	// TODO: Implement event logging for login events
@@ -185,49 +271,68 @@ func (s *HttpServer) Login(c *fiber.Ctx) error {
 }
 
 //	@Id				Token
-//	@Description	Login using account client_id and client secret passed using basic auth method
+//	@Description	Get a token with the client credentials passed using basic auth method, the account credentials,
+//	@Description	or an authorization code (public clients send their client_id instead of basic auth)
 //	@Tags			Auth
 //	@Accept			json
 //	@Produce		json
 //	@Success		200	{object}	v1.LoginResponse
+//	@Success		200	{object}	v1.MfaChallengeResponse
+//	@Failure		403	{object}	http.HttpResponse
+//	@Failure		429	{object}	http.HttpResponse
 //	@Failure		500	{object}	http.HttpResponse
 //	@Security		BasicAuth
-//	@Param			grant_type	query	string	true	"either client_credentials or password"
+//	@Param			grant_type		query	string	true	"client_credentials, password or authorization_code"
+//	@Param			scope			query	string	false	"space separated scopes for client_credentials, all the client scopes by default"
+//	@Param			code			formData	string	false	"authorization code"
+//	@Param			redirect_uri	formData	string	false	"redirect uri the code was issued for"
+//	@Param			code_verifier	formData	string	false	"PKCE code verifier"
+//	@Param			client_id		formData	string	false	"client id of public clients"
 //	@Param			remember_me	query	boolean	false	"remember me"
 //	@Router			/auth/v1/oauth2/token [post]
 func (s *HttpServer) Token(c *fiber.Ctx) error {
-	username := c.Locals("username").(string)
-	password := c.Locals("password").(string)
+	// public clients exchanging an authorization code don't send basic auth
+	username, _ := c.Locals("username").(string)
+	password, _ := c.Locals("password").(string)
 
 	rememberMe := c.QueryBool("remember_me", false)
 
-	grantType := c.Query("grant_type", GRANT_TYPE_PASSWORD)
+	grantType := c.Query("grant_type", c.FormValue("grant_type", GRANT_TYPE_PASSWORD))
 	if grantType == "" {
 		return s.App.HttpResponseBadRequest(c, fmt.Errorf("grant_type %s", errors.RequiredField))
 	}
 
-	user := &model.User{}
-	query := s.DB
+	if grantType == GRANT_TYPE_AUTHORIZATION_CODE {
+		return s.authorizationCodeToken(c, username, password)
+	}
+	if username == "" {
+		return s.App.HttpResponseUnauthorized(c, errors.ErrMissingAuthoirzationHeader)
+	}
+
+	// registered clients authenticate with their client id and client secret
 	if grantType == GRANT_TYPE_CLIENT_CREDENTIALS {
-		query = query.Where("username = ?", username)
-	} else {
-		query = query.Where("id = ? OR username = ?", username, username)
+		return s.clientCredentialsToken(c, username, password)
 	}
-	err := query.First(user).Error
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return s.App.HttpResponseUnauthorized(c, fmt.Errorf("incorrect password or username"))
-		}
-		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	if grantType != GRANT_TYPE_PASSWORD {
+		return s.App.HttpResponseBadRequest(c, fmt.Errorf("unsupported grant_type %s", grantType))
 	}
 
-	var ok bool
-	if grantType == GRANT_TYPE_CLIENT_CREDENTIALS || grantType == GRANT_TYPE_PASSWORD {
-		// Simplified password check for boilerplate - just compare password hash
-		ok = oauth2.ComparePassword(user.PasswordHash, password)
+	// failed logins delay the next ones, too many lock the account or the client ip out
+	if s.loginLocked(c, oauth2.UserSubject(username)) {
+		return s.App.HttpResponseTooManyRequests(c, errors.ErrLoginLocked)
 	}
-	if !ok {
-		return s.App.HttpResponseUnauthorized(c, fmt.Errorf("incorrect username or password"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	// the authentication backends check the password, the database or the directory
+	user, err := s.OAuth2.Authenticate(ctx, username, password)
+	// an account is locked whatever name it's logged in with, the right password included
+	if user != nil && s.loginLocked(c, oauth2.AccountSubject(user.Id)) {
+		return s.App.HttpResponseTooManyRequests(c, errors.ErrLoginLocked)
+	}
+	if err != nil {
+		return s.httpResponseLoginError(c, username, user, err)
 	}
 
 	// check account is active
@@ -235,91 +340,85 @@ func (s *HttpServer) Token(c *fiber.Ctx) error {
 		return s.App.HttpResponseUnauthorized(c, fmt.Errorf("the account has been deactivated"))
 	}
 
-	// Simplified session management for boilerplate
-	// TODO: Implement proper multi-session management
-	oldestSession, count := s.OAuth2.GetActiveSessionsCountByClientId(user.Id)
-	
-	// Simple single session limit for boilerplate
-	if count >= 1 {
-		// kill the oldest session
-		s.killClientSession(oldestSession, SessionDescionnectionReason_SessionsLimit)
+	// users with MFA get a challenge instead of a session, the failed logins are only forgotten
+	// once the second factor is verified
+	challenge, err := s.newMfaChallenge(c, user, rememberMe)
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+	if challenge != nil {
+		return s.App.HttpResponseOK(c, challenge)
+	}
+	s.loginSucceeded(user.Id)
 
-		// log the operation
-		s.queueSystemOperationLog(&model.OperationsLog{
-			Action:    "logout",
-			Resource:  "session",
-			UserId:    oldestSession.ClientId,
-			Method:    "DELETE",
-			URL:       c.OriginalURL(),
-			IpAddress: oldestSession.IpAddress,
-			UserAgent: c.Get("User-Agent"),
-		})
+	return s.passwordSession(c, user, rememberMe, nil)
+}
+
+// clientCredentialsToken issues a token to a registered client, the token acts on behalf
+// of the client owner limited to the granted scopes
+func (s *HttpServer) clientCredentialsToken(c *fiber.Ctx, clientId, secret string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	client, err := s.OAuth2.AuthenticateClient(ctx, clientId, secret)
+	if err != nil {
+		if err == errors.ErrInvalidClient {
+			return s.App.HttpResponseUnauthorized(c, err)
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
 	}
 
-	// Simplified role handling for boilerplate
-	// Use the role field from User model directly
-	role := &model.Role{
-		Id:   1, // Default role ID
-		Desc: user.Role,
+	if !client.HasGrant(model.GrantType_ClientCredentials) {
+		return s.App.HttpResponseBadRequest(c, errors.ErrUnauthorizedGrant)
+	}
+
+	resources, err := oauth2.ParseScope(c.Query("scope"), client.Scopes)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	owner := &model.User{}
+	err = s.DB.Where("id = ? AND is_active = ?", client.OwnerId, true).First(owner).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return s.App.HttpResponseUnauthorized(c, fmt.Errorf("the client owner has been deactivated"))
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
 	}
 
 	cfg := &oauth2.Config{
-		ClientId:       user.Id,
-		ClientSecretId: "",
-		Scope:          role.Desc,
+		ClientId:       owner.Id,
+		ClientSecretId: client.ClientId,
+		Email:          owner.Email,
+		Scope:          owner.Role,
+		Resources:      resources,
 		IpAddress:      utils.GetRealIP(c),
-		ExpiresIn:      s.OAuth2.TokenExpiresIn,
 		UserAgent:      utils.GetUserAgent(c),
-		RememberMe:     rememberMe,
-	}
-	if rememberMe {
-		cfg.ExpiresIn = s.OAuth2.LongTokenExpiresIn
 	}
 
-	ctxTimeout, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
-	_, err = s.OAuth2.PasswordCredentialsToken(ctxTimeout, cfg)
+	_, err = s.OAuth2.ClientCredentialsToken(ctx, cfg)
 	if err != nil {
 		return s.App.HttpResponseInternalServerErrorRequest(c, fiber.ErrInternalServerError)
 	}
 
-	res := &LoginResponse{
-		UserId:       cfg.ClientId,
-		AccessToken:  cfg.AccessToken,
-		RefreshToken: cfg.RefreshToken,
-		SessionId:    cfg.SessionId,
-		ExpiresIn:    int32(cfg.ExpiresIn),
-		Scope:        role.Desc,
-		IpAddress:    cfg.IpAddress,
-	}
-
-	// TODO: Implement event logging for login events
-	// sessionData, _ := json.Marshal(map[string]interface{}{
-	// 	"id":         cfg.Id,
-	// 	"user_id":    user.Id,
-	// 	"started_at": time.Now(),
-	// 	"client_id":  cfg.ClientId,
-	// 	"session_id": cfg.SessionId,
-	// 	"full_name":  user.FirstName + " " + user.LastName,
-	// 	"ip_address": cfg.IpAddress,
-	// })
-	// TODO: Implement WebSocket publishing for online sessions
-	// err = s.PublishWS(subject, event)
-	// if err != nil {
-	// 	s.Log.Logger.Errorf("error publishing to %s", subject)
-	// }
-
 	s.queueSystemOperationLog(&model.OperationsLog{
-		Action:    "login",
-		Resource:  "session",
-		UserId:    cfg.ClientId,
-		Method:    "POST",
-		URL:       c.OriginalURL(),
-		IpAddress: cfg.IpAddress,
-		UserAgent: c.Get("User-Agent"),
+		Action:     "client_token",
+		Resource:   "oauth_client",
+		ResourceId: fmt.Sprint(client.Id),
+		UserId:     cfg.ClientId,
+		Method:     "POST",
+		URL:        c.OriginalURL(),
+		IpAddress:  cfg.IpAddress,
+		UserAgent:  c.Get("User-Agent"),
 	})
 
-	return s.App.HttpResponseOK(c, res)
+	return s.App.HttpResponseOK(c, &LoginResponse{
+		UserId:      cfg.ClientId,
+		AccessToken: cfg.AccessToken,
+		ExpiresIn:   int32(cfg.ExpiresIn),
+		Scope:       strings.Join(resources, " "),
+		IpAddress:   cfg.IpAddress,
+	})
 }
 
 type RefreshTokenBody struct {
@@ -327,11 +426,12 @@ type RefreshTokenBody struct {
 }
 
 //	@Id				RefreshToken
-//	@Description	Refresh account's Token
+//	@Description	Refresh account's Token, the refresh token is rotated and using a rotated one again revokes the session
 //	@Tags			Auth
 //	@Accept			json
 //	@Produce		json
 //	@Success		200		{object}	model.Token
+//	@Failure		401		{object}	http.HttpResponse
 //	@Failure		500		{object}	http.HttpResponse
 //	@Param			body	body		v1.RefreshTokenBody	true	"Refresh Token Request body"
 //	@Router			/auth/v1/oauth2/refresh/token [post]
@@ -353,9 +453,16 @@ func (s *HttpServer) RefreshToken(c *fiber.Ctx) error {
 	ctx := context.Background()
 	cfg, err := s.OAuth2.RefreshToken(ctx, ipAddr, useragent, body.RefreshToken)
 	if err != nil {
+		if err == errors.ErrRefreshTokenReused {
+			s.refreshTokenReused(c, cfg)
+			return s.App.HttpResponseUnauthorized(c, err)
+		}
 		if err == redis.Nil {
 			return s.App.HttpResponseUnauthorized(c, errors.ErrInvalidToken)
 		}
+		if err == errors.ErrUnauthorizedGrant {
+			return s.App.HttpResponseBadRequest(c, err)
+		}
 		return s.App.HttpResponseInternalServerErrorRequest(c, err)
 	}
 
@@ -367,11 +474,38 @@ func (s *HttpServer) RefreshToken(c *fiber.Ctx) error {
 		SessionId:    cfg.SessionId,
 		Scope:        cfg.Scope,
 		IpAddress:    cfg.IpAddress,
+		IdToken:      cfg.IdToken,
 	}
 
 	return s.App.HttpResponseOK(c, res)
 }
 
+// refreshTokenReused disconnects the revoked session and reports the reuse, either the
+// legitimate client or an attacker holds a stolen refresh token
+func (s *HttpServer) refreshTokenReused(c *fiber.Ctx, cfg *oauth2.Config) {
+	s.disconnectWs(cfg.SessionId, cfg.ClientId, nil)
+
+	ipAddr := utils.GetRealIP(c)
+	s.queueSystemOperationLog(&model.OperationsLog{
+		Action:     "refresh_token_reused",
+		Resource:   "session",
+		ResourceId: cfg.SessionId,
+		UserId:     cfg.ClientId,
+		Method:     c.Method(),
+		URL:        c.OriginalURL(),
+		IpAddress:  ipAddr,
+		UserAgent:  c.Get("User-Agent"),
+		SessionId:  cfg.SessionId,
+	})
+
+	s.emitSecurityEvent(model.EventType_RefreshTokenReused, cfg.ClientId, cfg.SessionId, ipAddr, map[string]interface{}{
+		"session_id": cfg.SessionId,
+		"client_id":  cfg.ClientSecretId,
+		"ip_address": ipAddr,
+		"user_agent": utils.GetUserAgent(c),
+	})
+}
+
 //	@Id				Logout
 //	@Description	Logout
 //	@Tags			Auth
@@ -396,10 +530,7 @@ func (s *HttpServer) Logout(c *fiber.Ctx) error {
 	}
 
 	// logout from the websocket if there is a connection
-	err = s.Hub.Delete(cfg.SessionId)
-	if err != nil {
-		s.Log.Logger.Error(err)
-	}
+	s.disconnectWs(cfg.SessionId, cfg.ClientId, nil)
 
 	// TODO: Implement client disconnection publishing
 	// s.publishClientDisconnected(cfg)
@@ -412,22 +543,12 @@ func (s *HttpServer) Logout(c *fiber.Ctx) error {
 		URL:       c.OriginalURL(),
 		IpAddress: cfg.IpAddress,
 		UserAgent: c.Get("User-Agent"),
+		SessionId: cfg.SessionId,
 	})
 
 	return s.App.HttpResponseNoContent(c)
 }
 
-func (s *HttpServer) checkIfMutlipleSessionsAvailable(groupId int32) (bool, error) {
-	gc := &model.ConfigGroup{}
-	err := s.DB.Where("group_id = ?", groupId).First(gc).Error
-	if err != nil {
-		return false, err
-	}
-
-	// Simplified for boilerplate - always return false (single session only)
-	return false, nil
-}
-
 type SessionDescionnectionReason int32
 
 const (
@@ -435,34 +556,21 @@ const (
 	SessionDescionnectionReason_SessionKilled SessionDescionnectionReason = 1
 )
 
+var SessionDescionnectionReason_name = map[SessionDescionnectionReason]string{
+	SessionDescionnectionReason_SessionsLimit: "sessions_limit",
+	SessionDescionnectionReason_SessionKilled: "session_killed",
+}
+
 // Kill Client Session
 func (s *HttpServer) killClientSession(cfg *oauth2.Config, reason SessionDescionnectionReason) error {
-	// remove from
-
-	// publish to the client that your session has been killed or limit reached and you will be logged out
-	// TODO: Implement client disconnection with reason
-	// s.publishClientDisconnectedWithReason(cfg, reason)
-
-	// TODO: Implement broker disconnection publishing
-	// s.publishClientDisconnected(cfg)
-
 	// delete the oldest session
 	err := s.OAuth2.Logout(context.Background(), cfg.AccessToken, cfg.SessionId)
 	if err != nil {
 		s.Log.Logger.Error(err)
-		err = nil
 	}
 
-	// wait for the client to receive the message then logout anyway
-	time.AfterFunc(time.Second*5, func() {
-		s.Log.Logger.Infof("killClientSession: %s", cfg.SessionId)
-
-		// logout from the websocket if there is a connection
-		err = s.Hub.Delete(cfg.SessionId)
-		if err != nil {
-			s.Log.Logger.Error(err)
-		}
-	})
+	// the client is told why before its websocket is closed, wherever it's connected
+	s.disconnectWs(cfg.SessionId, cfg.ClientId, &reason)
 
 	return nil
 }
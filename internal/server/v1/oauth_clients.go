@@ -0,0 +1,348 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Admin API for the OAuth client registry
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/errors"
+	"greenlync-api-gateway/pkg/oauth2"
+	"greenlync-api-gateway/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type CrtOAuthClient struct {
+	Name         string   `json:"name" validate:"required,max=100" example:"billing-service"`
+	Grants       []string `json:"grants" validate:"required,min=1,dive,oneof=client_credentials authorization_code refresh_token" example:"client_credentials"`
+	Scopes       []string `json:"scopes" validate:"dive,required" example:"usage_read"`
+	RedirectUris []string `json:"redirect_uris" validate:"dive,url" example:"https://app.example.com/callback"`
+	OwnerId      int32    `json:"owner_id" validate:"required"`
+	IsPublic     bool     `json:"is_public"`
+	IsFirstParty bool     `json:"is_first_party"`
+	IsActive     bool     `json:"is_active"`
+}
+
+// OAuthClientCreated is returned once when the client is created or its secret is
+// rotated, the secret itself can't be read again
+type OAuthClientCreated struct {
+	*model.OAuthClient
+	ClientSecret string `json:"client_secret"`
+}
+
+// @Id				GetAllOAuthClients
+// @Description	Get All OAuth Clients
+// @Tags			System
+// @Accept			json
+// @Produce		json
+// @Success		200	{array}		model.OAuthClient
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Router			/api/v1/system/clients [get]
+func (s *HttpServer) GetAllOAuthClients(c *fiber.Ctx) error {
+	clients := []*model.OAuthClient{}
+	err := s.DB.Order("id").Find(&clients).Error
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	return s.App.HttpResponseOK(c, clients)
+}
+
+// @Id				GetOAuthClient
+// @Description	Get OAuth Client
+// @Tags			System
+// @Accept			json
+// @Produce		json
+// @Success		200	{object}	model.OAuthClient
+// @Failure		404	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			client_id	path	int	true	"Client ID"
+// @Router			/api/v1/system/clients/{client_id} [get]
+func (s *HttpServer) GetOAuthClient(c *fiber.Ctx) error {
+	client, err := s.getOAuthClient(c)
+	if err != nil {
+		return s.httpResponseOAuthClientError(c, err)
+	}
+
+	return s.App.HttpResponseOK(c, client)
+}
+
+// @Id				CreateOAuthClient
+// @Description	Register an OAuth client, the client secret is only returned in this response.
+// @Description	The scopes are Casbin resources that must be granted to the owner's role
+// @Tags			System
+// @Accept			json
+// @Produce		json
+// @Success		201	{object}	v1.OAuthClientCreated
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			body	body	v1.CrtOAuthClient	true	"OAuth Client Request Body"
+// @Router			/api/v1/system/clients [post]
+func (s *HttpServer) CreateOAuthClient(c *fiber.Ctx) error {
+	data := &CrtOAuthClient{}
+	err := c.BodyParser(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	err = s.validateOAuthClient(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	clientId, secret, err := oauth2.GenerateClientCredentials()
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	secretHash, err := oauth2.EncryptPassword(secret)
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	client := &model.OAuthClient{
+		ClientId:     clientId,
+		SecretHash:   secretHash,
+		Name:         data.Name,
+		Grants:       data.Grants,
+		Scopes:       data.Scopes,
+		RedirectUris: data.RedirectUris,
+		OwnerId:      data.OwnerId,
+		IsPublic:     data.IsPublic,
+		IsFirstParty: data.IsFirstParty,
+		IsActive:     data.IsActive,
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(client).Error
+		if err != nil {
+			return err
+		}
+		// is_active defaults to true in the database so the zero value isn't inserted
+		if !data.IsActive {
+			return tx.Model(client).Update("is_active", false).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	s.queueOAuthClientOperationLog(c, "create_client", client)
+
+	return s.App.HttpResponseCreated(c, &OAuthClientCreated{OAuthClient: client, ClientSecret: secret})
+}
+
+// @Id				UpdateOAuthClient
+// @Description	Update OAuth Client, the issued tokens are revoked when the client is deactivated or its scopes change
+// @Tags			System
+// @Accept			json
+// @Produce		json
+// @Success		200	{object}	model.OAuthClient
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		404	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			client_id	path	int					true	"Client ID"
+// @Param			body		body	v1.CrtOAuthClient	true	"OAuth Client Request Body"
+// @Router			/api/v1/system/clients/{client_id} [put]
+func (s *HttpServer) UpdateOAuthClient(c *fiber.Ctx) error {
+	client, err := s.getOAuthClient(c)
+	if err != nil {
+		return s.httpResponseOAuthClientError(c, err)
+	}
+
+	data := &CrtOAuthClient{}
+	err = c.BodyParser(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	err = s.validateOAuthClient(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	revoke := !data.IsActive || data.OwnerId != client.OwnerId || !slices.Equal(data.Scopes, client.Scopes) || data.IsFirstParty != client.IsFirstParty
+
+	client.Name = data.Name
+	client.Grants = data.Grants
+	client.Scopes = data.Scopes
+	client.RedirectUris = data.RedirectUris
+	client.OwnerId = data.OwnerId
+	client.IsPublic = data.IsPublic
+	client.IsFirstParty = data.IsFirstParty
+	client.IsActive = data.IsActive
+
+	err = s.DB.Save(client).Error
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	if revoke {
+		err = s.OAuth2.RevokeClientTokens(context.Background(), client.ClientId)
+		if err != nil {
+			return s.App.HttpResponseInternalServerErrorRequest(c, err)
+		}
+	}
+
+	s.queueOAuthClientOperationLog(c, "update_client", client)
+
+	return s.App.HttpResponseOK(c, client)
+}
+
+// @Id				RotateOAuthClientSecret
+// @Description	Generate a new secret for the OAuth client, the old secret and its tokens stop working
+// @Tags			System
+// @Accept			json
+// @Produce		json
+// @Success		200	{object}	v1.OAuthClientCreated
+// @Failure		404	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			client_id	path	int	true	"Client ID"
+// @Router			/api/v1/system/clients/{client_id}/secret [post]
+func (s *HttpServer) RotateOAuthClientSecret(c *fiber.Ctx) error {
+	client, err := s.getOAuthClient(c)
+	if err != nil {
+		return s.httpResponseOAuthClientError(c, err)
+	}
+
+	_, secret, err := oauth2.GenerateClientCredentials()
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	client.SecretHash, err = oauth2.EncryptPassword(secret)
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	err = s.DB.Save(client).Error
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	err = s.OAuth2.RevokeClientTokens(context.Background(), client.ClientId)
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	s.queueOAuthClientOperationLog(c, "rotate_client_secret", client)
+
+	return s.App.HttpResponseOK(c, &OAuthClientCreated{OAuthClient: client, ClientSecret: secret})
+}
+
+// @Id				DeleteOAuthClient
+// @Description	Delete OAuth Client and revoke its tokens
+// @Tags			System
+// @Accept			json
+// @Produce		json
+// @Success		204
+// @Failure		404	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			client_id	path	int	true	"Client ID"
+// @Router			/api/v1/system/clients/{client_id} [DELETE]
+func (s *HttpServer) DeleteOAuthClient(c *fiber.Ctx) error {
+	client, err := s.getOAuthClient(c)
+	if err != nil {
+		return s.httpResponseOAuthClientError(c, err)
+	}
+
+	err = s.DB.Delete(client).Error
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	err = s.OAuth2.RevokeClientTokens(context.Background(), client.ClientId)
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	s.queueOAuthClientOperationLog(c, "delete_client", client)
+
+	return s.App.HttpResponseNoContent(c)
+}
+
+// getOAuthClient loads the client of the client_id param, the returned error is the response
+func (s *HttpServer) getOAuthClient(c *fiber.Ctx) (*model.OAuthClient, error) {
+	id, err := c.ParamsInt("client_id")
+	if err != nil {
+		return nil, errors.ErrInvalidID
+	}
+
+	client := &model.OAuthClient{}
+	err = s.DB.First(client, id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// httpResponseOAuthClientError responds with the error returned by getOAuthClient
+func (s *HttpServer) httpResponseOAuthClientError(c *fiber.Ctx, err error) error {
+	switch err {
+	case errors.ErrInvalidID:
+		return s.App.HttpResponseBadRequest(c, err)
+	case gorm.ErrRecordNotFound:
+		return s.App.HttpResponseNotFound(c, err)
+	default:
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+}
+
+func (s *HttpServer) validateOAuthClient(data *CrtOAuthClient) error {
+	err := s.Validate.Struct(data)
+	if err != nil {
+		return utils.ValidatorMessage(err)
+	}
+
+	if slices.Contains(data.Grants, model.GrantType_AuthorizationCode) && len(data.RedirectUris) == 0 {
+		return fmt.Errorf("redirect_uris are required for the authorization_code grant")
+	}
+
+	// a public client can't keep its secret, so it can only act for a signed in user
+	if data.IsPublic && slices.Contains(data.Grants, model.GrantType_ClientCredentials) {
+		return fmt.Errorf("public clients can't use the client_credentials grant")
+	}
+
+	owner := &model.User{}
+	err = s.DB.First(owner, data.OwnerId).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return fmt.Errorf("owner %d doesn't exist", data.OwnerId)
+		}
+		return err
+	}
+
+	return s.validateResources(owner.Role, data.Scopes)
+}
+
+func (s *HttpServer) queueOAuthClientOperationLog(c *fiber.Ctx, action string, client *model.OAuthClient) {
+	cfg, ok := utils.GetClient(c)
+	if !ok {
+		return
+	}
+
+	s.queueSystemOperationLog(&model.OperationsLog{
+		Action:     action,
+		Resource:   "oauth_client",
+		ResourceId: fmt.Sprint(client.Id),
+		UserId:     cfg.ClientId,
+		Method:     c.Method(),
+		URL:        c.OriginalURL(),
+		IpAddress:  utils.GetRealIP(c),
+		UserAgent:  c.Get("User-Agent"),
+		SessionId:  cfg.SessionId,
+	})
+}
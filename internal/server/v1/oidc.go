@@ -0,0 +1,162 @@
+// Developer: zeelrupapara@gmail.com
+// Description: OpenID Connect discovery, JWKS, userinfo and signing key management
+
+package v1
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/errors"
+	"greenlync-api-gateway/pkg/oauth2"
+	"greenlync-api-gateway/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// OpenIDConfiguration is the OpenID Connect discovery document
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JwksUri                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IdTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// @Id				OpenIDConfiguration
+// @Description	OpenID Connect discovery document
+// @Tags			Auth
+// @Produce		json
+// @Success		200	{object}	v1.OpenIDConfiguration
+// @Router			/.well-known/openid-configuration [get]
+func (s *HttpServer) OpenIDConfiguration(c *fiber.Ctx) error {
+	issuer := strings.TrimRight(s.OAuth2.Issuer, "/")
+
+	return c.JSON(&OpenIDConfiguration{
+		Issuer:                            s.OAuth2.Issuer,
+		AuthorizationEndpoint:             issuer + "/auth/v1/oauth2/authorize",
+		TokenEndpoint:                     issuer + "/auth/v1/oauth2/token",
+		UserinfoEndpoint:                  issuer + "/auth/v1/oauth2/userinfo",
+		JwksUri:                           issuer + "/auth/v1/oauth2/jwks",
+		ResponseTypesSupported:            []string{"code"},
+		SubjectTypesSupported:             []string{"public"},
+		IdTokenSigningAlgValuesSupported:  []string{s.Cfg.OIDC.SigningAlg},
+		GrantTypesSupported:               []string{model.GrantType_Password, model.GrantType_AuthorizationCode, model.GrantType_RefreshToken, model.GrantType_ClientCredentials},
+		CodeChallengeMethodsSupported:     []string{oauth2.CodeChallengeMethodS256},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "none"},
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "sid", "name", "given_name", "family_name", "preferred_username", "email", "phone_number", "role"},
+	})
+}
+
+// @Id				JWKS
+// @Description	Public keys verifying the tokens signed by the gateway, including the keys about to sign and the retired ones whose tokens didn't expire yet
+// @Tags			Auth
+// @Produce		json
+// @Success		200	{object}	oauth2.JWKS
+// @Failure		503	{object}	http.HttpResponse
+// @Router			/auth/v1/oauth2/jwks [get]
+func (s *HttpServer) JWKS(c *fiber.Ctx) error {
+	if s.OAuth2.Keys == nil {
+		return s.App.HttpResponseServiceUnavailable(c, errors.ErrSigningKeysUnavailable)
+	}
+
+	// a new key is published KeyPublishDelay before it signs, caching for less keeps relying parties in sync
+	c.Set(fiber.HeaderCacheControl, fmt.Sprintf("public, max-age=%d", int(oauth2.KeyPublishDelay.Seconds())))
+	return c.JSON(s.OAuth2.Keys.JWKS())
+}
+
+// @Id				UserInfo
+// @Description	OpenID Connect claims of the signed in user
+// @Tags			Auth
+// @Produce		json
+// @Success		200	{object}	oauth2.UserInfo
+// @Failure		401	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Router			/auth/v1/oauth2/userinfo [get]
+func (s *HttpServer) UserInfo(c *fiber.Ctx) error {
+	cfg, ok := utils.GetClient(c)
+	if !ok {
+		return s.App.HttpResponseInternalServerErrorRequest(c, errors.ErrCouldNotParseClientCfg)
+	}
+
+	user := &model.User{}
+	err := s.DB.Where("id = ? AND is_active = ?", cfg.ClientId, true).First(user).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return s.App.HttpResponseUnauthorized(c, fmt.Errorf("the account has been deactivated"))
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	return c.JSON(&oauth2.UserInfo{
+		Subject: strconv.Itoa(int(user.Id)),
+		Profile: oauth2.NewProfile(user),
+	})
+}
+
+// @Id				GetSigningKeys
+// @Description	Get the published token signing keys, the newest first
+// @Tags			System
+// @Produce		json
+// @Success		200	{array}		model.SigningKey
+// @Failure		503	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Router			/api/v1/system/keys [get]
+func (s *HttpServer) GetSigningKeys(c *fiber.Ctx) error {
+	if s.OAuth2.Keys == nil {
+		return s.App.HttpResponseServiceUnavailable(c, errors.ErrSigningKeysUnavailable)
+	}
+
+	return s.App.HttpResponseOK(c, s.OAuth2.Keys.Keys())
+}
+
+// @Id				RotateSigningKey
+// @Description	Publish a new signing key ahead of the scheduled rotation, it starts signing after the publish delay
+// @Description	and the current key stays published until the tokens it signed expire
+// @Tags			System
+// @Produce		json
+// @Success		200	{array}		model.SigningKey
+// @Failure		500	{object}	http.HttpResponse
+// @Failure		503	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Router			/api/v1/system/keys/rotate [post]
+func (s *HttpServer) RotateSigningKey(c *fiber.Ctx) error {
+	if s.OAuth2.Keys == nil {
+		return s.App.HttpResponseServiceUnavailable(c, errors.ErrSigningKeysUnavailable)
+	}
+
+	err := s.OAuth2.Keys.Rotate()
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	keys := s.OAuth2.Keys.Keys()
+
+	cfg, ok := utils.GetClient(c)
+	if ok {
+		s.queueSystemOperationLog(&model.OperationsLog{
+			Action:     "rotate_signing_key",
+			Resource:   "signing_key",
+			ResourceId: keys[0].Kid,
+			UserId:     cfg.ClientId,
+			Method:     c.Method(),
+			URL:        c.OriginalURL(),
+			IpAddress:  utils.GetRealIP(c),
+			UserAgent:  c.Get("User-Agent"),
+			SessionId:  cfg.SessionId,
+		})
+	}
+
+	return s.App.HttpResponseOK(c, keys)
+}
@@ -170,6 +170,8 @@ func (s *HttpServer) writeSystemOperationsLogs() {
 		// unmarshel data
 		operation = <-s.operationCh
 
+		s.stampImpersonator(operation)
+
 		// create record
 		err := s.DB.Create(operation).Error
 		if err != nil {
@@ -191,3 +193,21 @@ func (s *HttpServer) writeSystemOperationsLogs() {
 		// Simple operation logging completed
 	}
 }
+
+// stampImpersonator records the admin behind an operation done in an impersonation session
+func (s *HttpServer) stampImpersonator(operation *model.OperationsLog) {
+	if operation.SessionId == "" || operation.ImpersonatorId != 0 {
+		return
+	}
+
+	// the session row outlives the session so the operations of its logout are stamped too
+	session := &model.Session{}
+	err := s.DB.Select("impersonator_id").Where("session_id = ?", operation.SessionId).Take(session).Error
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			s.Log.Logger.Errorf("error getting the session of operation %s of userId %d: %v", operation.Action, operation.UserId, err)
+		}
+		return
+	}
+	operation.ImpersonatorId = session.ImpersonatorId
+}
@@ -0,0 +1,312 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Self-service password reset by email and password change of the current user
+
+package v1
+
+import (
+	"context"
+	stderrors "errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/errors"
+	"greenlync-api-gateway/pkg/oauth2"
+	"greenlync-api-gateway/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type ForgotPassword struct {
+	Email string `json:"email" validate:"required,email" example:"user@greenlync.com"`
+}
+
+type ResetPassword struct {
+	Code string `json:"code" validate:"required"`
+	// checked against the password policy
+	Password string `json:"password" validate:"required"`
+}
+
+type ChangePassword struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,nefield=CurrentPassword"`
+}
+
+// setPassword stores the new password of the user and logs out every session of the user except
+// the kept one, the websocket connections of those sessions are closed as well. The password
+// should be validated by ValidatePassword first
+func (s *HttpServer) setPassword(ctx context.Context, user *model.User, password, keepSessionId string) error {
+	hash, err := oauth2.EncryptPassword(password)
+	if err != nil {
+		return err
+	}
+
+	err = s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(user).Update("password_hash", hash).Error
+		if err != nil {
+			return err
+		}
+		return s.OAuth2.RecordPassword(tx, user.Id, hash)
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.logoutUser(ctx, user.Id, keepSessionId)
+}
+
+// httpResponsePasswordError responds to an error of ValidatePassword, the weak passwords are
+// refused with the rule they break
+func (s *HttpServer) httpResponsePasswordError(c *fiber.Ctx, err error) error {
+	if stderrors.Is(err, errors.ErrWeakPassword) {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+	return s.App.HttpResponseInternalServerErrorRequest(c, err)
+}
+
+// logoutUser logs every session of the user out except the kept one and closes their websocket connections,
+// the cached API keys of the user are dropped too so they're checked again against the user
+func (s *HttpServer) logoutUser(ctx context.Context, userId int32, keepSessionId string) error {
+	sessionIds, err := s.OAuth2.LogoutUser(ctx, userId, keepSessionId)
+	for _, sessionId := range sessionIds {
+		s.disconnectWs(sessionId, userId, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.OAuth2.ForgetUserApiKeys(ctx, userId)
+}
+
+// @Id				ForgotPassword
+// @Description	Send a password reset code to the email of the account, the response doesn't tell whether the account exists
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Success		200
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		429	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Param			body	body	v1.ForgotPassword	true	"Forgot Password Request Body"
+// @Router			/auth/v1/password/forgot [post]
+func (s *HttpServer) ForgotPassword(c *fiber.Ctx) error {
+	data := &ForgotPassword{}
+	err := c.BodyParser(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	err = s.Validate.Struct(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, utils.ValidatorMessage(err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	// throttled per address whether the account exists or not
+	wait, err := s.OAuth2.ThrottlePasswordReset(ctx, data.Email)
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+	if wait > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		return s.App.HttpResponseTooManyRequests(c, errors.ErrTooManyRequests)
+	}
+
+	user := &model.User{}
+	err = s.DB.Where("email = ?", strings.TrimSpace(data.Email)).First(user).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return s.App.HttpResponseOK(c, nil)
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+	// the directory users reset their password in the directory
+	if !user.IsActive || user.AuthSource != model.AuthSource_Local {
+		return s.App.HttpResponseOK(c, nil)
+	}
+
+	code, err := s.OAuth2.NewPasswordReset(ctx, user.Id)
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	accountName := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if accountName == "" {
+		accountName = user.Username
+	}
+
+	// a failed email answers like an unknown address, it would tell the account exists
+	err = s.Smtp.SendVerifyChangePasswordEmail(user, user.Email, accountName, code, time.Duration(oauth2.PasswordResetTTL)*time.Second)
+	if err != nil {
+		s.Log.Logger.Errorf("error sending the password reset email of user %d: %v", user.Id, err)
+		return s.App.HttpResponseOK(c, nil)
+	}
+
+	s.queueSystemOperationLog(&model.OperationsLog{
+		Action:    "forgot_password",
+		Resource:  "user",
+		UserId:    user.Id,
+		Method:    c.Method(),
+		URL:       c.OriginalURL(),
+		IpAddress: utils.GetRealIP(c),
+		UserAgent: c.Get("User-Agent"),
+	})
+
+	return s.App.HttpResponseOK(c, nil)
+}
+
+// @Id				ResetPassword
+// @Description	Set a new password with the code sent by email, every session of the account is logged out
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Success		200
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Param			body	body	v1.ResetPassword	true	"Reset Password Request Body"
+// @Router			/auth/v1/password/reset [post]
+func (s *HttpServer) ResetPassword(c *fiber.Ctx) error {
+	data := &ResetPassword{}
+	err := c.BodyParser(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	err = s.Validate.Struct(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, utils.ValidatorMessage(err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	code := strings.TrimSpace(data.Code)
+
+	// the code is only used once the new password is accepted
+	userId, err := s.OAuth2.PasswordResetUser(ctx, code)
+	if err != nil {
+		if err == errors.ErrInvalidResetCode {
+			return s.App.HttpResponseBadRequest(c, err)
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	err = s.OAuth2.ValidatePassword(ctx, userId, data.Password)
+	if err != nil {
+		return s.httpResponsePasswordError(c, err)
+	}
+
+	userId, err = s.OAuth2.ConsumePasswordReset(ctx, code)
+	if err != nil {
+		if err == errors.ErrInvalidResetCode {
+			return s.App.HttpResponseBadRequest(c, err)
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	user := &model.User{}
+	err = s.DB.First(user, userId).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return s.App.HttpResponseBadRequest(c, errors.ErrInvalidResetCode)
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	err = s.setPassword(ctx, user, data.Password, "")
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	// the owner of the account proved it, the failed logins of the guesser don't lock them out
+	err = s.OAuth2.Logins.Unlock(ctx, oauth2.AccountSubject(user.Id))
+	if err != nil {
+		s.Log.Logger.Errorf("error unlocking %s: %v", user.Username, err)
+	}
+
+	s.queueSystemOperationLog(&model.OperationsLog{
+		Action:    "reset_password",
+		Resource:  "user",
+		UserId:    user.Id,
+		Method:    c.Method(),
+		URL:       c.OriginalURL(),
+		IpAddress: utils.GetRealIP(c),
+		UserAgent: c.Get("User-Agent"),
+	})
+
+	return s.App.HttpResponseOK(c, nil)
+}
+
+// @Id				ChangeMyPassword
+// @Description	Change the password of the current user, the other sessions of the user are logged out
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Success		200
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			body	body	v1.ChangePassword	true	"Change Password Request Body"
+// @Router			/api/v1/me/password [put]
+func (s *HttpServer) ChangeMyPassword(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c)
+	if !ok {
+		return s.App.HttpResponseInternalServerErrorRequest(c, errors.ErrCouldNotParseClientCfg)
+	}
+
+	data := &ChangePassword{}
+	err := c.BodyParser(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	err = s.Validate.Struct(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, utils.ValidatorMessage(err))
+	}
+
+	user := &model.User{}
+	err = s.DB.First(user, client.ClientId).Error
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	if user.AuthSource != model.AuthSource_Local {
+		return s.App.HttpResponseBadRequest(c, errors.ErrExternalAccount)
+	}
+
+	if !oauth2.ComparePassword(user.PasswordHash, data.CurrentPassword) {
+		return s.App.HttpResponseBadRequest(c, errors.ErrIncorrectPassword)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	err = s.OAuth2.ValidatePassword(ctx, user.Id, data.NewPassword)
+	if err != nil {
+		return s.httpResponsePasswordError(c, err)
+	}
+
+	err = s.setPassword(ctx, user, data.NewPassword, client.SessionId)
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	s.queueSystemOperationLog(&model.OperationsLog{
+		Action:    "change_password",
+		Resource:  "user",
+		UserId:    user.Id,
+		Method:    c.Method(),
+		URL:       c.OriginalURL(),
+		IpAddress: utils.GetRealIP(c),
+		UserAgent: c.Get("User-Agent"),
+		SessionId: client.SessionId,
+	})
+
+	return s.App.HttpResponseOK(c, nil)
+}
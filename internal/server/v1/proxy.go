@@ -0,0 +1,104 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Reverse proxy routes forwarding /api/v1/<service>/* to upstream services
+
+package v1
+
+import (
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/errors"
+	"greenlync-api-gateway/pkg/http"
+	"greenlync-api-gateway/pkg/proxy"
+	"greenlync-api-gateway/utils"
+
+	"github.com/goccy/go-json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// MatchProxyRoute looks up the live routing table, requests that don't belong
+// to any upstream route end here with not found
+func (s *HttpServer) MatchProxyRoute(c *fiber.Ctx) error {
+	route, ok := s.Proxy.Match(c.Path())
+	if !ok {
+		s.Log.Logger.Error(errors.EndpointNotFound)
+		return s.App.HttpResponseNotFound(c, errors.ErrEndpointNotFound)
+	}
+
+	c.Locals(http.LocalsRoute, route)
+	return c.Next()
+}
+
+// AuthorizeProxyRoute enforces the casbin resource the matched route requires
+func (s *HttpServer) AuthorizeProxyRoute(c *fiber.Ctx) error {
+	// upstream deletions are destructive whatever the resource of the route
+	if client, ok := utils.GetClient(c); ok && client.ImpersonatorId != 0 && c.Method() == fiber.MethodDelete {
+		return s.App.HttpResponseForbidden(c, errors.ErrImpersonationRestricted)
+	}
+
+	route := c.Locals(http.LocalsRoute).(*proxy.Route)
+	if route.Resource == "" {
+		return s.Middleware.Quota(c)
+	}
+
+	return s.Middleware.Authorization(route.Resource)(c)
+}
+
+// RateLimitProxyRoute enforces the ratelimit.route.<name> limit of the matched route
+func (s *HttpServer) RateLimitProxyRoute(c *fiber.Ctx) error {
+	route := c.Locals(http.LocalsRoute).(*proxy.Route)
+	return s.Middleware.RateLimitRoute(route.Name)(c)
+}
+
+// ForwardProxyRoute forwards the request to the matched route upstream
+func (s *HttpServer) ForwardProxyRoute(c *fiber.Ctx) error {
+	route := c.Locals(http.LocalsRoute).(*proxy.Route)
+
+	client, _ := utils.GetClient(c)
+	err := s.Proxy.Forward(c, route, client)
+	if err != nil {
+		s.Log.Logger.Errorf("proxy route %s: %v", route.Name, err)
+		if err == fasthttp.ErrTimeout {
+			return s.App.HttpResponseGatewayTimeout(c, errors.ErrUpstreamTimeout)
+		}
+		if err == proxy.ErrCircuitOpen {
+			return s.App.HttpResponseServiceUnavailable(c, errors.ErrUpstreamCircuitOpen)
+		}
+		return s.App.HttpResponseBadGateway(c, errors.ErrUpstreamUnavailable)
+	}
+
+	return nil
+}
+
+// publishCircuitAlert records a system alert event for every upstream circuit transition
+func (s *HttpServer) publishCircuitAlert(upstream string, from, to proxy.CircuitState) {
+	data, _ := json.Marshal(map[string]interface{}{
+		"upstream": upstream,
+		"from":     from.String(),
+		"to":       to.String(),
+	})
+
+	event := &model.Event{
+		Type:    model.EventType_SystemAlert,
+		UserId:  0, // System event
+		Subject: "upstream_circuit",
+		Data:    string(data),
+		Payload: string(data),
+		Format:  "json",
+	}
+
+	// the circuit changes on a proxied request, it must not wait for the database
+	select {
+	case s.alertCh <- event:
+	default:
+		s.Log.Logger.Errorf("dropping circuit alert for %s, the alerts queue is full", upstream)
+	}
+}
+
+func (s *HttpServer) writeSystemAlerts() {
+	for event := range s.alertCh {
+		err := s.DB.Create(event).Error
+		if err != nil {
+			s.Log.Logger.Errorf("error saving %s alert: %v", event.Subject, err)
+		}
+	}
+}
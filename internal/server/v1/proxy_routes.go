@@ -0,0 +1,372 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Admin API managing the proxy routing table at runtime
+
+package v1
+
+import (
+	"fmt"
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/errors"
+	"greenlync-api-gateway/pkg/nats"
+	"greenlync-api-gateway/pkg/proxy"
+	"greenlync-api-gateway/utils"
+
+	"github.com/gofiber/fiber/v2"
+	natsio "github.com/nats-io/nats.go"
+	"gorm.io/gorm"
+)
+
+type CrtProxyRoute struct {
+	Name        string                  `json:"name" validate:"required" example:"orders"`
+	Prefix      string                  `json:"prefix" validate:"required" example:"/api/v1/orders"`
+	Upstreams   []string                `json:"upstreams" validate:"required,min=1"`
+	StripPrefix bool                    `json:"strip_prefix"`
+	Timeout     int                     `json:"timeout" validate:"gte=0"`
+	Resource    string                  `json:"resource" example:"orders_read"`
+	Strategy    string                  `json:"strategy" validate:"omitempty,oneof=round_robin least_connections weighted" example:"round_robin"`
+	Weights     []int                   `json:"weights"`
+	HealthCheck *model.ProxyHealthCheck `json:"health_check"`
+
+	CircuitBreaker *model.ProxyCircuitBreaker `json:"circuit_breaker"`
+	Retry          *model.ProxyRetryPolicy    `json:"retry"`
+	IsActive       bool                       `json:"is_active"`
+}
+
+// @Id				GetAllProxyRoutes
+// @Description	Get All Proxy Routes
+// @Tags			System
+// @Accept			json
+// @Produce		json
+// @Success		200	{array}		model.ProxyRoute
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Router			/api/v1/system/routes [get]
+func (s *HttpServer) GetAllProxyRoutes(c *fiber.Ctx) error {
+	routes := []*model.ProxyRoute{}
+	err := s.DB.Order("id").Find(&routes).Error
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	return s.App.HttpResponseOK(c, routes)
+}
+
+// @Id				GetProxyRoute
+// @Description	Get Proxy Route
+// @Tags			System
+// @Accept			json
+// @Produce		json
+// @Success		200	{object}	model.ProxyRoute
+// @Failure		404	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			route_id	path	int	true	"Route ID"
+// @Router			/api/v1/system/routes/{route_id} [get]
+func (s *HttpServer) GetProxyRoute(c *fiber.Ctx) error {
+	routeId, err := c.ParamsInt("route_id")
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, errors.ErrInvalidID)
+	}
+
+	route := &model.ProxyRoute{}
+	err = s.DB.First(route, routeId).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return s.App.HttpResponseNotFound(c, err)
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	return s.App.HttpResponseOK(c, route)
+}
+
+// @Id				CreateProxyRoute
+// @Description	Create Proxy Route, the routing table is reloaded on every gateway replica
+// @Tags			System
+// @Accept			json
+// @Produce		json
+// @Success		201	{object}	model.ProxyRoute
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			body	body	v1.CrtProxyRoute	true	"Proxy Route Request Body"
+// @Router			/api/v1/system/routes [post]
+func (s *HttpServer) CreateProxyRoute(c *fiber.Ctx) error {
+	data := &CrtProxyRoute{}
+	err := c.BodyParser(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	err = s.Validate.Struct(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, utils.ValidatorMessage(err))
+	}
+
+	route := &model.ProxyRoute{
+		Name:        data.Name,
+		Prefix:      data.Prefix,
+		Upstreams:   data.Upstreams,
+		StripPrefix: data.StripPrefix,
+		Timeout:     data.Timeout,
+		Resource:    data.Resource,
+		Strategy:    data.Strategy,
+		Weights:     data.Weights,
+		HealthCheck: data.HealthCheck,
+
+		CircuitBreaker: data.CircuitBreaker,
+		Retry:          data.Retry,
+		IsActive:       data.IsActive,
+	}
+
+	tx := s.DB.Begin()
+	err = tx.Create(route).Error
+	if err != nil {
+		tx.Rollback()
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	err = s.validateProxyRoutes(tx)
+	if err != nil {
+		tx.Rollback()
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	tx.Commit()
+
+	s.broadcastProxyRoutes()
+
+	s.queueProxyRouteOperationLog(c, "create_route", route)
+
+	return s.App.HttpResponseCreated(c, route)
+}
+
+// @Id				UpdateProxyRoute
+// @Description	Update Proxy Route, set is_active to false to disable it
+// @Tags			System
+// @Accept			json
+// @Produce		json
+// @Success		200	{object}	model.ProxyRoute
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		404	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			route_id	path	int					true	"Route ID"
+// @Param			body		body	v1.CrtProxyRoute	true	"Proxy Route Request Body"
+// @Router			/api/v1/system/routes/{route_id} [put]
+func (s *HttpServer) UpdateProxyRoute(c *fiber.Ctx) error {
+	routeId, err := c.ParamsInt("route_id")
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, errors.ErrInvalidID)
+	}
+
+	data := &CrtProxyRoute{}
+	err = c.BodyParser(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	err = s.Validate.Struct(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, utils.ValidatorMessage(err))
+	}
+
+	route := &model.ProxyRoute{}
+	err = s.DB.First(route, routeId).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return s.App.HttpResponseNotFound(c, err)
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	route.Name = data.Name
+	route.Prefix = data.Prefix
+	route.Upstreams = data.Upstreams
+	route.StripPrefix = data.StripPrefix
+	route.Timeout = data.Timeout
+	route.Resource = data.Resource
+	route.Strategy = data.Strategy
+	route.Weights = data.Weights
+	route.HealthCheck = data.HealthCheck
+	route.CircuitBreaker = data.CircuitBreaker
+	route.Retry = data.Retry
+	route.IsActive = data.IsActive
+
+	tx := s.DB.Begin()
+	err = tx.Save(route).Error
+	if err != nil {
+		tx.Rollback()
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	err = s.validateProxyRoutes(tx)
+	if err != nil {
+		tx.Rollback()
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	tx.Commit()
+
+	s.broadcastProxyRoutes()
+
+	s.queueProxyRouteOperationLog(c, "update_route", route)
+
+	return s.App.HttpResponseOK(c, route)
+}
+
+// @Id				DeleteProxyRoute
+// @Description	Delete Proxy Route
+// @Tags			System
+// @Accept			json
+// @Produce		json
+// @Success		204
+// @Failure		404	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			route_id	path	int	true	"Route ID"
+// @Router			/api/v1/system/routes/{route_id} [DELETE]
+func (s *HttpServer) DeleteProxyRoute(c *fiber.Ctx) error {
+	routeId, err := c.ParamsInt("route_id")
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, errors.ErrInvalidID)
+	}
+
+	route := &model.ProxyRoute{}
+	err = s.DB.First(route, routeId).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return s.App.HttpResponseNotFound(c, err)
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	err = s.DB.Delete(route).Error
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	s.broadcastProxyRoutes()
+
+	s.queueProxyRouteOperationLog(c, "delete_route", route)
+
+	return s.App.HttpResponseNoContent(c)
+}
+
+// get the active proxy routes stored in the db
+func (s *HttpServer) getActiveProxyRoutes(db *gorm.DB) ([]*proxy.Route, error) {
+	records := []*model.ProxyRoute{}
+	err := db.Where("is_active = ?", true).Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+
+	routes := make([]*proxy.Route, 0, len(records))
+	for _, r := range records {
+		route := &proxy.Route{
+			Name:        r.Name,
+			Prefix:      r.Prefix,
+			Upstreams:   r.Upstreams,
+			StripPrefix: r.StripPrefix,
+			Timeout:     r.Timeout,
+			Resource:    r.Resource,
+			Strategy:    r.Strategy,
+			Weights:     r.Weights,
+		}
+		if r.HealthCheck != nil {
+			route.HealthCheck = &proxy.HealthCheck{
+				Path:               r.HealthCheck.Path,
+				Interval:           r.HealthCheck.Interval,
+				Timeout:            r.HealthCheck.Timeout,
+				HealthyThreshold:   r.HealthCheck.HealthyThreshold,
+				UnhealthyThreshold: r.HealthCheck.UnhealthyThreshold,
+			}
+		}
+		if r.CircuitBreaker != nil {
+			route.CircuitBreaker = &proxy.CircuitBreaker{
+				Window:           r.CircuitBreaker.Window,
+				MinRequests:      r.CircuitBreaker.MinRequests,
+				ErrorRate:        r.CircuitBreaker.ErrorRate,
+				LatencyThreshold: r.CircuitBreaker.LatencyThreshold,
+				OpenDuration:     r.CircuitBreaker.OpenDuration,
+				HalfOpenRequests: r.CircuitBreaker.HalfOpenRequests,
+			}
+		}
+		if r.Retry != nil {
+			route.Retry = &proxy.RetryPolicy{
+				Attempts:   r.Retry.Attempts,
+				BaseDelay:  r.Retry.BaseDelay,
+				MaxDelay:   r.Retry.MaxDelay,
+				Budget:     r.Retry.Budget,
+				MinRetries: r.Retry.MinRetries,
+			}
+		}
+		routes = append(routes, route)
+	}
+
+	return routes, nil
+}
+
+// check the routes inside the transaction would still build a valid routing table
+func (s *HttpServer) validateProxyRoutes(tx *gorm.DB) error {
+	routes, err := s.getActiveProxyRoutes(tx)
+	if err != nil {
+		return err
+	}
+
+	return s.Proxy.Validate(routes)
+}
+
+// reload the live routing table from the db
+func (s *HttpServer) reloadProxyRoutes() error {
+	return s.Proxy.Reload(func() ([]*proxy.Route, error) {
+		return s.getActiveProxyRoutes(s.DB)
+	})
+}
+
+// reload locally then tell the other gateway replicas to reload the same table
+func (s *HttpServer) broadcastProxyRoutes() {
+	err := s.reloadProxyRoutes()
+	if err != nil {
+		s.Log.Logger.Errorf("error reloading proxy routes: %v", err)
+	}
+
+	err = s.Nats.NC.Publish(nats.SubjectProxyRoutesReload, nil)
+	if err != nil {
+		s.Log.Logger.Errorf("error publishing to %s: %v", nats.SubjectProxyRoutesReload, err)
+	}
+}
+
+// every replica reloads its routing table whenever a route changes on any of them
+func (s *HttpServer) subscribeProxyRoutes() error {
+	_, err := s.Nats.NC.Subscribe(nats.SubjectProxyRoutesReload, func(msg *natsio.Msg) {
+		err := s.reloadProxyRoutes()
+		if err != nil {
+			s.Log.Logger.Errorf("error reloading proxy routes: %v", err)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't subscribe to %s: %w", nats.SubjectProxyRoutesReload, err)
+	}
+
+	return nil
+}
+
+func (s *HttpServer) queueProxyRouteOperationLog(c *fiber.Ctx, action string, route *model.ProxyRoute) {
+	cfg, ok := utils.GetClient(c)
+	if !ok {
+		return
+	}
+
+	s.queueSystemOperationLog(&model.OperationsLog{
+		Action:     action,
+		Resource:   "route",
+		ResourceId: fmt.Sprint(route.Id),
+		UserId:     cfg.ClientId,
+		Method:     c.Method(),
+		URL:        c.OriginalURL(),
+		IpAddress:  cfg.IpAddress,
+		UserAgent:  c.Get("User-Agent"),
+		SessionId:  cfg.SessionId,
+	})
+}
@@ -0,0 +1,346 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Public self-service registration, accounts are activated by an email verification link
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/authz"
+	"greenlync-api-gateway/pkg/errors"
+	"greenlync-api-gateway/pkg/oauth2"
+	"greenlync-api-gateway/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type Register struct {
+	Username string `json:"username" validate:"required,min=3,max=50" example:"alice"`
+	Email    string `json:"email" validate:"required,email,max=191" example:"alice@greenlync.com"`
+	// checked against the password policy
+	Password  string `json:"password" validate:"required"`
+	FirstName string `json:"first_name" validate:"max=100"`
+	LastName  string `json:"last_name" validate:"max=100"`
+}
+
+type ResendVerification struct {
+	Email string `json:"email" validate:"required,email" example:"alice@greenlync.com"`
+}
+
+// ValidateRegistration checks the role given to the signed up accounts is one of the system roles
+// and isn't the admin role, anyone can sign up
+func (s *HttpServer) ValidateRegistration() error {
+	role := s.Cfg.Registration.DefaultRole
+	if strings.EqualFold(role, authz.Roles_Admin) {
+		return fmt.Errorf("the registration default role can't be %s", role)
+	}
+
+	var count int64
+	err := s.DB.Model(&model.Role{}).Where("`desc` = ?", role).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("the registration default role %s: %w", role, errors.ErrRoleNotFound)
+	}
+
+	return nil
+}
+
+// sendEmailVerification emails a new verification link to the user, the previous link stops working
+func (s *HttpServer) sendEmailVerification(ctx context.Context, user *model.User) error {
+	expiresIn := time.Duration(s.Cfg.Registration.VerificationExpiresIn) * time.Second
+
+	token, err := s.OAuth2.NewEmailVerification(ctx, user.Id, expiresIn)
+	if err != nil {
+		return err
+	}
+
+	verifyURL := strings.TrimSuffix(s.Cfg.HTTP.BaseUrl, "/") + "/api/v1/public/verify-email?token=" + url.QueryEscape(token)
+
+	accountName := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if accountName == "" {
+		accountName = user.Username
+	}
+
+	return s.Smtp.SendVerifyEmail(user, user.Email, accountName, verifyURL, expiresIn)
+}
+
+// @Id				Register
+// @Description	Sign up with the default role, the account stays inactive until the email is verified by the link sent to it.
+// @Description	The response doesn't tell whether the email already has an account, its owner is told by email instead
+// @Tags			Registration
+// @Accept			json
+// @Produce		json
+// @Success		201
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		403	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Param			body	body	v1.Register	true	"Register Request Body"
+// @Router			/api/v1/public/register [post]
+func (s *HttpServer) Register(c *fiber.Ctx) error {
+	if !s.Cfg.Registration.Enabled {
+		return s.App.HttpResponseForbidden(c, errors.ErrRegistrationDisabled)
+	}
+
+	data := &Register{}
+	err := c.BodyParser(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	data.Username = strings.TrimSpace(data.Username)
+	data.Email = strings.TrimSpace(data.Email)
+	err = s.Validate.Struct(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, utils.ValidatorMessage(err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	// the password is checked and hashed whether the email has an account or not so both answer alike
+	err = s.OAuth2.ValidatePassword(ctx, 0, data.Password)
+	if err != nil {
+		return s.httpResponsePasswordError(c, err)
+	}
+
+	hash, err := oauth2.EncryptPassword(data.Password)
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	existing := &model.User{}
+	err = s.DB.Where("email = ?", data.Email).First(existing).Error
+	if err == nil {
+		s.sendAccountExists(ctx, existing)
+		return s.App.HttpResponseCreated(c, nil)
+	}
+	if err != gorm.ErrRecordNotFound {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	var count int64
+	err = s.DB.Model(&model.User{}).Where("username = ?", data.Username).Count(&count).Error
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+	if count > 0 {
+		return s.App.HttpResponseBadRequest(c, errors.ErrAccountAlreadyExists)
+	}
+
+	user := &model.User{
+		Username:     data.Username,
+		Email:        data.Email,
+		FirstName:    data.FirstName,
+		LastName:     data.LastName,
+		PasswordHash: hash,
+		Role:         s.Cfg.Registration.DefaultRole,
+		Registered:   true,
+		AuthSource:   model.AuthSource_Local,
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(user).Error
+		if err != nil {
+			return err
+		}
+		// is_active defaults to true in the database so the zero value isn't inserted
+		user.IsActive = false
+		err = tx.Model(user).Update("is_active", false).Error
+		if err != nil {
+			return err
+		}
+		return s.OAuth2.RecordPassword(tx, user.Id, hash)
+	})
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	// the first email counts for the resend throttling
+	_, err = s.OAuth2.ThrottleEmailVerification(ctx, user.Email, time.Duration(s.Cfg.Registration.ResendInterval)*time.Second)
+	if err != nil {
+		s.Log.Logger.Errorf("error throttling the verification emails of %s: %v", user.Email, err)
+	}
+
+	// a failed email answers like a taken email, the link can be sent again
+	err = s.sendEmailVerification(ctx, user)
+	if err != nil {
+		s.Log.Logger.Errorf("error sending the verification email of user %d: %v", user.Id, err)
+	}
+
+	s.queueSystemOperationLog(&model.OperationsLog{
+		Action:     "register",
+		Resource:   "user",
+		ResourceId: strconv.Itoa(int(user.Id)),
+		UserId:     user.Id,
+		Method:     c.Method(),
+		URL:        c.OriginalURL(),
+		IpAddress:  utils.GetRealIP(c),
+		UserAgent:  c.Get("User-Agent"),
+	})
+
+	s.emitUserEvent(model.EventType_UserRegistered, user.Id, "", utils.GetRealIP(c), map[string]interface{}{
+		"username": user.Username,
+		"email":    user.Email,
+		"role":     user.Role,
+	})
+
+	return s.App.HttpResponseCreated(c, nil)
+}
+
+// sendAccountExists tells the owner of the email someone tried to sign up with it, the emails share
+// the throttling of the verification emails
+func (s *HttpServer) sendAccountExists(ctx context.Context, user *model.User) {
+	wait, err := s.OAuth2.ThrottleEmailVerification(ctx, user.Email, time.Duration(s.Cfg.Registration.ResendInterval)*time.Second)
+	if err != nil {
+		s.Log.Logger.Errorf("error throttling the verification emails of %s: %v", user.Email, err)
+		return
+	}
+	if wait > 0 {
+		return
+	}
+
+	accountName := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if accountName == "" {
+		accountName = user.Username
+	}
+
+	err = s.Smtp.SendAccountExistsEmail(user, user.Email, accountName)
+	if err != nil {
+		s.Log.Logger.Errorf("error sending the account exists email of user %d: %v", user.Id, err)
+	}
+}
+
+// @Id				VerifyEmail
+// @Description	Verify the email of a registered account with the token of the link sent to it, the account is activated
+// @Tags			Registration
+// @Accept			json
+// @Produce		json
+// @Success		200
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Param			token	query	string	true	"email verification token"
+// @Router			/api/v1/public/verify-email [get]
+func (s *HttpServer) VerifyEmail(c *fiber.Ctx) error {
+	token := strings.TrimSpace(c.Query("token"))
+	if token == "" {
+		return s.App.HttpResponseBadRequest(c, errors.ErrInvalidVerificationToken)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	userId, err := s.OAuth2.ConsumeEmailVerification(ctx, token)
+	if err != nil {
+		if err == errors.ErrInvalidVerificationToken {
+			return s.App.HttpResponseBadRequest(c, err)
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	// only a pending registration is activated, an account deactivated after its verification stays so
+	result := s.DB.Model(&model.User{}).
+		Where("id = ? AND registered = ? AND email_verified_at IS NULL", userId, true).
+		Updates(map[string]interface{}{"is_active": true, "email_verified_at": time.Now()})
+	if result.Error != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return s.App.HttpResponseBadRequest(c, errors.ErrInvalidVerificationToken)
+	}
+
+	s.queueSystemOperationLog(&model.OperationsLog{
+		Action:     "verify_email",
+		Resource:   "user",
+		ResourceId: strconv.Itoa(int(userId)),
+		UserId:     userId,
+		Method:     c.Method(),
+		URL:        c.Path(),
+		IpAddress:  utils.GetRealIP(c),
+		UserAgent:  c.Get("User-Agent"),
+	})
+
+	return s.App.HttpResponseOK(c, nil)
+}
+
+// @Id				ResendVerification
+// @Description	Send a new verification link to the email of a pending account, the response doesn't tell whether the account exists
+// @Tags			Registration
+// @Accept			json
+// @Produce		json
+// @Success		200
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		403	{object}	http.HttpResponse
+// @Failure		429	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Param			body	body	v1.ResendVerification	true	"Resend Verification Request Body"
+// @Router			/api/v1/public/resend-verification [post]
+func (s *HttpServer) ResendVerification(c *fiber.Ctx) error {
+	if !s.Cfg.Registration.Enabled {
+		return s.App.HttpResponseForbidden(c, errors.ErrRegistrationDisabled)
+	}
+
+	data := &ResendVerification{}
+	err := c.BodyParser(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	data.Email = strings.TrimSpace(data.Email)
+	err = s.Validate.Struct(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, utils.ValidatorMessage(err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	// throttled per address whether the account exists or not
+	wait, err := s.OAuth2.ThrottleEmailVerification(ctx, data.Email, time.Duration(s.Cfg.Registration.ResendInterval)*time.Second)
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+	if wait > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		return s.App.HttpResponseTooManyRequests(c, errors.ErrTooManyRequests)
+	}
+
+	user := &model.User{}
+	err = s.DB.Where("email = ?", data.Email).First(user).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return s.App.HttpResponseOK(c, nil)
+		}
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+	// only the pending registrations get a link, not the accounts created or deactivated by an admin
+	if !user.Registered || user.EmailVerifiedAt != nil {
+		return s.App.HttpResponseOK(c, nil)
+	}
+
+	err = s.sendEmailVerification(ctx, user)
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	s.queueSystemOperationLog(&model.OperationsLog{
+		Action:    "resend_verification",
+		Resource:  "user",
+		UserId:    user.Id,
+		Method:    c.Method(),
+		URL:       c.OriginalURL(),
+		IpAddress: utils.GetRealIP(c),
+		UserAgent: c.Get("User-Agent"),
+	})
+
+	return s.App.HttpResponseOK(c, nil)
+}
@@ -22,9 +22,10 @@ func (s *HttpServer) RegisterV1() {
 	api := root.Group("/api")
 	ws := root.Group("/ws/v1")
 	oauth := root.Group("/auth/v1/oauth2")
+	password := root.Group("/auth/v1/password")
 	v1 := api.Group("/v1")
 	system := v1.Group("/system")
-	_ = v1.Group("/public")
+	public := v1.Group("/public")
 
 	//************************ Global Middlewares *******************************
 	root.Use(cors.New())
@@ -37,19 +38,42 @@ func (s *HttpServer) RegisterV1() {
 	jaegerMiddleware := jaeger.NewJaegerMiddleware("greenlync-api-gateway")
 	root.Use(jaegerMiddleware)
 
-	api.Use(s.Middleware.UserAgentParser, s.Middleware.HeaderReader, s.Middleware.RequestsLogger)
-	ws.Use(s.Middleware.UserAgentParser, s.Middleware.HeaderReader, s.Middleware.RequestsLogger)
-	oauth.Use(s.Middleware.UserAgentParser, s.Middleware.HeaderReader, s.Middleware.RequestsLogger)
+	api.Use(s.Middleware.UserAgentParser, s.Middleware.HeaderReader, s.Middleware.RequestsLogger, s.Middleware.RateLimit, s.Middleware.Usage)
+	ws.Use(s.Middleware.UserAgentParser, s.Middleware.HeaderReader, s.Middleware.RequestsLogger, s.Middleware.RateLimit)
+	oauth.Use(s.Middleware.UserAgentParser, s.Middleware.HeaderReader, s.Middleware.RequestsLogger, s.Middleware.RateLimit)
+	password.Use(s.Middleware.UserAgentParser, s.Middleware.HeaderReader, s.Middleware.RequestsLogger, s.Middleware.RateLimit)
 
 	ws.Use(s.Middleware.Protect)
 	system.Use(s.Middleware.Protect)
 
 	//************************ AUTH Routes *******************************
 	oauth.Post("/login", s.Middleware.BasicAuthParser, s.Login)
-	oauth.Post("/token", s.Middleware.BasicAuthParser, s.Token)
+	oauth.Post("/token", s.Middleware.OptionalBasicAuthParser, s.Token)
+	oauth.Get("/authorize", s.Middleware.Protect, s.GetAuthorize)
+	oauth.Post("/authorize", s.Middleware.Protect, s.Authorize)
 	oauth.Post("/refresh/token", s.RefreshToken)
+	oauth.Post("/introspect", s.Middleware.BasicAuthParser, s.Introspect)
+	oauth.Post("/revoke", s.Middleware.BasicAuthParser, s.Revoke)
 	oauth.Delete("/logout", s.Middleware.Protect, s.Logout)
 
+	// MFA, second login step
+	oauth.Post("/mfa/enroll", s.EnrollMfaChallenge)
+	oauth.Post("/mfa/verify", s.VerifyMfa)
+
+	// Password reset
+	password.Post("/forgot", s.ForgotPassword)
+	password.Post("/reset", s.ResetPassword)
+
+	// Public registration
+	public.Post("/register", s.Register)
+	public.Get("/verify-email", s.VerifyEmail)
+	public.Post("/resend-verification", s.ResendVerification)
+
+	// OpenID Connect
+	root.Get("/.well-known/openid-configuration", s.OpenIDConfiguration)
+	oauth.Get("/jwks", s.JWKS)
+	oauth.Get("/userinfo", s.Middleware.Protect, s.UserInfo)
+
 	//************************ Websocket *****************************
 	ws.Get("/", websocket.New(s.serveWS))
 
@@ -100,15 +124,59 @@ func (s *HttpServer) RegisterV1() {
 	// operationRoutes.Delete("/:operation_id", s.Middleware.Authorization(authz.Resources_OperationLogs_Delete), s.DeleteOperation)
 	// operationRoutes.Delete("/", s.Middleware.Authorization(authz.Resources_OperationLogs_Delete), s.DeleteAllOperations)
 
+	// Proxy Routes
+	routeRoutes := system.Group("/routes")
+	routeRoutes.Get("/", s.Middleware.Authorization(authz.Resources_Routes_Read), s.GetAllProxyRoutes)
+	routeRoutes.Get("/:route_id", s.Middleware.Authorization(authz.Resources_Routes_Read), s.GetProxyRoute)
+	routeRoutes.Post("/", s.Middleware.Authorization(authz.Resources_Routes_Manage), s.CreateProxyRoute)
+	routeRoutes.Put("/:route_id", s.Middleware.Authorization(authz.Resources_Routes_Manage), s.UpdateProxyRoute)
+	routeRoutes.Delete("/:route_id", s.Middleware.Authorization(authz.Resources_Routes_Manage), s.DeleteProxyRoute)
+
+	// Usage
+	usageRoutes := system.Group("/usage")
+	usageRoutes.Get("/", s.Middleware.Authorization(authz.Resources_Usage_Read), s.GetUsage)
+
+	// OAuth Clients
+	clientRoutes := system.Group("/clients")
+	clientRoutes.Get("/", s.Middleware.Authorization(authz.Resources_Clients_Read), s.GetAllOAuthClients)
+	clientRoutes.Get("/:client_id", s.Middleware.Authorization(authz.Resources_Clients_Read), s.GetOAuthClient)
+	clientRoutes.Post("/", s.Middleware.Authorization(authz.Resources_Clients_Manage), s.CreateOAuthClient)
+	clientRoutes.Put("/:client_id", s.Middleware.Authorization(authz.Resources_Clients_Manage), s.UpdateOAuthClient)
+	clientRoutes.Post("/:client_id/secret", s.Middleware.Authorization(authz.Resources_Clients_Manage), s.RotateOAuthClientSecret)
+	clientRoutes.Delete("/:client_id", s.Middleware.Authorization(authz.Resources_Clients_Manage), s.DeleteOAuthClient)
+
+	// Users
+	userRoutes := system.Group("/users")
+	userRoutes.Get("/", s.Middleware.Authorization(authz.Resources_Users_Read), s.GetAllUsers)
+	userRoutes.Get("/:user_id", s.Middleware.Authorization(authz.Resources_Users_Read), s.GetUser)
+	userRoutes.Post("/", s.Middleware.Authorization(authz.Resources_Users_Create), s.CreateUser)
+	userRoutes.Put("/:user_id", s.Middleware.Authorization(authz.Resources_Users_Update), s.UpdateUser)
+	userRoutes.Post("/:user_id/deactivate", s.Middleware.Authorization(authz.Resources_Users_Update), s.DeactivateUser)
+	userRoutes.Delete("/:user_id", s.Middleware.Authorization(authz.Resources_Users_Delete), s.DeleteUser)
+	userRoutes.Post("/:user_id/impersonate", s.Middleware.Authorization(authz.Resources_Users_Impersonate), s.ImpersonateUser)
+
+	// Failed logins lockouts
+	lockoutRoutes := system.Group("/lockouts")
+	lockoutRoutes.Get("/", s.Middleware.Authorization(authz.Resources_Users_Read), s.GetAllLockouts)
+	lockoutRoutes.Delete("/", s.Middleware.Authorization(authz.Resources_Users_Update), s.Unlock)
+
+	// Signing Keys
+	keyRoutes := system.Group("/keys")
+	keyRoutes.Get("/", s.Middleware.Authorization(authz.Resources_Keys_Read), s.GetSigningKeys)
+	keyRoutes.Post("/rotate", s.Middleware.Authorization(authz.Resources_Keys_Manage), s.RotateSigningKey)
+
 	//************************ Business Routes *****************************
 
 	// Core business functionality routes
 	configRoutes := v1.Group("/configs")
 	emailRoutes := v1.Group("/emails")
+	myUsageRoutes := v1.Group("/usage")
+	meRoutes := v1.Group("/me")
 
 	// System Configs
 	configRoutes.Use(s.Middleware.Protect)
 	configRoutes.Get("/", s.Middleware.Authorization(authz.Resources_Config_Read), s.GetAllConfigs)
+	configRoutes.Post("/", s.Middleware.Authorization(authz.Resources_Config_Update), s.CreateConfig)
 	configRoutes.Get("/:config_id", s.Middleware.Authorization(authz.Resources_Config_Read), s.GetConfig)
 	configRoutes.Patch("/:config_id", s.Middleware.Authorization(authz.Resources_Config_Update), s.UpdateConfig)
 	configRoutes.Get("/groups/:group_id", s.Middleware.Authorization(authz.Resources_Config_Read), s.GetConfigsBelongToGroup)
@@ -126,6 +194,45 @@ func (s *HttpServer) RegisterV1() {
 	emailRoutes.Get("/me/bin", s.Middleware.Authorization(authz.Resources_MyEmails_Read), s.GetAccountBinEmails)
 	emailRoutes.Get("/me/:tracking_id", s.Middleware.Authorization(authz.Resources_MyEmails_Read), s.GetAccountInEmail)
 
+	// Usage
+	myUsageRoutes.Use(s.Middleware.Protect)
+	myUsageRoutes.Get("/me", s.Middleware.Authorization(authz.Resources_MyUsage_Read), s.GetMyUsage)
+
+	// API Keys
+	meRoutes.Use(s.Middleware.Protect)
+	meRoutes.Get("/api-keys", s.Middleware.Authorization(authz.Resources_MyApiKeys_Read), s.GetMyApiKeys)
+	meRoutes.Post("/api-keys", s.Middleware.Authorization(authz.Resources_MyApiKeys_Manage), s.CreateMyApiKey)
+	meRoutes.Delete("/api-keys/:api_key_id", s.Middleware.Authorization(authz.Resources_MyApiKeys_Manage), s.RevokeMyApiKey)
+
+	// Profile
+	meRoutes.Get("/", s.Middleware.Authorization(authz.Resources_MyProfile_Read), s.GetMyProfile)
+	meRoutes.Put("/", s.Middleware.Authorization(authz.Resources_MyProfile_Update), s.UpdateMyProfile)
+
+	// Sessions
+	meRoutes.Get("/sessions", s.Middleware.Authorization(authz.Resources_MySessions_Read), s.GetMySessions)
+	meRoutes.Delete("/sessions/:id", s.Middleware.Authorization(authz.Resources_MySessions_Delete), s.RevokeMySession)
+
+	// Password
+	meRoutes.Put("/password", s.Middleware.Authorization(authz.Resources_MyProfile_ChangePassword), s.ChangeMyPassword)
+
+	// MFA
+	meRoutes.Get("/mfa", s.Middleware.Authorization(authz.Resources_MyMfa_Read), s.GetMyMfa)
+	meRoutes.Post("/mfa", s.Middleware.Authorization(authz.Resources_MyMfa_Manage), s.EnrollMyMfa)
+	meRoutes.Post("/mfa/confirm", s.Middleware.Authorization(authz.Resources_MyMfa_Manage), s.ConfirmMyMfa)
+	meRoutes.Post("/mfa/recovery-codes", s.Middleware.Authorization(authz.Resources_MyMfa_Manage), s.RegenerateMyRecoveryCodes)
+	meRoutes.Delete("/mfa", s.Middleware.Authorization(authz.Resources_MyMfa_Manage), s.DisableMyMfa)
+
+	// Known devices
+	meRoutes.Get("/devices", s.Middleware.Authorization(authz.Resources_MyDevices_Read), s.GetMyDevices)
+	meRoutes.Put("/devices/:device_id", s.Middleware.Authorization(authz.Resources_MyDevices_Manage), s.UpdateMyDevice)
+	meRoutes.Delete("/devices/:device_id", s.Middleware.Authorization(authz.Resources_MyDevices_Manage), s.DeleteMyDevice)
+
+	//************************ Upstream Routes *****************************
+
+	// anything under /api/v1 that isn't served by the gateway itself is matched against
+	// the proxy routing table, authenticated, authorized and forwarded to the upstream
+	v1.All("/*", s.MatchProxyRoute, s.Middleware.Protect, s.AuthorizeProxyRoute, s.RateLimitProxyRoute, s.ForwardProxyRoute)
+
 	// in case no API route was found
 	api.All("*", func(c *fiber.Ctx) error {
 		s.Log.Logger.Error(errors.EndpointNotFound)
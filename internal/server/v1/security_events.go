@@ -0,0 +1,55 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Security and user events, stored for the audit trail and published on NATS for alerting
+
+package v1
+
+import (
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/nats"
+
+	"github.com/goccy/go-json"
+)
+
+// emitSecurityEvent stores the event and publishes it on the security events subject, failures are
+// only logged since the request that raised the event was handled already
+func (s *HttpServer) emitSecurityEvent(eventType model.EventType, userId int32, sessionId, ipAddress string, details interface{}) {
+	s.emitEvent(nats.SubjectSecurityEvents, eventType, userId, sessionId, ipAddress, details)
+}
+
+// emitUserEvent stores the event and publishes it on the user events subject
+func (s *HttpServer) emitUserEvent(eventType model.EventType, userId int32, sessionId, ipAddress string, details interface{}) {
+	s.emitEvent(nats.SubjectUserEvents, eventType, userId, sessionId, ipAddress, details)
+}
+
+func (s *HttpServer) emitEvent(subject string, eventType model.EventType, userId int32, sessionId, ipAddress string, details interface{}) {
+	data, err := json.Marshal(details)
+	if err != nil {
+		s.Log.Logger.Errorf("error encoding %s event: %v", model.GetEventTypeName(eventType), err)
+		return
+	}
+
+	event := &model.Event{
+		Type:      eventType,
+		UserId:    userId,
+		Subject:   subject,
+		Data:      string(data),
+		Payload:   string(data),
+		Format:    "json",
+		SessionId: sessionId,
+		IpAddress: ipAddress,
+	}
+
+	err = s.DB.Create(event).Error
+	if err != nil {
+		s.Log.Logger.Errorf("error storing %s event of user %d: %v", model.GetEventTypeName(eventType), userId, err)
+	}
+
+	js, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	err = s.Nats.NC.Publish(subject, js)
+	if err != nil {
+		s.Log.Logger.Errorf("error publishing %s event of user %d: %v", model.GetEventTypeName(eventType), userId, err)
+	}
+}
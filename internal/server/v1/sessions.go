@@ -3,6 +3,7 @@
 package v1
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -69,7 +70,13 @@ func (s *HttpServer) DeleteSession(c *fiber.Ctx) error {
 		return s.App.HttpResponseBadQueryParams(c, fmt.Errorf("empty id"))
 	}
 
-	cfg, ok := s.OAuth2.GetActiveSessionById(id)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	cfg, ok, err := s.OAuth2.GetActiveSessionById(ctx, id)
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
 	if !ok {
 		return s.App.HttpResponseBadRequest(c, fmt.Errorf("the id you provide doesn't exist or wrong"))
 	}
@@ -89,9 +96,19 @@ func (s *HttpServer) DeleteSession(c *fiber.Ctx) error {
 // @Security		BearerAuth
 // @Router			/api/v1/system/sessions/active [DELETE]
 func (s *HttpServer) DeleteAllSessions(c *fiber.Ctx) error {
-	sessions := s.OAuth2.GetActiveSessions()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	sessions, err := s.OAuth2.GetActiveSessions(ctx)
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
 	s.OAuth2.LogoutAll()
 	s.Hub.DeleteAll()
+	// the websockets held by the other replicas
+	for _, session := range sessions {
+		s.disconnectWs(session.SessionId, session.ClientId, nil)
+	}
 
 	// TODO: Implement session logout events
 	// Simple logout completion for boilerplate
@@ -164,7 +181,13 @@ func (s *HttpServer) getOnlineSessions(c *fiber.Ctx) ([]*OnlineSession, error) {
 	}
 
 	// Fetch active sessions
-	sessions := s.OAuth2.GetActiveSessions()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	sessions, err := s.OAuth2.GetActiveSessions(ctx)
+	if err != nil {
+		return nil, err
+	}
 	newSessions := []*OnlineSession{}
 
 	for _, v := range sessions {
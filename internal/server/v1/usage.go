@@ -0,0 +1,155 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Usage reports and quota status per consumer
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/errors"
+	"greenlync-api-gateway/pkg/usage"
+	"greenlync-api-gateway/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// UsageReport is the total calls of a consumer to a route on a day
+type UsageReport struct {
+	Date     string `json:"date"`
+	Consumer string `json:"consumer"`
+	UserId   int32  `json:"user_id"`
+	Route    string `json:"route"`
+	Calls    int64  `json:"calls"`
+}
+
+// MyUsage is the quota status and the metered calls of the current user
+type MyUsage struct {
+	Quotas []*usage.QuotaStatus `json:"quotas"`
+	Usage  []*UsageReport       `json:"usage"`
+}
+
+// usageQuery applies the date range (YYYY-MM-DD) and the route filters of the request
+func usageQuery(c *fiber.Ctx, db *gorm.DB) (*gorm.DB, error) {
+	for param, cond := range map[string]string{"from": "date >= ?", "to": "date <= ?"} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			return nil, fmt.Errorf("%s should be a date in the form YYYY-MM-DD", param)
+		}
+		db = db.Where(cond, value)
+	}
+
+	if route := c.Query("route"); route != "" {
+		db = db.Where("route = ?", route)
+	}
+
+	return db, nil
+}
+
+// @Id				GetUsage
+// @Description	Get the metered calls per day, consumer and route
+// @Tags			System
+// @Accept			json
+// @Produce		json
+// @Param			from		query		string	false	"from date (YYYY-MM-DD)"
+// @Param			to			query		string	false	"to date (YYYY-MM-DD)"
+// @Param			user_id		query		int		false	"search by user id"
+// @Param			consumer	query		string	false	"search by consumer e.g. user:1"
+// @Param			route		query		string	false	"search by route"
+// @Param			page		query		int		false	"page number"
+// @Param			limit		query		int		false	"limit number"
+// @Success		200			{array}		v1.UsageReport
+// @Failure		400			{object}	http.HttpResponse
+// @Failure		500			{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Router			/api/v1/system/usage [get]
+func (s *HttpServer) GetUsage(c *fiber.Ctx) error {
+	query, err := usageQuery(c, s.DB.Model(&model.Usage{}))
+	if err != nil {
+		return s.App.HttpResponseBadQueryParams(c, err)
+	}
+
+	if userId := c.QueryInt("user_id", 0); userId != 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	if consumer := c.Query("consumer"); consumer != "" {
+		query = query.Where("consumer = ?", consumer)
+	}
+
+	page := c.QueryInt("page", 1) - 1
+	limit := c.QueryInt("limit", 500)
+	if page < 0 || limit <= 0 || limit > 500 {
+		return s.App.HttpResponseBadQueryParams(c, fmt.Errorf("page should be positive and limit between 1 and 500"))
+	}
+
+	reports := []*UsageReport{}
+	err = query.
+		Select("date, consumer, user_id, route, calls").
+		Order("date DESC, consumer, route").
+		Offset(page * limit).
+		Limit(limit).
+		Scan(&reports).
+		Error
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	return s.App.HttpResponseOK(c, reports)
+}
+
+// @Id				GetMyUsage
+// @Description	Get the quota status and the metered calls of the current user, by default for the current month
+// @Tags			Usage
+// @Accept			json
+// @Produce		json
+// @Param			from	query		string	false	"from date (YYYY-MM-DD)"
+// @Param			to		query		string	false	"to date (YYYY-MM-DD)"
+// @Param			route	query		string	false	"search by route"
+// @Success		200		{object}	v1.MyUsage
+// @Failure		400		{object}	http.HttpResponse
+// @Failure		500		{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Router			/api/v1/usage/me [get]
+func (s *HttpServer) GetMyUsage(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c)
+	if !ok {
+		return s.App.HttpResponseInternalServerErrorRequest(c, errors.ErrCouldNotParseClientCfg)
+	}
+
+	now := time.Now().UTC()
+	db := s.DB.Model(&model.Usage{}).Where("user_id = ?", client.ClientId)
+	if c.Query("from") == "" && c.Query("to") == "" {
+		db = db.Where("date >= ?", time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).Format("2006-01-02"))
+	}
+
+	query, err := usageQuery(c, db)
+	if err != nil {
+		return s.App.HttpResponseBadQueryParams(c, err)
+	}
+
+	res := &MyUsage{Quotas: []*usage.QuotaStatus{}, Usage: []*UsageReport{}}
+	err = query.
+		Select("date, consumer, user_id, route, calls").
+		Order("date DESC, route").
+		Scan(&res.Usage).
+		Error
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	if quotas := s.Middleware.Quotas(); quotas != nil {
+		status, err := s.Middleware.Meter.Status(context.Background(), usage.UserConsumer(client.ClientId), quotas.ForUser(client.ClientId, client.Scope), now)
+		if err != nil {
+			return s.App.HttpResponseInternalServerErrorRequest(c, err)
+		}
+		res.Quotas = status
+	}
+
+	return s.App.HttpResponseOK(c, res)
+}
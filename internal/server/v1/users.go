@@ -0,0 +1,501 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Admin API for the user accounts
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/errors"
+	"greenlync-api-gateway/pkg/oauth2"
+	"greenlync-api-gateway/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type CrtUser struct {
+	Username string `json:"username" validate:"required,min=3,max=50" example:"alice"`
+	Email    string `json:"email" validate:"required,email,max=191" example:"alice@greenlync.com"`
+	// checked against the password policy
+	Password    string `json:"password" validate:"required"`
+	FirstName   string `json:"first_name" validate:"max=100"`
+	LastName    string `json:"last_name" validate:"max=100"`
+	Role        string `json:"role" validate:"required" example:"User"`
+	IsActive    bool   `json:"is_active"`
+	CompanyName string `json:"company_name" validate:"max=255"`
+	Phone       string `json:"phone" validate:"max=20"`
+	Address     string `json:"address"`
+}
+
+type UptUser struct {
+	Username string `json:"username" validate:"required,min=3,max=50" example:"alice"`
+	Email    string `json:"email" validate:"required,email,max=191" example:"alice@greenlync.com"`
+	// optional, every session of the user is logged out when it's set
+	Password    string `json:"password" validate:"omitempty"`
+	FirstName   string `json:"first_name" validate:"max=100"`
+	LastName    string `json:"last_name" validate:"max=100"`
+	Role        string `json:"role" validate:"required" example:"User"`
+	IsActive    bool   `json:"is_active"`
+	CompanyName string `json:"company_name" validate:"max=255"`
+	Phone       string `json:"phone" validate:"max=20"`
+	Address     string `json:"address"`
+}
+
+// sortable columns of the users list
+var userSortColumns = map[string]bool{
+	"id":         true,
+	"username":   true,
+	"email":      true,
+	"role":       true,
+	"created_at": true,
+	"updated_at": true,
+}
+
+// @Id				GetAllUsers
+// @Description	Get All Users, optionally searched by username, email or name and filtered by role and status
+// @Tags			Users
+// @Accept			json
+// @Produce		json
+// @Param			search		query		string	false	"search the username, email, first and last name"
+// @Param			role		query		string	false	"filter by role"
+// @Param			is_active	query		bool	false	"filter by status"
+// @Param			page		query		int		false	"page number"
+// @Param			limit		query		int		false	"limit number"
+// @Param			sort_by		query		string	false	"id, username, email, role, created_at or updated_at, suffixed by ' desc' to reverse"
+// @Success		200			{array}		model.User
+// @Failure		400			{object}	http.HttpResponse
+// @Failure		500			{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Router			/api/v1/system/users [get]
+func (s *HttpServer) GetAllUsers(c *fiber.Ctx) error {
+	// only the page number and page limit, users are filtered below
+	query, err := utils.QueryFilter(c)
+	if err != nil {
+		return s.App.HttpResponseBadQueryParams(c, err)
+	}
+
+	tx := s.DB.Model(&model.User{})
+
+	search := strings.TrimSpace(c.Query("search"))
+	if search != "" {
+		like := "%" + search + "%"
+		tx = tx.Where("username LIKE ? OR email LIKE ? OR first_name LIKE ? OR last_name LIKE ?", like, like, like, like)
+	}
+
+	role := c.Query("role")
+	if role != "" {
+		tx = tx.Where("role = ?", role)
+	}
+
+	isActive := c.Query("is_active")
+	if isActive != "" {
+		active, err := strconv.ParseBool(isActive)
+		if err != nil {
+			return s.App.HttpResponseBadQueryParams(c, fmt.Errorf("is_active: %w", err))
+		}
+		tx = tx.Where("is_active = ?", active)
+	}
+
+	order := "id"
+	if query.SortBy != "" {
+		column, direction, _ := strings.Cut(strings.ToLower(strings.TrimSpace(query.SortBy)), " ")
+		if !userSortColumns[column] || (direction != "" && direction != "asc" && direction != "desc") {
+			return s.App.HttpResponseBadQueryParams(c, fmt.Errorf("can't sort the users by %s", query.SortBy))
+		}
+		order = strings.TrimSpace(column + " " + direction)
+	}
+
+	users := []*model.User{}
+	err = tx.
+		Offset(query.Page * query.Limit).
+		Limit(query.Limit).
+		Order(order).
+		Find(&users).
+		Error
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	return s.App.HttpResponseOK(c, users)
+}
+
+// @Id				GetUser
+// @Description	Get User
+// @Tags			Users
+// @Accept			json
+// @Produce		json
+// @Success		200	{object}	model.User
+// @Failure		404	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			user_id	path	int	true	"User ID"
+// @Router			/api/v1/system/users/{user_id} [get]
+func (s *HttpServer) GetUser(c *fiber.Ctx) error {
+	user, err := s.getUser(c)
+	if err != nil {
+		return s.httpResponseUserError(c, err)
+	}
+
+	return s.App.HttpResponseOK(c, user)
+}
+
+// @Id				CreateUser
+// @Description	Create a user with a role defined in the system roles
+// @Tags			Users
+// @Accept			json
+// @Produce		json
+// @Success		201	{object}	model.User
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			body	body	v1.CrtUser	true	"User Request Body"
+// @Router			/api/v1/system/users [post]
+func (s *HttpServer) CreateUser(c *fiber.Ctx) error {
+	data := &CrtUser{}
+	err := c.BodyParser(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	data.Username = strings.TrimSpace(data.Username)
+	data.Email = strings.TrimSpace(data.Email)
+	err = s.Validate.Struct(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, utils.ValidatorMessage(err))
+	}
+
+	err = s.validateUser(0, data.Username, data.Email, data.Role)
+	if err != nil {
+		return s.httpResponseUserError(c, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	err = s.OAuth2.ValidatePassword(ctx, 0, data.Password)
+	if err != nil {
+		return s.httpResponsePasswordError(c, err)
+	}
+
+	hash, err := oauth2.EncryptPassword(data.Password)
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	now := time.Now()
+	user := &model.User{
+		Username:     data.Username,
+		Email:        data.Email,
+		FirstName:    data.FirstName,
+		LastName:     data.LastName,
+		PasswordHash: hash,
+		Role:         data.Role,
+		IsActive:     data.IsActive,
+		CompanyName:  data.CompanyName,
+		Phone:        data.Phone,
+		Address:      data.Address,
+		AuthSource:   model.AuthSource_Local,
+		// the admin vouches for the email
+		EmailVerifiedAt: &now,
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(user).Error
+		if err != nil {
+			return err
+		}
+		// is_active defaults to true in the database so the zero value isn't inserted
+		if !data.IsActive {
+			err = tx.Model(user).Update("is_active", false).Error
+			if err != nil {
+				return err
+			}
+		}
+		return s.OAuth2.RecordPassword(tx, user.Id, hash)
+	})
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	s.queueUserOperationLog(c, "create_user", user)
+
+	return s.App.HttpResponseCreated(c, user)
+}
+
+// @Id				UpdateUser
+// @Description	Update User, the sessions of the user are logged out when it's deactivated, its role changes or its password is set
+// @Tags			Users
+// @Accept			json
+// @Produce		json
+// @Success		200	{object}	model.User
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		404	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			user_id	path	int			true	"User ID"
+// @Param			body	body	v1.UptUser	true	"User Request Body"
+// @Router			/api/v1/system/users/{user_id} [put]
+func (s *HttpServer) UpdateUser(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c)
+	if !ok {
+		return s.App.HttpResponseInternalServerErrorRequest(c, errors.ErrCouldNotParseClientCfg)
+	}
+
+	user, err := s.getUser(c)
+	if err != nil {
+		return s.httpResponseUserError(c, err)
+	}
+
+	data := &UptUser{}
+	err = c.BodyParser(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, err)
+	}
+
+	data.Username = strings.TrimSpace(data.Username)
+	data.Email = strings.TrimSpace(data.Email)
+	err = s.Validate.Struct(data)
+	if err != nil {
+		return s.App.HttpResponseBadRequest(c, utils.ValidatorMessage(err))
+	}
+
+	if user.Id == client.ClientId && !data.IsActive {
+		return s.App.HttpResponseBadRequest(c, errors.ErrCannotModifySelf)
+	}
+
+	if data.Password != "" && user.AuthSource != model.AuthSource_Local {
+		return s.App.HttpResponseBadRequest(c, errors.ErrExternalAccount)
+	}
+
+	err = s.validateUser(user.Id, data.Username, data.Email, data.Role)
+	if err != nil {
+		return s.httpResponseUserError(c, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	if data.Password != "" {
+		err = s.OAuth2.ValidatePassword(ctx, user.Id, data.Password)
+		if err != nil {
+			return s.httpResponsePasswordError(c, err)
+		}
+	}
+
+	// the sessions carry the role as their scope
+	logout := (user.IsActive && !data.IsActive) || user.Role != data.Role || data.Password != ""
+
+	user.Username = data.Username
+	user.Email = data.Email
+	user.FirstName = data.FirstName
+	user.LastName = data.LastName
+	user.Role = data.Role
+	user.IsActive = data.IsActive
+	user.CompanyName = data.CompanyName
+	user.Phone = data.Phone
+	user.Address = data.Address
+	if data.Password != "" {
+		user.PasswordHash, err = oauth2.EncryptPassword(data.Password)
+		if err != nil {
+			return s.App.HttpResponseInternalServerErrorRequest(c, err)
+		}
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Save(user).Error
+		if err != nil || data.Password == "" {
+			return err
+		}
+		return s.OAuth2.RecordPassword(tx, user.Id, user.PasswordHash)
+	})
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	if logout {
+		// the admin updating their own role keeps the current session
+		err = s.logoutUser(ctx, user.Id, client.SessionId)
+		if err != nil {
+			return s.App.HttpResponseInternalServerErrorRequest(c, err)
+		}
+	}
+
+	s.queueUserOperationLog(c, "update_user", user)
+
+	return s.App.HttpResponseOK(c, user)
+}
+
+// @Id				DeactivateUser
+// @Description	Deactivate User and log out all of its sessions
+// @Tags			Users
+// @Accept			json
+// @Produce		json
+// @Success		200	{object}	model.User
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		404	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			user_id	path	int	true	"User ID"
+// @Router			/api/v1/system/users/{user_id}/deactivate [post]
+func (s *HttpServer) DeactivateUser(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c)
+	if !ok {
+		return s.App.HttpResponseInternalServerErrorRequest(c, errors.ErrCouldNotParseClientCfg)
+	}
+
+	user, err := s.getUser(c)
+	if err != nil {
+		return s.httpResponseUserError(c, err)
+	}
+
+	if user.Id == client.ClientId {
+		return s.App.HttpResponseBadRequest(c, errors.ErrCannotModifySelf)
+	}
+
+	user.IsActive = false
+	err = s.DB.Model(user).Update("is_active", false).Error
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	err = s.logoutUser(ctx, user.Id, "")
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	s.queueUserOperationLog(c, "deactivate_user", user)
+
+	return s.App.HttpResponseOK(c, user)
+}
+
+// @Id				DeleteUser
+// @Description	Delete User, its sessions are logged out first
+// @Tags			Users
+// @Accept			json
+// @Produce		json
+// @Success		204
+// @Failure		400	{object}	http.HttpResponse
+// @Failure		404	{object}	http.HttpResponse
+// @Failure		500	{object}	http.HttpResponse
+// @Security		BearerAuth
+// @Param			user_id	path	int	true	"User ID"
+// @Router			/api/v1/system/users/{user_id} [DELETE]
+func (s *HttpServer) DeleteUser(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c)
+	if !ok {
+		return s.App.HttpResponseInternalServerErrorRequest(c, errors.ErrCouldNotParseClientCfg)
+	}
+
+	user, err := s.getUser(c)
+	if err != nil {
+		return s.httpResponseUserError(c, err)
+	}
+
+	if user.Id == client.ClientId {
+		return s.App.HttpResponseBadRequest(c, errors.ErrCannotModifySelf)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	err = s.logoutUser(ctx, user.Id, "")
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ?", user.Id).Delete(&model.UserMfa{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(user).Error
+	})
+	if err != nil {
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+
+	s.queueUserOperationLog(c, "delete_user", user)
+
+	return s.App.HttpResponseNoContent(c)
+}
+
+// getUser loads the user of the user_id param, the returned error is the response
+func (s *HttpServer) getUser(c *fiber.Ctx) (*model.User, error) {
+	id, err := c.ParamsInt("user_id")
+	if err != nil {
+		return nil, errors.ErrInvalidID
+	}
+
+	user := &model.User{}
+	err = s.DB.First(user, id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// httpResponseUserError responds with the error returned by getUser or validateUser
+func (s *HttpServer) httpResponseUserError(c *fiber.Ctx, err error) error {
+	switch err {
+	case errors.ErrInvalidID, errors.ErrAccountAlreadyExists, errors.ErrRoleNotFound:
+		return s.App.HttpResponseBadRequest(c, err)
+	case gorm.ErrRecordNotFound:
+		return s.App.HttpResponseNotFound(c, err)
+	default:
+		return s.App.HttpResponseInternalServerErrorRequest(c, err)
+	}
+}
+
+// validateUser checks the username and the email aren't taken by another user than userId and
+// the role is one of the system roles
+func (s *HttpServer) validateUser(userId int32, username, email, role string) error {
+	var count int64
+	err := s.DB.Model(&model.User{}).
+		Where("id <> ? AND (username = ? OR email = ?)", userId, username, email).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.ErrAccountAlreadyExists
+	}
+
+	err = s.DB.Model(&model.Role{}).Where("`desc` = ?", role).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.ErrRoleNotFound
+	}
+
+	return nil
+}
+
+func (s *HttpServer) queueUserOperationLog(c *fiber.Ctx, action string, user *model.User) {
+	cfg, ok := utils.GetClient(c)
+	if !ok {
+		return
+	}
+
+	s.queueSystemOperationLog(&model.OperationsLog{
+		Action:     action,
+		Resource:   "user",
+		ResourceId: fmt.Sprint(user.Id),
+		UserId:     cfg.ClientId,
+		Method:     c.Method(),
+		URL:        c.OriginalURL(),
+		IpAddress:  utils.GetRealIP(c),
+		UserAgent:  c.Get("User-Agent"),
+		SessionId:  cfg.SessionId,
+	})
+}
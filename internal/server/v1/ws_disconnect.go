@@ -0,0 +1,124 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Closes the websocket connections of the logged out sessions on whichever replica holds them
+
+package v1
+
+import (
+	"fmt"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/nats"
+
+	"github.com/goccy/go-json"
+	natsio "github.com/nats-io/nats.go"
+)
+
+// WsDisconnect asks the replicas to close the websocket of a session, only the replica holding
+// the connection has it
+type WsDisconnect struct {
+	SessionId string `json:"session_id"`
+	UserId    int32  `json:"user_id"`
+	// the client is told why and given time to read it before the connection closes, nil closes
+	// it right away
+	Reason *SessionDescionnectionReason `json:"reason,omitempty"`
+	// replica that published it, it closed its own connection already
+	Replica string `json:"replica"`
+}
+
+// disconnectWs closes the websocket of the session on this replica and tells the other replicas
+// to close it in case one of them holds it
+func (s *HttpServer) disconnectWs(sessionId string, userId int32, reason *SessionDescionnectionReason) {
+	msg := &WsDisconnect{
+		SessionId: sessionId,
+		UserId:    userId,
+		Reason:    reason,
+		Replica:   s.OAuth2.Sessions.Replica(),
+	}
+	s.closeWs(msg)
+
+	js, err := json.Marshal(msg)
+	if err != nil {
+		s.Log.Logger.Error(err)
+		return
+	}
+
+	err = s.Nats.NC.Publish(nats.SubjectSessionsDisconnect, js)
+	if err != nil {
+		s.Log.Logger.Errorf("error publishing to %s: %v", nats.SubjectSessionsDisconnect, err)
+	}
+}
+
+// closeWs closes the websocket of the session if this replica holds it
+func (s *HttpServer) closeWs(msg *WsDisconnect) {
+	if _, ok := s.Hub.Get(msg.SessionId); !ok {
+		return
+	}
+
+	if msg.Reason == nil {
+		err := s.Hub.Delete(msg.SessionId)
+		if err != nil {
+			s.Log.Logger.Error(err)
+		}
+		return
+	}
+
+	// publish to the client that your session has been killed or limit reached and you will be logged out
+	s.publishClientDisconnectedWithReason(msg.SessionId, msg.UserId, *msg.Reason)
+
+	// wait for the client to receive the message then logout anyway
+	time.AfterFunc(time.Second*5, func() {
+		s.Log.Logger.Infof("killClientSession: %s", msg.SessionId)
+
+		err := s.Hub.Delete(msg.SessionId)
+		if err != nil {
+			s.Log.Logger.Error(err)
+		}
+	})
+}
+
+// publishClientDisconnectedWithReason tells the websocket client of the session why it's about to be logged out
+func (s *HttpServer) publishClientDisconnectedWithReason(sessionId string, userId int32, reason SessionDescionnectionReason) {
+	client, ok := s.Hub.Get(sessionId)
+	if !ok {
+		return
+	}
+
+	payload, err := json.Marshal(map[string]string{
+		"reason": SessionDescionnectionReason_name[reason],
+	})
+	if err != nil {
+		s.Log.Logger.Error(err)
+		return
+	}
+
+	client.Publisher.Publish(&model.Event{
+		Type:      model.EventType_SessionExpired,
+		UserId:    userId,
+		Payload:   string(payload),
+		Format:    "3", // JsonMessage
+		SessionId: sessionId,
+	})
+}
+
+// every replica closes the websockets it holds of the sessions logged out on the other replicas
+func (s *HttpServer) subscribeWsDisconnect() error {
+	_, err := s.Nats.NC.Subscribe(nats.SubjectSessionsDisconnect, func(m *natsio.Msg) {
+		msg := &WsDisconnect{}
+		err := json.Unmarshal(m.Data, msg)
+		if err != nil {
+			s.Log.Logger.Errorf("error decoding %s message: %v", nats.SubjectSessionsDisconnect, err)
+			return
+		}
+		if msg.Replica == s.OAuth2.Sessions.Replica() {
+			return
+		}
+
+		s.closeWs(msg)
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't subscribe to %s: %w", nats.SubjectSessionsDisconnect, err)
+	}
+
+	return nil
+}
@@ -34,9 +34,23 @@ type User struct {
 	CompanyName  string `gorm:"column:company_name;type:varchar(255)" json:"company_name,omitempty"`
 	Phone        string `gorm:"column:phone;type:varchar(20)" json:"phone,omitempty"`
 	Address      string `gorm:"column:address;type:text" json:"address,omitempty"`
+	// signed up by the public registration rather than created by an admin
+	Registered bool `gorm:"column:registered;default:false" json:"registered,omitempty"`
+	// set once the user opened the verification link sent at registration
+	EmailVerifiedAt *time.Time `gorm:"column:email_verified_at" json:"email_verified_at,omitempty"`
+	// backend the user authenticates with, the directory users have no password hash
+	AuthSource string `gorm:"column:auth_source;type:varchar(20);default:local" json:"auth_source"`
+	// id of the user in its backend, the DN of a directory user
+	ExternalId string `gorm:"column:external_id;type:varchar(255);index" json:"external_id,omitempty"`
 	CommonModel
 }
 
+// Authentication backends of the users
+const (
+	AuthSource_Local = "local"
+	AuthSource_LDAP  = "ldap"
+)
+
 // UserType represents different types of users
 type UserType int32
 
@@ -74,6 +88,76 @@ type Token struct {
 	Scope        string    `gorm:"column:scope" json:"scope"`
 	IpAddress    string    `gorm:"column:ip_address" json:"ip_address"`
 	UserAgent    string    `gorm:"column:user_agent" json:"user_agent,omitempty"`
+	// OAuth client the token was issued to, empty for first-party logins
+	ClientId string `gorm:"column:client_id;index;type:varchar(64)" json:"client_id,omitempty"`
+	// Casbin resources the token is restricted to, empty means everything the scope allows
+	Resources []string `gorm:"column:resources;type:text;serializer:json" json:"resources,omitempty"`
+	// id of a JWT access token, the token itself isn't stored
+	Jti string `gorm:"column:jti;index;type:varchar(64)" json:"jti,omitempty"`
+	// set once the refresh token was rotated, using it again revokes the whole session
+	ConsumedAt *time.Time `gorm:"column:consumed_at" json:"consumed_at,omitempty"`
+	// set once the refresh token was revoked, it can't be used anymore
+	RevokedAt *time.Time `gorm:"column:revoked_at" json:"revoked_at,omitempty"`
+	CommonModel
+}
+
+// OAuth grant types a client can be allowed to use
+const (
+	GrantType_ClientCredentials = "client_credentials"
+	GrantType_AuthorizationCode = "authorization_code"
+	GrantType_RefreshToken      = "refresh_token"
+	GrantType_Password          = "password"
+)
+
+// OAuthClient is an application registered to get tokens from the gateway, its
+// tokens act on behalf of the owner and are limited to the allowed scopes (Casbin resources)
+type OAuthClient struct {
+	Id           int32    `gorm:"primaryKey;column:id" json:"id"`
+	ClientId     string   `gorm:"uniqueIndex;column:client_id;type:varchar(64)" json:"client_id"`
+	SecretHash   string   `gorm:"column:secret_hash;type:varchar(255)" json:"-"`
+	Name         string   `gorm:"column:name;type:varchar(100)" json:"name"`
+	Grants       []string `gorm:"column:grants;type:text;serializer:json" json:"grants"`
+	Scopes       []string `gorm:"column:scopes;type:text;serializer:json" json:"scopes"`
+	RedirectUris []string `gorm:"column:redirect_uris;type:text;serializer:json" json:"redirect_uris"`
+	OwnerId      int32    `gorm:"column:owner_id;index" json:"owner_id"`
+	// public clients (SPAs, mobile apps) can't keep a secret and rely on PKCE alone
+	IsPublic bool `gorm:"column:is_public" json:"is_public"`
+	// first-party apps skip the consent and their tokens aren't restricted to the scopes
+	IsFirstParty bool `gorm:"column:is_first_party" json:"is_first_party"`
+	IsActive     bool `gorm:"column:is_active;default:true" json:"is_active"`
+	CommonModel
+}
+
+// HasRedirectUri reports whether the redirect uri is registered, the match is exact
+func (o *OAuthClient) HasRedirectUri(uri string) bool {
+	for _, u := range o.RedirectUris {
+		if u == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// HasGrant reports whether the client is allowed to use the grant type
+func (o *OAuthClient) HasGrant(grant string) bool {
+	for _, g := range o.Grants {
+		if g == grant {
+			return true
+		}
+	}
+	return false
+}
+
+// SigningKey is a key pair signing the tokens issued by the gateway, a key signs from
+// NotBefore until a newer key takes over and stays published in the JWKS until ExpiresAt
+type SigningKey struct {
+	Id         int32     `gorm:"primaryKey;column:id" json:"id"`
+	Kid        string    `gorm:"uniqueIndex;column:kid;type:varchar(64)" json:"kid"`
+	Algorithm  string    `gorm:"column:algorithm;type:varchar(16)" json:"algorithm"`
+	PrivateKey string    `gorm:"column:private_key;type:text" json:"-"`
+	PublicKey  string    `gorm:"column:public_key;type:text" json:"public_key"`
+	NotBefore  time.Time `gorm:"column:not_before;index" json:"not_before"`
+	ExpiresAt  time.Time `gorm:"column:expires_at;index" json:"expires_at"`
 	CommonModel
 }
 
@@ -142,6 +226,11 @@ const (
 	EventType_EmailDraft      EventType = 35
 	EventType_EmailOutbox     EventType = 36
 
+	// Security Events
+	EventType_RefreshTokenReused EventType = 40
+	EventType_UserImpersonated   EventType = 41
+	EventType_NewDeviceLogin     EventType = 42
+
 )
 
 // Event type mappings for serialization
@@ -168,6 +257,10 @@ var EventType_name = map[int32]string{
 	34: "report_generated",
 	35: "email_draft",
 	36: "email_outbox",
+
+	40: "refresh_token_reused",
+	41: "user_impersonated",
+	42: "new_device_login",
 }
 
 var EventType_value = map[string]int32{
@@ -193,6 +286,10 @@ var EventType_value = map[string]int32{
 	"report_generated":   34,
 	"email_draft":        35,
 	"email_outbox":       36,
+
+	"refresh_token_reused": 40,
+	"user_impersonated":    41,
+	"new_device_login":     42,
 }
 
 // ErrorPayload represents structured error information for events
@@ -261,6 +358,54 @@ type ConfigGroup struct {
 	CommonModel
 }
 
+// ProxyRoute represents an upstream route managed at runtime through the admin API,
+// every gateway replica loads the active ones into its proxy routing table
+type ProxyRoute struct {
+	Id          int32             `gorm:"primaryKey;column:id" json:"id"`
+	Name        string            `gorm:"uniqueIndex;column:name;type:varchar(191)" json:"name"`
+	Prefix      string            `gorm:"uniqueIndex;column:prefix;type:varchar(191)" json:"prefix"`
+	Upstreams   []string          `gorm:"column:upstreams;type:text;serializer:json" json:"upstreams"`
+	StripPrefix bool              `gorm:"column:strip_prefix" json:"strip_prefix"`
+	Timeout     int               `gorm:"column:timeout" json:"timeout"`
+	Resource    string            `gorm:"column:resource;type:varchar(191)" json:"resource"`
+	Strategy    string            `gorm:"column:strategy;type:varchar(32)" json:"strategy"`
+	Weights     []int             `gorm:"column:weights;type:text;serializer:json" json:"weights"`
+	HealthCheck *ProxyHealthCheck `gorm:"column:health_check;type:text;serializer:json" json:"health_check"`
+
+	CircuitBreaker *ProxyCircuitBreaker `gorm:"column:circuit_breaker;type:text;serializer:json" json:"circuit_breaker"`
+	Retry          *ProxyRetryPolicy    `gorm:"column:retry;type:text;serializer:json" json:"retry"`
+	IsActive       bool                 `gorm:"column:is_active;index" json:"is_active"`
+	CommonModel
+}
+
+// ProxyHealthCheck is the active health check probing the upstreams of a ProxyRoute
+type ProxyHealthCheck struct {
+	Path               string `json:"path"`
+	Interval           int    `json:"interval"`
+	Timeout            int    `json:"timeout"`
+	HealthyThreshold   int    `json:"healthy_threshold"`
+	UnhealthyThreshold int    `json:"unhealthy_threshold"`
+}
+
+// ProxyCircuitBreaker is the circuit breaker of the upstreams of a ProxyRoute
+type ProxyCircuitBreaker struct {
+	Window           int `json:"window"`
+	MinRequests      int `json:"min_requests"`
+	ErrorRate        int `json:"error_rate"`
+	LatencyThreshold int `json:"latency_threshold"`
+	OpenDuration     int `json:"open_duration"`
+	HalfOpenRequests int `json:"half_open_requests"`
+}
+
+// ProxyRetryPolicy retries the idempotent requests of a ProxyRoute
+type ProxyRetryPolicy struct {
+	Attempts   int `json:"attempts"`
+	BaseDelay  int `json:"base_delay"`
+	MaxDelay   int `json:"max_delay"`
+	Budget     int `json:"budget"`
+	MinRetries int `json:"min_retries"`
+}
+
 // ValueType represents the data type of configuration values
 type ValueType int32
 
@@ -319,6 +464,93 @@ type OperationsLog struct {
 	RequestBody string `gorm:"column:request_body;type:text" json:"request_body,omitempty"`
 	Response    string `gorm:"column:response;type:text" json:"response,omitempty"`
 	SessionId   string `gorm:"column:session_id;index;type:varchar(191)" json:"session_id"`
+	// admin who did the operation while impersonating the user, 0 when the user did it
+	ImpersonatorId int32 `gorm:"column:impersonator_id;index" json:"impersonator_id,omitempty"`
+	CommonModel
+}
+
+// ============================================================================
+// API KEYS
+// ============================================================================
+
+// ApiKey is a long-lived personal access token, only the SHA-256 hash of the key
+// is stored and the key can only call the listed Casbin resources of its user
+type ApiKey struct {
+	Id         int32      `gorm:"primaryKey;column:id" json:"id"`
+	UserId     int32      `gorm:"column:user_id;index" json:"user_id"`
+	Name       string     `gorm:"column:name;type:varchar(100)" json:"name"`
+	Prefix     string     `gorm:"column:prefix;type:varchar(16)" json:"prefix"`
+	Hash       string     `gorm:"uniqueIndex;column:hash;type:varchar(64)" json:"-"`
+	Resources  []string   `gorm:"column:resources;type:text;serializer:json" json:"resources"`
+	ExpiresAt  *time.Time `gorm:"column:expires_at" json:"expires_at"`
+	LastUsedAt *time.Time `gorm:"column:last_used_at" json:"last_used_at"`
+	LastUsedIp string     `gorm:"column:last_used_ip;type:varchar(45)" json:"last_used_ip"`
+	RevokedAt  *time.Time `gorm:"column:revoked_at" json:"revoked_at"`
+	CommonModel
+}
+
+// ============================================================================
+// PASSWORD HISTORY
+// ============================================================================
+
+// PasswordHistory is a previous password hash of a user, the newest ones can't be reused
+type PasswordHistory struct {
+	Id           int32  `gorm:"primaryKey;column:id" json:"id"`
+	UserId       int32  `gorm:"column:user_id;index" json:"user_id"`
+	PasswordHash string `gorm:"column:password_hash;type:varchar(255)" json:"-"`
+	CommonModel
+}
+
+// ============================================================================
+// MULTI-FACTOR AUTHENTICATION
+// ============================================================================
+
+// UserMfa is the TOTP factor of a user, it's only enforced once confirmed with a first code.
+// Recovery codes are stored as SHA-256 hashes and can be used once each
+type UserMfa struct {
+	Id            int32      `gorm:"primaryKey;column:id" json:"id"`
+	UserId        int32      `gorm:"uniqueIndex;column:user_id" json:"user_id"`
+	Secret        string     `gorm:"column:secret;type:varchar(64)" json:"-"`
+	ConfirmedAt   *time.Time `gorm:"column:confirmed_at" json:"confirmed_at"`
+	LastStep      int64      `gorm:"column:last_step" json:"-"`
+	RecoveryCodes []string   `gorm:"column:recovery_codes;type:text;serializer:json" json:"-"`
+	CommonModel
+}
+
+// ============================================================================
+// KNOWN DEVICES
+// ============================================================================
+
+// KnownDevice is a device a user signed in from, identified by the fingerprint of its browser
+// family, OS, channel and IP subnet. The created_at is the first sign in from it
+type KnownDevice struct {
+	Id          int32       `gorm:"primaryKey;column:id" json:"id"`
+	UserId      int32       `gorm:"uniqueIndex:idx_known_device_user_fingerprint;column:user_id" json:"user_id"`
+	Fingerprint string      `gorm:"uniqueIndex:idx_known_device_user_fingerprint;column:fingerprint;type:varchar(64)" json:"-"`
+	Browser     string      `gorm:"column:browser;type:varchar(100)" json:"browser" example:"Chrome"`
+	OS          string      `gorm:"column:os;type:varchar(100)" json:"os" example:"Windows"`
+	Channel     ChannelType `gorm:"column:channel" json:"channel"`
+	Subnet      string      `gorm:"column:subnet;type:varchar(64)" json:"subnet" example:"203.0.113.0/24"`
+	// of the last sign in
+	IpAddress string `gorm:"column:ip_address;type:varchar(64)" json:"ip_address"`
+	// marked by the user, trusted devices don't need the MFA of unknown devices
+	Trusted    bool      `gorm:"column:trusted" json:"trusted"`
+	LastSeenAt time.Time `gorm:"column:last_seen_at" json:"last_seen_at"`
+	CommonModel
+}
+
+// ============================================================================
+// USAGE METERING
+// ============================================================================
+
+// Usage counts the calls of a consumer (user or API key) to a route in a day (UTC)
+type Usage struct {
+	Id       int32  `gorm:"primaryKey;column:id" json:"id"`
+	Date     string `gorm:"uniqueIndex:idx_usage_date_consumer_route;column:date;type:varchar(10)" json:"date"`
+	Consumer string `gorm:"uniqueIndex:idx_usage_date_consumer_route;column:consumer;type:varchar(64)" json:"consumer"`
+	Route    string `gorm:"uniqueIndex:idx_usage_date_consumer_route;column:route;type:varchar(191)" json:"route"`
+	UserId   int32  `gorm:"column:user_id;index" json:"user_id"`
+	Calls    int64  `gorm:"column:calls" json:"calls"`
 	CommonModel
 }
 
@@ -17,6 +17,8 @@ type Session struct {
 	StartedAt  time.Time  `gorm:"column:started_at" json:"started_at"`
 	FinishedAt *time.Time `gorm:"column:finished_at" json:"finished_at"`
 	Scope      string     `gorm:"column:scope" json:"scope"`
+	// admin impersonating the user, 0 for the sessions of the user
+	ImpersonatorId int32 `gorm:"column:impersonator_id;index" json:"impersonator_id,omitempty"`
 	CommonModel
 }
 
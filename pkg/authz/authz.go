@@ -25,6 +25,7 @@ const (
 	Resources_Users_Create  = "users_create"
 	Resources_Users_Update  = "users_update"
 	Resources_Users_Delete  = "users_delete"
+	Resources_Users_Impersonate = "users_impersonate"
 	Resources_Sessions_Read = "sessions_read"
 	Resources_Sessions_Delete = "sessions_delete"
 	Resources_Tokens_Read   = "tokens_read"
@@ -33,6 +34,13 @@ const (
 	Resources_Emails_Send   = "emails_send"
 	Resources_Logs_Read     = "logs_read"
 	Resources_Logs_Delete   = "logs_delete"
+	Resources_Routes_Read   = "routes_read"
+	Resources_Routes_Manage = "routes_manage"
+	Resources_Usage_Read    = "usage_read"
+	Resources_Clients_Read   = "clients_read"
+	Resources_Clients_Manage = "clients_manage"
+	Resources_Keys_Read      = "keys_read"
+	Resources_Keys_Manage    = "keys_manage"
 
 	// User Resources
 	Resources_MyProfile_Read           = "myprofile_read"
@@ -44,6 +52,13 @@ const (
 	Resources_MyEmails_Delete          = "myemails_delete"
 	Resources_MySessions_Read          = "mysessions_read"
 	Resources_MySessions_Delete        = "mysessions_delete"
+	Resources_MyUsage_Read             = "myusage_read"
+	Resources_MyApiKeys_Read           = "myapikeys_read"
+	Resources_MyApiKeys_Manage         = "myapikeys_manage"
+	Resources_MyMfa_Read               = "mymfa_read"
+	Resources_MyMfa_Manage             = "mymfa_manage"
+	Resources_MyDevices_Read           = "mydevices_read"
+	Resources_MyDevices_Manage         = "mydevices_manage"
 )
 
 // Default system Roles (can't be changed)
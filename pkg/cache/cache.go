@@ -10,11 +10,47 @@ import (
 )
 
 var (
+	// active sessions registry shared by the replicas, session id to session
 	KeySessionsMap = "sessions_map"
+	// session ids by the public id of the session
+	KeySessionIds = "sessions_ids"
+	// last activity of the active sessions, scored by unix time
+	KeySessionsActivity = "sessions_activity"
+	// sessions connected on a websocket, session id to the replica holding the connection
+	KeySessionsWs = "sessions_ws"
+	// replica running the idle sessions expiry
+	KeySessionsMonitor = "sessions_monitor"
+	// revoked JWT access tokens and sessions, scored by when the entry can be forgotten
+	KeyRevokedTokens = "revoked_tokens"
+	// revocations are published here so every replica applies them right away
+	ChannelRevokedTokens = "revoked_tokens"
 
 	SessionsKey = func(sessionId string) string { return fmt.Sprint("sessions_", sessionId) }
 	TokensKey   = func(token string) string { return fmt.Sprint("tokens_", token) }
 	RefreshKey  = func(refreshToken string) string { return fmt.Sprint("refresh_tokens_", refreshToken) }
+	ApiKeysKey  = func(hash string) string { return fmt.Sprint("api_keys_", hash) }
+	AuthCodeKey = func(code string) string { return fmt.Sprint("auth_codes_", code) }
+
+	UserSessionsKey   = func(userId int32) string { return fmt.Sprint("sessions_user_", userId) }
+	SessionReplicaKey = func(replica string) string { return fmt.Sprint("sessions_replicas_", replica) }
+
+	MfaChallengeKey = func(token string) string { return fmt.Sprint("mfa_challenges_", token) }
+	MfaAttemptsKey  = func(token string) string { return fmt.Sprint("mfa_attempts_", token) }
+
+	DeviceCodeKey     = func(hash string) string { return fmt.Sprint("device_codes_", hash) }
+	DeviceCodeUserKey = func(userId int32) string { return fmt.Sprint("device_codes_user_", userId) }
+
+	LoginFailuresKey = func(subject string) string { return fmt.Sprint("login_failures_", subject) }
+	LoginDelayKey    = func(subject string) string { return fmt.Sprint("login_delays_", subject) }
+	LoginLockoutKey  = func(subject string) string { return fmt.Sprint("login_lockouts_", subject) }
+
+	PasswordResetKey         = func(hash string) string { return fmt.Sprint("password_resets_", hash) }
+	PasswordResetUserKey     = func(userId int32) string { return fmt.Sprint("password_resets_user_", userId) }
+	PasswordResetThrottleKey = func(email string) string { return fmt.Sprint("password_resets_sent_", email) }
+
+	EmailVerificationKey         = func(hash string) string { return fmt.Sprint("email_verifications_", hash) }
+	EmailVerificationUserKey     = func(userId int32) string { return fmt.Sprint("email_verifications_user_", userId) }
+	EmailVerificationThrottleKey = func(email string) string { return fmt.Sprint("email_verifications_sent_", email) }
 )
 
 type Cache struct {
@@ -46,6 +82,12 @@ func (e *Cache) Get(ctx context.Context, key string) (string, error) {
 	return string(result), nil
 }
 
+// GetDel Redis `GETDEL key` command, the key can only be read once.
+// It returns redis.Nil error when key does not exist.
+func (e *Cache) GetDel(ctx context.Context, key string) (string, error) {
+	return e.redis.GetDel(ctx, key).Result()
+}
+
 // // Get Redis `GET key` command. It returns redis.Nil error when key does not exist.
 // func (e *Cache) GetAll(ctx context.Context, key string) (string, error) {
 // 	result, err := e.Redis.Sc(ctx, key).Result()
@@ -107,7 +107,7 @@ func NewMysqDB(cfg *config.Config) (*MysqlDB, error) {
 // Migrate when you change your model, called from main only
 func (db *MysqlDB) Migrate() error {
 	// Core models for boilerplate
-	if err := db.DB.AutoMigrate(&model.User{}, &model.Role{}, &model.Permission{}); err != nil {
+	if err := db.DB.AutoMigrate(&model.User{}, &model.Role{}, &model.Permission{}, &model.PasswordHistory{}); err != nil {
 		return err
 	}
 	// Authorization and sessions
@@ -115,7 +115,7 @@ func (db *MysqlDB) Migrate() error {
 		return err
 	}
 	// Configuration management
-	if err := db.DB.AutoMigrate(&model.ConfigGroup{}, &model.Config{}); err != nil {
+	if err := db.DB.AutoMigrate(&model.ConfigGroup{}, &model.Config{}, &model.ProxyRoute{}); err != nil {
 		return err
 	}
 	// Communication
@@ -126,6 +126,22 @@ func (db *MysqlDB) Migrate() error {
 	if err := db.DB.AutoMigrate(&model.Event{}, &model.OperationsLog{}); err != nil {
 		return err
 	}
+	// API keys, OAuth clients and token signing keys
+	if err := db.DB.AutoMigrate(&model.ApiKey{}, &model.OAuthClient{}, &model.SigningKey{}); err != nil {
+		return err
+	}
+	// Multi-factor authentication
+	if err := db.DB.AutoMigrate(&model.UserMfa{}); err != nil {
+		return err
+	}
+	// Known devices of the users
+	if err := db.DB.AutoMigrate(&model.KnownDevice{}); err != nil {
+		return err
+	}
+	// Usage metering
+	if err := db.DB.AutoMigrate(&model.Usage{}); err != nil {
+		return err
+	}
 
 	return nil
 }
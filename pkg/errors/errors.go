@@ -42,6 +42,42 @@ const (
 	MarketAlreadyStarted            = "market feed has been already started"
 	MarketAlreadyStoped             = "market feed has been already stopped"
 	InvalidID                       = "invalid ID parameter"
+	UpstreamUnavailable             = "the upstream service is unavailable"
+	UpstreamTimeout                 = "the upstream service didn't respond in time"
+	UpstreamCircuitOpen             = "the upstream service is failing, try again later"
+	QuotaExceeded                   = "usage quota exceeded"
+	InvalidApiKey                   = "expired, revoked or invalid API key"
+	InvalidClient                   = "invalid client credentials"
+	InvalidScope                    = "the requested scope isn't allowed for the client"
+	UnauthorizedGrant               = "the client isn't allowed to use this grant type"
+	InvalidGrant                    = "expired, used or invalid authorization code"
+	InvalidRedirectUri              = "the redirect_uri isn't registered for the client"
+	SigningKeysUnavailable          = "the gateway has no token signing keys"
+	UnauthorizedClient              = "the token wasn't issued to the client"
+	RefreshTokenReused              = "the refresh token was already used, the session has been revoked"
+	InvalidMfaToken                 = "expired or invalid MFA token, login again"
+	InvalidMfaCode                  = "invalid MFA code"
+	MfaAlreadyEnabled               = "MFA is already enabled, disable it first"
+	MfaNotEnrolled                  = "MFA isn't enabled"
+	MfaRequired                     = "MFA is mandatory for your role"
+	LoginLocked                     = "too many failed logins, try again later"
+	InvalidResetCode                = "expired, used or invalid password reset code"
+	IncorrectPassword               = "the current password is incorrect"
+	InvalidVerificationToken        = "expired, used or invalid email verification link"
+	RegistrationDisabled            = "registration is disabled"
+	AccountAlreadyExists            = "the username or the email is already registered"
+	RoleNotFound                    = "the role doesn't exist"
+	CannotModifySelf                = "you can't deactivate or delete your own account"
+	SessionNotFound                 = "the session doesn't exist or has ended"
+	CannotRevokeCurrentSession      = "the current session can't be revoked, logout instead"
+	SessionsLimit                   = "too many active sessions, logout from another device first"
+	CannotImpersonate               = "this user can't be impersonated"
+	ImpersonationRestricted         = "this action isn't allowed while impersonating a user"
+	WeakPassword                    = "the password doesn't meet the password policy"
+	InvalidCredentials              = "incorrect username or password"
+	DirectoryAccount                = "the directory account isn't allowed to sign in"
+	ExternalAccount                 = "the password of the account is managed by its directory"
+	ConsentRequiresUser             = "only a signed in user can authorize a client"
 )
 
 var (
@@ -72,6 +108,42 @@ var (
 	ErrInvalidID                       = errors.New(InvalidID)
 	ErrUnauthorizedToAccessResource    = errors.New(UnauthorizedToAccessResource)
 	ErrMissingAuthoirzationHeader      = errors.New(MissingAuthoirzationHeader)
+	ErrUpstreamUnavailable             = errors.New(UpstreamUnavailable)
+	ErrUpstreamTimeout                 = errors.New(UpstreamTimeout)
+	ErrUpstreamCircuitOpen             = errors.New(UpstreamCircuitOpen)
+	ErrQuotaExceeded                   = errors.New(QuotaExceeded)
+	ErrInvalidApiKey                   = errors.New(InvalidApiKey)
+	ErrInvalidClient                   = errors.New(InvalidClient)
+	ErrInvalidScope                    = errors.New(InvalidScope)
+	ErrUnauthorizedGrant               = errors.New(UnauthorizedGrant)
+	ErrInvalidGrant                    = errors.New(InvalidGrant)
+	ErrInvalidRedirectUri              = errors.New(InvalidRedirectUri)
+	ErrSigningKeysUnavailable          = errors.New(SigningKeysUnavailable)
+	ErrUnauthorizedClient              = errors.New(UnauthorizedClient)
+	ErrRefreshTokenReused              = errors.New(RefreshTokenReused)
+	ErrInvalidMfaToken                 = errors.New(InvalidMfaToken)
+	ErrInvalidMfaCode                  = errors.New(InvalidMfaCode)
+	ErrMfaAlreadyEnabled               = errors.New(MfaAlreadyEnabled)
+	ErrMfaNotEnrolled                  = errors.New(MfaNotEnrolled)
+	ErrMfaRequired                     = errors.New(MfaRequired)
+	ErrLoginLocked                     = errors.New(LoginLocked)
+	ErrInvalidResetCode                = errors.New(InvalidResetCode)
+	ErrIncorrectPassword               = errors.New(IncorrectPassword)
+	ErrInvalidVerificationToken        = errors.New(InvalidVerificationToken)
+	ErrRegistrationDisabled            = errors.New(RegistrationDisabled)
+	ErrAccountAlreadyExists            = errors.New(AccountAlreadyExists)
+	ErrRoleNotFound                    = errors.New(RoleNotFound)
+	ErrCannotModifySelf                = errors.New(CannotModifySelf)
+	ErrSessionNotFound                 = errors.New(SessionNotFound)
+	ErrCannotRevokeCurrentSession      = errors.New(CannotRevokeCurrentSession)
+	ErrSessionsLimit                   = errors.New(SessionsLimit)
+	ErrCannotImpersonate               = errors.New(CannotImpersonate)
+	ErrImpersonationRestricted         = errors.New(ImpersonationRestricted)
+	ErrWeakPassword                    = errors.New(WeakPassword)
+	ErrInvalidCredentials              = errors.New(InvalidCredentials)
+	ErrDirectoryAccount                = errors.New(DirectoryAccount)
+	ErrExternalAccount                 = errors.New(ExternalAccount)
+	ErrConsentRequiresUser             = errors.New(ConsentRequiresUser)
 )
 
 type HttpErrorResponse struct {
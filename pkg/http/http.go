@@ -20,6 +20,7 @@ const (
 	LocalsDevice  = "device"
 	LocalsOs      = "os"
 	LocalsChannel = "channel"
+	LocalsRoute   = "route"
 )
 
 const (
@@ -31,6 +32,10 @@ const (
 	StatusOK                  = fiber.StatusOK
 	StatusCreated             = fiber.StatusCreated
 	StatusNoContent           = fiber.StatusNoContent
+	StatusBadGateway          = fiber.StatusBadGateway
+	StatusGatewayTimeout      = fiber.StatusGatewayTimeout
+	StatusServiceUnavailable  = fiber.StatusServiceUnavailable
+	StatusTooManyRequests     = fiber.StatusTooManyRequests
 )
 
 const (
@@ -43,6 +48,10 @@ const (
 	ErrBadQueryParams      = "Invalid query params"
 	ErrRequestTimeout      = "Request Timeout"
 	ErrEndpointNotFound    = "The endpoint you requested doesn't exist on server"
+	ErrBadGateway          = "Bad gateway"
+	ErrGatewayTimeout      = "Gateway timeout"
+	ErrServiceUnavailable  = "Service unavailable"
+	ErrTooManyRequests     = "Too many requests"
 )
 
 type App struct {
@@ -208,6 +217,57 @@ func (a *App) HttpResponseUnauthorized(c *fiber.Ctx, message error) error {
 		})
 }
 
+// http 502 the gateway couldn't get a valid response from the upstream service
+func (a *App) HttpResponseBadGateway(c *fiber.Ctx, message error) error {
+	a.Log.Logger.Error(message.Error())
+	return c.Status(StatusBadGateway).JSON(
+		&HttpResponse{
+			Success: false,
+			Code:    StatusBadGateway,
+			Data:    nil,
+			Error:   ErrBadGateway,
+			Message: message.Error(),
+		})
+}
+
+// http 504 the upstream service didn't respond in time
+func (a *App) HttpResponseGatewayTimeout(c *fiber.Ctx, message error) error {
+	a.Log.Logger.Error(message.Error())
+	return c.Status(StatusGatewayTimeout).JSON(
+		&HttpResponse{
+			Success: false,
+			Code:    StatusGatewayTimeout,
+			Data:    nil,
+			Error:   ErrGatewayTimeout,
+			Message: message.Error(),
+		})
+}
+
+// http 503 the upstream service is temporarily not accepting requests
+func (a *App) HttpResponseServiceUnavailable(c *fiber.Ctx, message error) error {
+	a.Log.Logger.Error(message.Error())
+	return c.Status(StatusServiceUnavailable).JSON(
+		&HttpResponse{
+			Success: false,
+			Code:    StatusServiceUnavailable,
+			Data:    nil,
+			Error:   ErrServiceUnavailable,
+			Message: message.Error(),
+		})
+}
+
+// http 429 the client exceeded its rate limit
+func (a *App) HttpResponseTooManyRequests(c *fiber.Ctx, message error) error {
+	return c.Status(StatusTooManyRequests).JSON(
+		&HttpResponse{
+			Success: false,
+			Code:    StatusTooManyRequests,
+			Data:    nil,
+			Error:   ErrTooManyRequests,
+			Message: message.Error(),
+		})
+}
+
 // http 200 retrieve File response
 func (a *App) HttpResponseFile(c *fiber.Ctx, file []byte) error {
 	return c.Status(fiber.StatusOK).Send(file)
@@ -23,6 +23,14 @@ const (
 	Health_RSS               HealthKey = "RSS"
 )
 
+// prefix of the keys registered at runtime for each proxy upstream
+const healthUpstreamPrefix = "upstream:"
+
+// UpstreamHealthKey returns the health key of a proxy upstream e.g. upstream:http://orders:8080
+func UpstreamHealthKey(upstream string) HealthKey {
+	return HealthKey(healthUpstreamPrefix + upstream)
+}
+
 type HealthStatus int32
 
 const (
@@ -73,6 +81,9 @@ func InitMonitor() {
 type SystemHealth map[HealthKey]string
 
 func GetHealthStatus() SystemHealth {
+	locker.RLock()
+	defer locker.RUnlock()
+
 	sh := make(SystemHealth)
 	for k := range HealthMonitorList {
 		sh[k] = HealthStatus_name[HealthMonitorList[k]]
@@ -89,6 +100,25 @@ func ChangeStatus(h HealthKey, val HealthStatus) {
 	}
 }
 
+// AddService registers a service added at runtime, an existing service keeps its status
+func AddService(h HealthKey, val HealthStatus) {
+	locker.Lock()
+	defer locker.Unlock()
+
+	if _, ok := HealthMonitorList[h]; !ok {
+		HealthMonitorList[h] = val
+	}
+}
+
+// RemoveService stops monitoring a service added at runtime
+func RemoveService(h HealthKey) {
+	locker.Lock()
+	defer locker.Unlock()
+
+	delete(HealthMonitorList, h)
+	delete(serviceDetails, h)
+}
+
 // DetailedHealthStatus provides more comprehensive health information
 type DetailedHealthStatus struct {
 	Status    string                 `json:"status"`
@@ -9,6 +9,18 @@ import (
 	"github.com/nats-io/nats.go"
 )
 
+// Subjects shared between gateway replicas
+var (
+	SubjectProxyRoutesReload = "gateway.system.routes.reload"
+	SubjectConfigsReload     = "gateway.system.configs.reload"
+	// sessions logged out on a replica, the replica holding the websocket of the session closes it
+	SubjectSessionsDisconnect = "gateway.sessions.disconnect"
+	// security events e.g. a reused refresh token, for alerting
+	SubjectSecurityEvents = "gateway.security.events"
+	// user lifecycle events e.g. a registration
+	SubjectUserEvents = "gateway.user.events"
+)
+
 type Nats struct {
 	NC *nats.Conn
 }
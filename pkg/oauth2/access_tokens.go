@@ -0,0 +1,154 @@
+package oauth2
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Access token formats, opaque tokens are resolved in redis on every request while
+// JWT access tokens are verified locally and only checked against the revocation list
+const (
+	TokenFormatOpaque = "opaque"
+	TokenFormatJWT    = "jwt"
+)
+
+// typ header of the JWT access tokens (RFC 9068), id tokens are signed by the same keys
+const AccessTokenType = "at+jwt"
+
+type AccessTokenClaims struct {
+	jwt.RegisteredClaims
+	// Casbin role of the user
+	Scope     string `json:"scope"`
+	SessionId string `json:"sid,omitempty"`
+	// OAuth client the token was issued to
+	ClientId string `json:"client_id,omitempty"`
+	Email    string `json:"email,omitempty"`
+	// null means everything the role allows
+	Resources []string `json:"resources"`
+	// admin impersonating the subject
+	Actor *ActorClaims `json:"act,omitempty"`
+}
+
+// ActorClaims is the party acting on behalf of the subject, RFC 8693
+type ActorClaims struct {
+	Subject string `json:"sub"`
+}
+
+// newAccessToken sets the access token of the config, a JWT when the gateway issues them
+// in which case its jti is returned, the token row stores the jti instead of the token
+func (o *OAuth2) newAccessToken(config *Config) (string, error) {
+	if o.TokenFormat != TokenFormatJWT || o.Keys == nil {
+		config.AccessToken = o.GenerateToken()
+		return "", nil
+	}
+
+	now := time.Now()
+	claims := &AccessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Issuer:    o.Issuer,
+			Subject:   strconv.Itoa(int(config.ClientId)),
+			Audience:  jwt.ClaimStrings{o.Audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Duration(o.accessTokenExpiresIn(config)) * time.Second)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		Scope:     config.Scope,
+		SessionId: config.SessionId,
+		ClientId:  config.ClientSecretId,
+		Email:     config.Email,
+		Resources: config.Resources,
+	}
+	if config.ImpersonatorId != 0 {
+		claims.Actor = &ActorClaims{Subject: strconv.Itoa(int(config.ImpersonatorId))}
+	}
+
+	token, err := o.Keys.SignWithType(claims, AccessTokenType)
+	if err != nil {
+		return "", err
+	}
+	config.AccessToken = token
+
+	return claims.ID, nil
+}
+
+// accessTokenExpiresIn is the lifetime of the access tokens of the config in seconds, a config
+// can shorten it, e.g. an impersonation session, but not extend it
+func (o *OAuth2) accessTokenExpiresIn(config *Config) int {
+	if config.ExpiresIn > 0 && config.ExpiresIn < o.TokenExpiresIn {
+		return config.ExpiresIn
+	}
+	return o.TokenExpiresIn
+}
+
+// IsJWT reports whether the access token is a JWT rather than an opaque token
+func IsJWT(accessToken string) bool {
+	return strings.Count(accessToken, ".") == 2
+}
+
+// inspectJWT verifies the JWT access token locally, invalid, expired and revoked tokens
+// return redis.Nil like unknown opaque tokens so callers handle both formats alike
+func (o *OAuth2) inspectJWT(accessToken string) (*Config, error) {
+	if o.Keys == nil || o.Revocations == nil {
+		return nil, redis.Nil
+	}
+
+	claims := &AccessTokenClaims{}
+	token, err := o.Keys.Parse(accessToken, claims, jwt.WithIssuer(o.Issuer), jwt.WithAudience(o.Audience), jwt.WithExpirationRequired())
+	if err != nil || token.Header["typ"] != AccessTokenType {
+		return nil, redis.Nil
+	}
+
+	if o.Revocations.IsRevoked(RevokedJti(claims.ID), RevokedSession(claims.SessionId)) {
+		return nil, redis.Nil
+	}
+
+	userId, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return nil, redis.Nil
+	}
+
+	config := &Config{
+		ClientId:       int32(userId),
+		ClientSecretId: claims.ClientId,
+		Email:          claims.Email,
+		AccessToken:    accessToken,
+		SessionId:      claims.SessionId,
+		Scope:          claims.Scope,
+		ExpiresIn:      int(time.Until(claims.ExpiresAt.Time).Seconds()),
+		StartedAt:      claims.IssuedAt.Time,
+		LastActivity:   time.Now(),
+		Resources:      claims.Resources,
+		Jti:            claims.ID,
+	}
+	if claims.Actor != nil {
+		impersonatorId, err := strconv.Atoi(claims.Actor.Subject)
+		if err != nil {
+			return nil, redis.Nil
+		}
+		config.ImpersonatorId = int32(impersonatorId)
+	}
+
+	return config, nil
+}
+
+// revokeJti revokes a JWT access token, it can't outlive the access token expiration
+func (o *OAuth2) revokeJti(ctx context.Context, jti string) error {
+	if jti == "" || o.Revocations == nil {
+		return nil
+	}
+	return o.Revocations.Revoke(ctx, RevokedJti(jti), time.Now().Add(time.Duration(o.TokenExpiresIn)*time.Second))
+}
+
+// revokeSession revokes every JWT access token of the session
+func (o *OAuth2) revokeSession(ctx context.Context, sessionId string) error {
+	if sessionId == "" || o.Revocations == nil {
+		return nil
+	}
+	return o.Revocations.Revoke(ctx, RevokedSession(sessionId), time.Now().Add(time.Duration(o.TokenExpiresIn)*time.Second))
+}
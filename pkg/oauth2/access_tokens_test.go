@@ -0,0 +1,79 @@
+package oauth2
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTAccessToken(t *testing.T) {
+	keys := []*signingKey{newTestKey(t, "current", SigningAlgRS256, time.Now().Add(-time.Minute))}
+	k := &KeySet{}
+	k.keys.Store(&keys)
+
+	o := &OAuth2{
+		Keys:           k,
+		Revocations:    &RevocationList{revoked: make(map[string]time.Time)},
+		TokenFormat:    TokenFormatJWT,
+		TokenExpiresIn: 60,
+		Issuer:         "https://gateway.greenlync.com",
+		Audience:       "greenlync-api-gateway",
+	}
+
+	config := &Config{ClientId: 7, Scope: "User", SessionId: "s1", Email: "user@greenlync.com", Resources: []string{"usage_read"}}
+	jti, err := o.newAccessToken(config)
+	require.NoError(t, err)
+	require.NotEmpty(t, jti)
+	require.True(t, IsJWT(config.AccessToken))
+
+	inspected, err := o.inspectJWT(config.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, int32(7), inspected.ClientId)
+	require.Equal(t, "User", inspected.Scope)
+	require.Equal(t, "s1", inspected.SessionId)
+	require.Equal(t, []string{"usage_read"}, inspected.Resources)
+	require.LessOrEqual(t, inspected.ExpiresIn, 60)
+
+	// unrestricted tokens stay unrestricted
+	unrestricted := &Config{ClientId: 7, Scope: "User", SessionId: "s2"}
+	_, err = o.newAccessToken(unrestricted)
+	require.NoError(t, err)
+	inspected, err = o.inspectJWT(unrestricted.AccessToken)
+	require.NoError(t, err)
+	require.Nil(t, inspected.Resources)
+
+	// an id token signed by the same keys isn't an access token
+	idToken, err := k.Sign(&IdTokenClaims{RegisteredClaims: jwt.RegisteredClaims{
+		Issuer:    o.Issuer,
+		Subject:   "7",
+		Audience:  jwt.ClaimStrings{o.Audience},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}})
+	require.NoError(t, err)
+	_, err = o.inspectJWT(idToken)
+	require.Equal(t, redis.Nil, err)
+
+	// revoking the session revokes every token of the session
+	o.Revocations.add(RevokedSession("s1"), time.Now().Add(time.Minute))
+	_, err = o.inspectJWT(config.AccessToken)
+	require.Equal(t, redis.Nil, err)
+
+	o.Revocations.add(RevokedJti(jti), time.Now().Add(time.Minute))
+	require.True(t, o.Revocations.IsRevoked(RevokedJti(jti)))
+
+	// revocations are forgotten once the tokens expired anyway
+	o.Revocations.add(RevokedSession("s2"), time.Now().Add(-time.Second))
+	_, err = o.inspectJWT(unrestricted.AccessToken)
+	require.NoError(t, err)
+
+	// opaque tokens have no jti
+	o.TokenFormat = TokenFormatOpaque
+	opaque := &Config{ClientId: 7}
+	jti, err = o.newAccessToken(opaque)
+	require.NoError(t, err)
+	require.Empty(t, jti)
+	require.False(t, IsJWT(opaque.AccessToken))
+}
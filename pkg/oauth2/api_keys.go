@@ -0,0 +1,163 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/cache"
+	"greenlync-api-gateway/pkg/errors"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/goccy/go-json"
+	"gorm.io/gorm"
+)
+
+// ApiKeyHeader is the request header carrying the API key
+const ApiKeyHeader = "X-API-Key"
+
+var (
+	// every key starts with the prefix so secret scanners can recognize leaked keys
+	ApiKeyPrefix = "glk_"
+	// random characters after the prefix
+	ApiKeyLength = 40
+	// how long a verified key is cached, revoking a key drops it from the cache right away
+	ApiKeyCacheTTL = 60
+)
+
+// GenerateApiKey returns a new random API key and its hash
+func GenerateApiKey() (string, string, error) {
+	s, err := randomString(ApiKeyLength)
+	if err != nil {
+		return "", "", err
+	}
+
+	key := ApiKeyPrefix + s
+	return key, HashApiKey(key), nil
+}
+
+// HashApiKey returns the hex encoded SHA-256 of the key, the keys are random enough
+// that a slow password hash isn't needed
+func HashApiKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// InspectApiKey returns the client config of an API key, the last use of the key is
+// updated whenever it isn't cached anymore
+func (o *OAuth2) InspectApiKey(ctx context.Context, key, ipAddr string) (*Config, error) {
+	if !strings.HasPrefix(key, ApiKeyPrefix) {
+		return nil, errors.ErrInvalidApiKey
+	}
+
+	hash := HashApiKey(key)
+	js, err := o.Cache.Get(ctx, cache.ApiKeysKey(hash))
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	config := &Config{}
+	if js != "" {
+		err = json.Unmarshal([]byte(js), config)
+		if err != nil {
+			return nil, err
+		}
+		return config, nil
+	}
+
+	apiKey := &model.ApiKey{}
+	err = o.DB.Where("hash = ? AND revoked_at IS NULL", hash).First(apiKey).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrInvalidApiKey
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if apiKey.ExpiresAt != nil && !now.Before(*apiKey.ExpiresAt) {
+		return nil, errors.ErrInvalidApiKey
+	}
+
+	user := &model.User{}
+	err = o.DB.Where("id = ? AND is_active = ?", apiKey.UserId, true).First(user).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrInvalidApiKey
+		}
+		return nil, err
+	}
+
+	config = &Config{
+		ClientId:     user.Id,
+		Email:        user.Email,
+		Scope:        user.Role,
+		IpAddress:    ipAddr,
+		StartedAt:    now,
+		LastActivity: now,
+		ApiKeyId:     apiKey.Id,
+		Resources:    apiKey.Resources,
+	}
+
+	err = o.DB.Model(apiKey).Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": ipAddr}).Error
+	if err != nil {
+		o.Log.Logger.Errorf("error updating last use of api key %d: %v", apiKey.Id, err)
+	}
+
+	b, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// a cached key must not outlive its expiry
+	ttl := ApiKeyCacheTTL
+	if apiKey.ExpiresAt != nil {
+		if left := int(apiKey.ExpiresAt.Sub(now).Seconds()); left < ttl {
+			ttl = left
+		}
+	}
+	if ttl <= 0 {
+		return config, nil
+	}
+
+	err = o.Cache.Set(ctx, cache.ApiKeysKey(hash), b, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// RevokeApiKey revokes the key and drops it from the cache
+func (o *OAuth2) RevokeApiKey(ctx context.Context, apiKey *model.ApiKey) error {
+	now := time.Now()
+	err := o.DB.Model(apiKey).Update("revoked_at", now).Error
+	if err != nil {
+		return err
+	}
+	apiKey.RevokedAt = &now
+
+	return o.Cache.Delete(ctx, cache.ApiKeysKey(apiKey.Hash))
+}
+
+// ForgetUserApiKeys drops the cached configs of every key of the user, they carry the role and
+// were verified while the user was active
+func (o *OAuth2) ForgetUserApiKeys(ctx context.Context, userId int32) error {
+	hashes := []string{}
+	err := o.DB.Model(&model.ApiKey{}).Where("user_id = ? AND revoked_at IS NULL", userId).Pluck("hash", &hashes).Error
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range hashes {
+		err = o.Cache.Delete(ctx, cache.ApiKeysKey(hash))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package oauth2
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateApiKey(t *testing.T) {
+	key, hash, err := GenerateApiKey()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(key, ApiKeyPrefix))
+	require.Len(t, key, len(ApiKeyPrefix)+ApiKeyLength)
+	require.Equal(t, HashApiKey(key), hash)
+	require.Len(t, hash, 64)
+
+	other, _, err := GenerateApiKey()
+	require.NoError(t, err)
+	require.NotEqual(t, key, other)
+}
+
+func TestConfigAllows(t *testing.T) {
+	session := &Config{ClientId: 1, Scope: "Admin"}
+	require.True(t, session.Allows("usage_read"))
+
+	apiKey := &Config{ClientId: 1, Scope: "Admin", ApiKeyId: 3, Resources: []string{"usage_read"}}
+	require.True(t, apiKey.Allows("usage_read"))
+	require.False(t, apiKey.Allows("routes_manage"))
+}
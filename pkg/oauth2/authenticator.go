@@ -0,0 +1,136 @@
+package oauth2
+
+import (
+	"context"
+	"fmt"
+
+	"greenlync-api-gateway/config"
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/errors"
+
+	"gorm.io/gorm"
+)
+
+// Authenticator is a backend checking the credentials of the password logins. A wrong password or
+// an unknown user is ErrInvalidCredentials, the user is returned with it when the backend knows it
+// so the failed login is attributed
+type Authenticator interface {
+	// Name of the backend as listed in AUTH_BACKENDS
+	Name() string
+	Authenticate(ctx context.Context, username, password string) (*model.User, error)
+}
+
+// UseAuthenticators replaces the authentication backends by the listed ones, tried in order
+func (o *OAuth2) UseAuthenticators(backends []string, ldapCfg config.LDAP) error {
+	authenticators := make([]Authenticator, 0, len(backends))
+	for _, backend := range backends {
+		switch backend {
+		case model.AuthSource_Local:
+			authenticators = append(authenticators, NewLocalAuthenticator(o))
+		case model.AuthSource_LDAP:
+			ldap, err := NewLDAPAuthenticator(o, ldapCfg)
+			if err != nil {
+				return err
+			}
+			authenticators = append(authenticators, ldap)
+		default:
+			return fmt.Errorf("unknown authentication backend %q", backend)
+		}
+	}
+	if len(authenticators) == 0 {
+		return fmt.Errorf("no authentication backend")
+	}
+
+	o.Authenticators = authenticators
+	return nil
+}
+
+// Authenticate checks the credentials against the authentication backends in order and returns
+// the user of the first one accepting them. A backend that fails doesn't stop the next ones, its
+// error is only returned if no backend knows the user
+func (o *OAuth2) Authenticate(ctx context.Context, username, password string) (*model.User, error) {
+	var known *model.User
+	var failure error
+	for _, authenticator := range o.Authenticators {
+		user, err := authenticator.Authenticate(ctx, username, password)
+		if err == nil {
+			return user, nil
+		}
+
+		switch err {
+		case errors.ErrInvalidCredentials:
+			if known == nil {
+				known = user
+			}
+		case errors.ErrDirectoryAccount:
+			return user, err
+		default:
+			o.Log.Logger.Errorf("error authenticating %s with the %s backend: %v", username, authenticator.Name(), err)
+			if failure == nil {
+				failure = err
+			}
+		}
+	}
+
+	if failure != nil && known == nil {
+		return nil, failure
+	}
+	return known, errors.ErrInvalidCredentials
+}
+
+// LocalAuthenticator checks the password hashes of the users stored in the database, a legacy or
+// outdated hash is replaced once the password is verified
+type LocalAuthenticator struct {
+	o *OAuth2
+}
+
+func NewLocalAuthenticator(o *OAuth2) *LocalAuthenticator {
+	return &LocalAuthenticator{o: o}
+}
+
+func (a *LocalAuthenticator) Name() string {
+	return model.AuthSource_Local
+}
+
+func (a *LocalAuthenticator) Authenticate(ctx context.Context, username, password string) (*model.User, error) {
+	user := &model.User{}
+	err := a.o.DB.WithContext(ctx).
+		Where("(id = ? OR username = ?) AND auth_source = ?", username, username, model.AuthSource_Local).
+		First(user).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if !ComparePassword(user.PasswordHash, password) {
+		return user, errors.ErrInvalidCredentials
+	}
+
+	if NeedsRehash(user.PasswordHash) {
+		a.rehash(ctx, user, password)
+	}
+
+	return user, nil
+}
+
+// rehash replaces the hash of the user by a hash of the default parameters, the password is only
+// known at login. A failure is only logged, the old hash still verifies
+func (a *LocalAuthenticator) rehash(ctx context.Context, user *model.User, password string) {
+	hash, err := EncryptPassword(password)
+	if err != nil {
+		a.o.Log.Logger.Errorf("error rehashing the password of user %d: %v", user.Id, err)
+		return
+	}
+
+	// the hash is only replaced if the password didn't change meanwhile
+	err = a.o.DB.WithContext(ctx).Model(&model.User{}).
+		Where("id = ? AND password_hash = ?", user.Id, user.PasswordHash).
+		Update("password_hash", hash).Error
+	if err != nil {
+		a.o.Log.Logger.Errorf("error rehashing the password of user %d: %v", user.Id, err)
+		return
+	}
+	user.PasswordHash = hash
+}
@@ -0,0 +1,91 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"regexp"
+
+	"greenlync-api-gateway/pkg/cache"
+	"greenlync-api-gateway/pkg/errors"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/goccy/go-json"
+)
+
+// PKCE code challenge methods, only S256 is accepted
+const CodeChallengeMethodS256 = "S256"
+
+var (
+	// authorization codes are short-lived and can only be exchanged once
+	AuthorizationCodeTTL = 60
+	// random characters of an authorization code
+	AuthorizationCodeLength = 48
+)
+
+// RFC 7636 code verifier, 43 to 128 unreserved characters
+var codeVerifierRegex = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// AuthorizationCode is what the user approved, stored in redis until the client exchanges it
+type AuthorizationCode struct {
+	ClientId      string
+	UserId        int32
+	RedirectUri   string
+	Resources     []string
+	CodeChallenge string
+	// OpenID Connect nonce, echoed in the id token
+	Nonce string
+}
+
+// NewAuthorizationCode stores the approval and returns the code the client exchanges for tokens
+func (o *OAuth2) NewAuthorizationCode(ctx context.Context, authCode *AuthorizationCode) (string, error) {
+	code, err := randomString(AuthorizationCodeLength)
+	if err != nil {
+		return "", err
+	}
+
+	js, err := json.Marshal(authCode)
+	if err != nil {
+		return "", err
+	}
+
+	err = o.Cache.Set(ctx, cache.AuthCodeKey(code), js, AuthorizationCodeTTL)
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// ExchangeAuthorizationCode consumes the code, a code can't be used twice even if the exchange fails
+func (o *OAuth2) ExchangeAuthorizationCode(ctx context.Context, code string) (*AuthorizationCode, error) {
+	js, err := o.Cache.GetDel(ctx, cache.AuthCodeKey(code))
+	if err != nil {
+		if err == redis.Nil {
+			return nil, errors.ErrInvalidGrant
+		}
+		return nil, err
+	}
+
+	authCode := &AuthorizationCode{}
+	err = json.Unmarshal([]byte(js), authCode)
+	if err != nil {
+		return nil, err
+	}
+
+	return authCode, nil
+}
+
+// CodeChallengeS256 returns the S256 code challenge of the code verifier
+func CodeChallengeS256(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// VerifyCodeVerifier checks the code verifier matches the S256 code challenge
+func VerifyCodeVerifier(verifier, challenge string) bool {
+	if !codeVerifierRegex.MatchString(verifier) {
+		return false
+	}
+	return CodeChallengeS256(verifier) == challenge
+}
@@ -0,0 +1,23 @@
+package oauth2
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyCodeVerifier(t *testing.T) {
+	// RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	require.Equal(t, challenge, CodeChallengeS256(verifier))
+	require.True(t, VerifyCodeVerifier(verifier, challenge))
+	require.False(t, VerifyCodeVerifier(verifier+"x", challenge))
+
+	// too short or with invalid characters
+	require.False(t, VerifyCodeVerifier("abc", CodeChallengeS256("abc")))
+	invalid := strings.Repeat("a", 42) + "!"
+	require.False(t, VerifyCodeVerifier(invalid, CodeChallengeS256(invalid)))
+}
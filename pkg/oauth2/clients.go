@@ -0,0 +1,180 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/rand"
+	"math/big"
+	"strings"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/errors"
+
+	"github.com/goccy/go-json"
+	"gorm.io/gorm"
+)
+
+var (
+	ClientIdLength     = 24
+	ClientSecretLength = 48
+)
+
+// randomString returns n random characters of letterBytes from a secure source
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	for i := range b {
+		r, err := rand.Int(rand.Reader, big.NewInt(int64(len(letterBytes))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = letterBytes[r.Int64()]
+	}
+	return string(b), nil
+}
+
+// GenerateClientCredentials returns a new client id and client secret
+func GenerateClientCredentials() (string, string, error) {
+	clientId, err := randomString(ClientIdLength)
+	if err != nil {
+		return "", "", err
+	}
+
+	secret, err := randomString(ClientSecretLength)
+	if err != nil {
+		return "", "", err
+	}
+
+	return clientId, secret, nil
+}
+
+// ParseScope parses a space separated scope request, every requested scope must be
+// allowed and an empty request is granted all the allowed scopes
+func ParseScope(scope string, allowed []string) ([]string, error) {
+	requested := strings.Fields(scope)
+	if len(requested) == 0 {
+		return append([]string{}, allowed...), nil
+	}
+
+	for _, r := range requested {
+		ok := false
+		for _, a := range allowed {
+			if r == a {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return nil, errors.ErrInvalidScope
+		}
+	}
+
+	return requested, nil
+}
+
+// AuthenticateClient returns the active client matching the credentials
+func (o *OAuth2) AuthenticateClient(ctx context.Context, clientId, secret string) (*model.OAuthClient, error) {
+	client := &model.OAuthClient{}
+	err := o.DB.WithContext(ctx).Where("client_id = ? AND is_active = ?", clientId, true).First(client).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrInvalidClient
+		}
+		return nil, err
+	}
+
+	if !ComparePassword(client.SecretHash, secret) {
+		return nil, errors.ErrInvalidClient
+	}
+
+	return client, nil
+}
+
+// ClientCredentialsToken issues an access token bound to the client, there is no
+// refresh token and no session so it isn't logged out when idle and expires with the token
+func (o *OAuth2) ClientCredentialsToken(ctx context.Context, config *Config) (*Config, error) {
+	config.StartedAt = time.Now()
+	config.LastActivity = time.Now()
+	config.ExpiresIn = o.TokenExpiresIn
+	jti, err := o.newAccessToken(config)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &model.Token{
+		AccessToken: config.AccessToken,
+		ExpiresAt:   config.StartedAt.Add(time.Duration(config.ExpiresIn) * time.Second),
+		ExpiresIn:   config.ExpiresIn,
+		Scope:       config.Scope,
+		Resources:   config.Resources,
+		IpAddress:   config.IpAddress,
+		UserAgent:   config.UserAgent,
+		UserId:      config.ClientId,
+		ClientId:    config.ClientSecretId,
+	}
+	if jti != "" {
+		token.AccessToken = ""
+		token.Jti = jti
+	}
+
+	err = o.DB.Create(token).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// JWT access tokens are verified without the cache
+	if jti != "" {
+		return config, nil
+	}
+
+	js, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	err = o.Cache.Set(ctx, config.AccessToken, js, config.ExpiresIn)
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// RevokeClientTokens deletes the unexpired access tokens issued to the client and logs out the
+// sessions of the users who authorized it
+func (o *OAuth2) RevokeClientTokens(ctx context.Context, clientId string) error {
+	tokens := []*model.Token{}
+	err := o.DB.Where("client_id = ? AND expires_at > ?", clientId, time.Now()).Find(&tokens).Error
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tokens {
+		if t.Jti != "" {
+			err = o.revokeJti(ctx, t.Jti)
+		} else {
+			err = o.Cache.Delete(ctx, t.AccessToken)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// the sessions of the code flow have no expiry, they last until logged out
+	sessionIds := []string{}
+	err = o.DB.WithContext(ctx).Model(&model.Token{}).
+		Joins("JOIN greenlync_session ON greenlync_session.session_id = greenlync_token.session_id AND greenlync_session.finished_at IS NULL").
+		Where("greenlync_token.client_id = ?", clientId).
+		Distinct().Pluck("greenlync_token.session_id", &sessionIds).Error
+	if err != nil {
+		return err
+	}
+
+	for _, sessionId := range sessionIds {
+		err = o.RevokeSession(ctx, sessionId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
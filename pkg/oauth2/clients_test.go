@@ -0,0 +1,37 @@
+package oauth2
+
+import (
+	"testing"
+
+	"greenlync-api-gateway/pkg/errors"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateClientCredentials(t *testing.T) {
+	clientId, secret, err := GenerateClientCredentials()
+	require.NoError(t, err)
+	require.Len(t, clientId, ClientIdLength)
+	require.Len(t, secret, ClientSecretLength)
+	require.NotEqual(t, clientId, secret)
+}
+
+func TestParseScope(t *testing.T) {
+	allowed := []string{"usage_read", "routes_read"}
+
+	scopes, err := ParseScope("", allowed)
+	require.NoError(t, err)
+	require.Equal(t, allowed, scopes)
+
+	scopes, err = ParseScope(" routes_read ", allowed)
+	require.NoError(t, err)
+	require.Equal(t, []string{"routes_read"}, scopes)
+
+	_, err = ParseScope("usage_read routes_manage", allowed)
+	require.Equal(t, errors.ErrInvalidScope, err)
+
+	scopes, err = ParseScope("", nil)
+	require.NoError(t, err)
+	require.NotNil(t, scopes)
+	require.False(t, (&Config{Resources: scopes}).Allows("usage_read"))
+}
@@ -0,0 +1,93 @@
+package oauth2
+
+import (
+	"context"
+	"strconv"
+
+	"greenlync-api-gateway/pkg/cache"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// oneTimeCodes are random codes sent to a user e.g. by email, only their SHA-256 hash is stored,
+// the codes are random enough for it like the API keys. A user has one code at a time
+type oneTimeCodes struct {
+	// redis key of a code hash
+	key func(hash string) string
+	// redis key of the current code hash of a user
+	userKey func(userId int32) string
+}
+
+var (
+	passwordResetCodes     = &oneTimeCodes{key: cache.PasswordResetKey, userKey: cache.PasswordResetUserKey}
+	emailVerificationCodes = &oneTimeCodes{key: cache.EmailVerificationKey, userKey: cache.EmailVerificationUserKey}
+	deviceCodes            = &oneTimeCodes{key: cache.DeviceCodeKey, userKey: cache.DeviceCodeUserKey}
+)
+
+// new returns a new code of the user valid for ttl seconds, the previous code stops working
+func (t *oneTimeCodes) new(ctx context.Context, c *cache.Cache, userId int32, length, ttl int) (string, error) {
+	code, err := randomString(length)
+	if err != nil {
+		return "", err
+	}
+	hash := HashApiKey(code)
+
+	previous, err := c.Get(ctx, t.userKey(userId))
+	if err != nil && err != redis.Nil {
+		return "", err
+	}
+	if previous != "" {
+		err = c.Delete(ctx, t.key(previous))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = c.Set(ctx, t.key(hash), []byte(strconv.Itoa(int(userId))), ttl)
+	if err != nil {
+		return "", err
+	}
+	err = c.Set(ctx, t.userKey(userId), []byte(hash), ttl)
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// lookup returns the user of the code without using it. redis.Nil is returned for expired, used
+// or unknown codes
+func (t *oneTimeCodes) lookup(ctx context.Context, c *cache.Cache, code string) (int32, error) {
+	userId, err := c.Get(ctx, t.key(HashApiKey(code)))
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := strconv.Atoi(userId)
+	if err != nil {
+		return 0, redis.Nil
+	}
+
+	return int32(id), nil
+}
+
+// consume returns the user of the code, a code can't be used twice. redis.Nil is returned for
+// expired, used or unknown codes
+func (t *oneTimeCodes) consume(ctx context.Context, c *cache.Cache, code string) (int32, error) {
+	userId, err := c.GetDel(ctx, t.key(HashApiKey(code)))
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := strconv.Atoi(userId)
+	if err != nil {
+		return 0, redis.Nil
+	}
+
+	err = c.Delete(ctx, t.userKey(int32(id)))
+	if err != nil {
+		return 0, err
+	}
+
+	return int32(id), nil
+}
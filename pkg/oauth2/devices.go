@@ -0,0 +1,95 @@
+package oauth2
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IpSubnet returns the network a device is identified by, the /24 of an IPv4 and the /48 of an
+// IPv6 address so the dynamic addresses of a network are the same device. Invalid ips are kept
+func IpSubnet(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+// NewKnownDevice returns the device of a sign in of the user, its fingerprint ignores the browser
+// version and the host in the subnet so updates and dynamic ips don't make a new device
+func NewKnownDevice(userId int32, browser, os string, channel model.ChannelType, ip string) *model.KnownDevice {
+	subnet := IpSubnet(ip)
+	fingerprint := strings.Join([]string{
+		strings.ToLower(browser),
+		strings.ToLower(os),
+		strconv.Itoa(int(channel)),
+		subnet,
+	}, "|")
+
+	return &model.KnownDevice{
+		UserId:      userId,
+		Fingerprint: HashApiKey(fingerprint),
+		Browser:     browser,
+		OS:          os,
+		Channel:     channel,
+		Subnet:      subnet,
+		IpAddress:   ip,
+	}
+}
+
+// GetKnownDevice returns the device of the user with the fingerprint, nil if the user never
+// signed in from it
+func (o *OAuth2) GetKnownDevice(ctx context.Context, userId int32, fingerprint string) (*model.KnownDevice, error) {
+	device := &model.KnownDevice{}
+	err := o.DB.WithContext(ctx).Where("user_id = ? AND fingerprint = ?", userId, fingerprint).First(device).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return device, nil
+}
+
+// SeenDevice records a sign in from the device and reports whether the user never signed in
+// from it before, the device is updated with the stored one
+func (o *OAuth2) SeenDevice(ctx context.Context, device *model.KnownDevice) (bool, error) {
+	device.LastSeenAt = time.Now()
+
+	// concurrent sign ins from a new device only create it once
+	result := o.DB.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(device)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return true, nil
+	}
+
+	known, err := o.GetKnownDevice(ctx, device.UserId, device.Fingerprint)
+	if err != nil || known == nil {
+		return false, err
+	}
+
+	known.IpAddress = device.IpAddress
+	known.LastSeenAt = device.LastSeenAt
+	err = o.DB.WithContext(ctx).Model(known).Select("ip_address", "last_seen_at").Updates(known).Error
+	if err != nil {
+		return false, err
+	}
+	*device = *known
+
+	return false, nil
+}
@@ -0,0 +1,26 @@
+package oauth2
+
+import (
+	"testing"
+
+	model "greenlync-api-gateway/model/common/v1"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIpSubnet(t *testing.T) {
+	require.Equal(t, "203.0.113.0/24", IpSubnet("203.0.113.42"))
+	require.Equal(t, "2001:db8:abcd::/48", IpSubnet("2001:db8:abcd:12::1"))
+	require.Equal(t, "unknown", IpSubnet("unknown"))
+}
+
+func TestNewKnownDevice(t *testing.T) {
+	device := NewKnownDevice(1, "Chrome", "Windows", model.ChannelType_Web, "203.0.113.42")
+	require.Equal(t, "203.0.113.0/24", device.Subnet)
+
+	// another address of the network is the same device
+	require.Equal(t, device.Fingerprint, NewKnownDevice(1, "Chrome", "Windows", model.ChannelType_Web, "203.0.113.7").Fingerprint)
+
+	require.NotEqual(t, device.Fingerprint, NewKnownDevice(1, "Firefox", "Windows", model.ChannelType_Web, "203.0.113.42").Fingerprint)
+	require.NotEqual(t, device.Fingerprint, NewKnownDevice(1, "Chrome", "Windows", model.ChannelType_Web, "198.51.100.42").Fingerprint)
+}
@@ -0,0 +1,21 @@
+package oauth2
+
+import "strings"
+
+// actions of the Casbin resources an impersonation session can't use, the support staff reproduce
+// the issues of the user without deleting their data or taking over their credentials
+var ImpersonationRestrictedActions = []string{"delete", "manage", "changepassword"}
+
+// IsDestructive reports whether the resource is restricted to the sessions of the user itself
+func IsDestructive(resource string) bool {
+	_, action, ok := strings.Cut(resource, "_")
+	if !ok {
+		return false
+	}
+	for _, restricted := range ImpersonationRestrictedActions {
+		if action == restricted {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package oauth2
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestImpersonationAllows(t *testing.T) {
+	impersonation := &Config{ImpersonatorId: 1}
+	require.True(t, impersonation.Allows("myprofile_read"))
+	require.True(t, impersonation.Allows("myprofile_update"))
+	require.False(t, impersonation.Allows("myemails_delete"))
+	require.False(t, impersonation.Allows("myapikeys_manage"))
+	require.False(t, impersonation.Allows("myprofile_changepassword"))
+
+	// the resources of the user still apply
+	impersonation.Resources = []string{"usage_read"}
+	require.False(t, impersonation.Allows("myprofile_read"))
+
+	session := &Config{}
+	require.True(t, session.Allows("myemails_delete"))
+}
+
+func TestAccessTokenExpiresIn(t *testing.T) {
+	o := &OAuth2{TokenExpiresIn: 3600}
+	require.Equal(t, 3600, o.accessTokenExpiresIn(&Config{}))
+	require.Equal(t, 3600, o.accessTokenExpiresIn(&Config{ExpiresIn: 86400}))
+	require.Equal(t, 900, o.accessTokenExpiresIn(&Config{ExpiresIn: 900}))
+}
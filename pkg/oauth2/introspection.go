@@ -0,0 +1,200 @@
+package oauth2
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/errors"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+// token_type_hint values (RFC 7009, RFC 7662)
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+// Introspection is the RFC 7662 introspection response, only active is set for inactive tokens
+type Introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientId  string `json:"client_id,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+	Sid       string `json:"sid,omitempty"`
+}
+
+// scopeOf returns the role of unrestricted tokens or the resources the token is restricted to
+func scopeOf(role string, resources []string) string {
+	if resources != nil {
+		return strings.Join(resources, " ")
+	}
+	return role
+}
+
+// Introspect returns the state of an access or refresh token, the hint only decides which is looked up first
+func (o *OAuth2) Introspect(ctx context.Context, token, hint string) (*Introspection, error) {
+	if hint == TokenTypeHintRefreshToken {
+		row, err := o.activeRefreshToken(ctx, token)
+		if err != nil || row != nil {
+			return o.introspectRefreshToken(row), err
+		}
+		return o.introspectAccessToken(ctx, token)
+	}
+
+	i, err := o.introspectAccessToken(ctx, token)
+	if err != nil || i.Active {
+		return i, err
+	}
+
+	row, err := o.activeRefreshToken(ctx, token)
+	return o.introspectRefreshToken(row), err
+}
+
+func (o *OAuth2) introspectAccessToken(ctx context.Context, token string) (*Introspection, error) {
+	config, err := o.Inspect(ctx, token)
+	if err != nil {
+		if err == redis.Nil {
+			return &Introspection{}, nil
+		}
+		return nil, err
+	}
+
+	// API keys aren't OAuth tokens, the session cache entry isn't a token either
+	if config.ApiKeyId != 0 || config.AccessToken != token {
+		return &Introspection{}, nil
+	}
+
+	// the lifetime differs per token, impersonation tokens are shorter and remember me tokens longer
+	expiresIn := config.ExpiresIn
+	if expiresIn == 0 {
+		expiresIn = o.TokenExpiresIn
+	}
+
+	return &Introspection{
+		Active:    true,
+		Scope:     scopeOf(config.Scope, config.Resources),
+		ClientId:  config.ClientSecretId,
+		TokenType: "Bearer",
+		Exp:       config.StartedAt.Add(time.Duration(expiresIn) * time.Second).Unix(),
+		Iat:       config.StartedAt.Unix(),
+		Sub:       strconv.Itoa(int(config.ClientId)),
+		Iss:       o.Issuer,
+		Sid:       config.SessionId,
+	}, nil
+}
+
+func (o *OAuth2) introspectRefreshToken(row *model.Token) *Introspection {
+	if row == nil {
+		return &Introspection{}
+	}
+
+	// refresh tokens don't expire, they're valid as long as their session
+	return &Introspection{
+		Active:   true,
+		Scope:    scopeOf(row.Scope, row.Resources),
+		ClientId: row.ClientId,
+		Iat:      row.CreatedAt.Unix(),
+		Sub:      strconv.Itoa(int(row.UserId)),
+		Iss:      o.Issuer,
+		Sid:      row.SessionId,
+	}
+}
+
+// activeRefreshToken returns the token row of a refresh token that wasn't rotated nor revoked and
+// whose session wasn't logged out, nil otherwise
+func (o *OAuth2) activeRefreshToken(ctx context.Context, refreshToken string) (*model.Token, error) {
+	row := &model.Token{}
+	err := o.DB.WithContext(ctx).
+		Joins("JOIN greenlync_session ON greenlync_session.session_id = greenlync_token.session_id AND greenlync_session.finished_at IS NULL").
+		Where("greenlync_token.refresh_token = ? AND greenlync_token.consumed_at IS NULL AND greenlync_token.revoked_at IS NULL", refreshToken).
+		First(row).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return row, nil
+}
+
+// issuedTo reports whether the client may revoke a token issued to tokenClientId, first-party
+// logins have no client and can be revoked by the first-party clients
+func issuedTo(client *model.OAuthClient, tokenClientId string) bool {
+	if tokenClientId == "" {
+		return client.IsFirstParty
+	}
+	return tokenClientId == client.ClientId
+}
+
+// RevokeToken revokes an access or refresh token issued to the client (RFC 7009). Revoking a
+// refresh token logs its session out, which revokes the access tokens of the session as well, and
+// its session id is returned. Unknown tokens aren't an error
+func (o *OAuth2) RevokeToken(ctx context.Context, token, hint string, client *model.OAuthClient) (string, error) {
+	if hint != TokenTypeHintRefreshToken {
+		revoked, err := o.revokeAccessToken(ctx, token, client)
+		if err != nil || revoked {
+			return "", err
+		}
+	}
+
+	row, err := o.activeRefreshToken(ctx, token)
+	if err != nil {
+		return "", err
+	}
+	if row == nil {
+		if hint == TokenTypeHintRefreshToken {
+			_, err = o.revokeAccessToken(ctx, token, client)
+		}
+		return "", err
+	}
+
+	if !issuedTo(client, row.ClientId) {
+		return "", errors.ErrUnauthorizedClient
+	}
+
+	err = o.RevokeSession(ctx, row.SessionId)
+	if err != nil {
+		return "", err
+	}
+
+	return row.SessionId, nil
+}
+
+// revokeAccessToken revokes the access token if it's one, the session stays signed in
+func (o *OAuth2) revokeAccessToken(ctx context.Context, token string, client *model.OAuthClient) (bool, error) {
+	config, err := o.Inspect(ctx, token)
+	if err != nil {
+		if err == redis.Nil {
+			return false, nil
+		}
+		return false, err
+	}
+	if config.ApiKeyId != 0 || config.AccessToken != token {
+		return false, nil
+	}
+
+	if !issuedTo(client, config.ClientSecretId) {
+		return false, errors.ErrUnauthorizedClient
+	}
+
+	if config.Jti != "" {
+		err = o.revokeJti(ctx, config.Jti)
+	} else {
+		err = o.DeleteToken(ctx, token)
+	}
+	if err != nil && err != redis.Nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,26 @@
+package oauth2
+
+import (
+	"testing"
+
+	model "greenlync-api-gateway/model/common/v1"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssuedTo(t *testing.T) {
+	client := &model.OAuthClient{ClientId: "app"}
+	require.True(t, issuedTo(client, "app"))
+	require.False(t, issuedTo(client, "other"))
+
+	// first-party logins can only be revoked by first-party clients
+	require.False(t, issuedTo(client, ""))
+	client.IsFirstParty = true
+	require.True(t, issuedTo(client, ""))
+}
+
+func TestScopeOf(t *testing.T) {
+	require.Equal(t, "User", scopeOf("User", nil))
+	require.Equal(t, "usage_read myapikeys_read", scopeOf("User", []string{"usage_read", "myapikeys_read"}))
+	require.Equal(t, "", scopeOf("User", []string{}))
+}
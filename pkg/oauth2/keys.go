@@ -0,0 +1,317 @@
+package oauth2
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/logger"
+
+	"github.com/go-co-op/gocron"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Token signing algorithms
+const (
+	SigningAlgRS256 = "RS256"
+	SigningAlgEdDSA = "EdDSA"
+)
+
+var (
+	// every replica reloads the keys and rotates them when due on this interval
+	KeyReloadInterval = 1 * time.Minute
+	// a new key is published this long before it starts signing, so every replica and
+	// relying party caching the JWKS knows it before the first token signed with it
+	KeyPublishDelay = 5 * time.Minute
+	RSAKeyBits      = 2048
+)
+
+type signingKey struct {
+	kid       string
+	alg       string
+	notBefore time.Time
+	expiresAt time.Time
+	private   crypto.Signer
+	public    crypto.PublicKey
+}
+
+// KeySet holds the keys signing the tokens, they're stored in MySQL so every replica
+// shares them. The newest key that is already valid signs, older keys stay published for
+// the overlap so tokens they signed can still be verified until they expire
+type KeySet struct {
+	db  *gorm.DB
+	log *logger.Logger
+	alg string
+	// how long a key signs before the next one takes over
+	rotation time.Duration
+	// how long a key stays published once it stopped signing, the longest token lifetime
+	overlap time.Duration
+	keys    atomic.Pointer[[]*signingKey]
+}
+
+func NewKeySet(db *gorm.DB, log *logger.Logger, alg string, rotation, overlap time.Duration, cron *gocron.Scheduler) (*KeySet, error) {
+	if alg != SigningAlgRS256 && alg != SigningAlgEdDSA {
+		return nil, fmt.Errorf("unsupported signing algorithm %s, should be %s or %s", alg, SigningAlgRS256, SigningAlgEdDSA)
+	}
+	if rotation <= KeyPublishDelay {
+		return nil, fmt.Errorf("key rotation should be longer than %s", KeyPublishDelay)
+	}
+
+	k := &KeySet{
+		db:       db,
+		log:      log,
+		alg:      alg,
+		rotation: rotation,
+		overlap:  overlap,
+	}
+
+	err := k.refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = cron.Every(KeyReloadInterval).Do(func() {
+		if err := k.refresh(); err != nil {
+			k.log.Logger.Errorf("error refreshing signing keys: %v", err)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// Rotate publishes a new key which starts signing after KeyPublishDelay, the current
+// key keeps signing meanwhile and stays published until its tokens expire
+func (k *KeySet) Rotate() error {
+	err := k.createKey(time.Now().Add(KeyPublishDelay))
+	if err != nil {
+		return err
+	}
+	return k.reload()
+}
+
+// Keys returns the published keys, the newest first
+func (k *KeySet) Keys() []*model.SigningKey {
+	keys := make([]*model.SigningKey, 0)
+	for _, key := range *k.keys.Load() {
+		keys = append(keys, &model.SigningKey{Kid: key.kid, Algorithm: key.alg, NotBefore: key.notBefore, ExpiresAt: key.expiresAt})
+	}
+	return keys
+}
+
+// refresh rotates the keys when due and reloads them
+func (k *KeySet) refresh() error {
+	now := time.Now()
+
+	newest := &model.SigningKey{}
+	err := k.db.Order("not_before DESC").First(newest).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+
+	if err == gorm.ErrRecordNotFound {
+		// the very first key signs right away
+		err = k.createKey(now)
+	} else if !newest.NotBefore.Add(k.rotation).After(now.Add(KeyPublishDelay)) {
+		// publish the next key so it's known everywhere when the newest one is due, a key
+		// that is overdue (e.g. every replica was down) keeps signing meanwhile
+		err = k.createKey(now.Add(KeyPublishDelay))
+	}
+	if err != nil {
+		return err
+	}
+
+	err = k.db.Where("expires_at < ?", now).Delete(&model.SigningKey{}).Error
+	if err != nil {
+		return err
+	}
+
+	return k.reload()
+}
+
+func (k *KeySet) createKey(notBefore time.Time) error {
+	var private crypto.Signer
+	var err error
+	if k.alg == SigningAlgEdDSA {
+		_, private, err = ed25519.GenerateKey(nil)
+	} else {
+		private, err = rsa.GenerateKey(rand.Reader, RSAKeyBits)
+	}
+	if err != nil {
+		return err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+	pubDer, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return err
+	}
+
+	key := &model.SigningKey{
+		Kid:        uuid.NewString(),
+		Algorithm:  k.alg,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDer})),
+		NotBefore:  notBefore,
+		ExpiresAt:  notBefore.Add(k.rotation + k.overlap),
+	}
+
+	err = k.db.Create(key).Error
+	if err != nil {
+		return err
+	}
+
+	k.log.Logger.Infof("signing key %s published, signs from %s", key.Kid, key.NotBefore.UTC().Format(time.RFC3339))
+	return nil
+}
+
+func (k *KeySet) reload() error {
+	rows := []*model.SigningKey{}
+	err := k.db.Where("expires_at > ?", time.Now()).Order("not_before DESC").Find(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	keys := make([]*signingKey, 0, len(rows))
+	for _, row := range rows {
+		block, _ := pem.Decode([]byte(row.PrivateKey))
+		if block == nil {
+			k.log.Logger.Errorf("invalid signing key %s", row.Kid)
+			continue
+		}
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			k.log.Logger.Errorf("invalid signing key %s: %v", row.Kid, err)
+			continue
+		}
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			continue
+		}
+
+		keys = append(keys, &signingKey{
+			kid:       row.Kid,
+			alg:       row.Algorithm,
+			notBefore: row.NotBefore,
+			expiresAt: row.ExpiresAt,
+			private:   signer,
+			public:    signer.Public(),
+		})
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].notBefore.After(keys[j].notBefore) })
+	k.keys.Store(&keys)
+
+	return nil
+}
+
+// signer returns the newest key that is already valid
+func (k *KeySet) signer(now time.Time) (*signingKey, error) {
+	for _, key := range *k.keys.Load() {
+		if !key.notBefore.After(now) {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("no valid signing key")
+}
+
+func signingMethod(alg string) jwt.SigningMethod {
+	if alg == SigningAlgEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// Sign returns the signed JWT of the claims
+func (k *KeySet) Sign(claims jwt.Claims) (string, error) {
+	return k.SignWithType(claims, "JWT")
+}
+
+// SignWithType returns the signed JWT of the claims with the typ header, so tokens
+// signed by the same keys for different purposes can't be used in place of each other
+func (k *KeySet) SignWithType(claims jwt.Claims, typ string) (string, error) {
+	key, err := k.signer(time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(signingMethod(key.alg), claims)
+	token.Header["kid"] = key.kid
+	token.Header["typ"] = typ
+
+	return token.SignedString(key.private)
+}
+
+// Parse verifies the JWT was signed by one of the published keys and parses its claims
+func (k *KeySet) Parse(tokenString string, claims jwt.Claims, options ...jwt.ParserOption) (*jwt.Token, error) {
+	options = append(options, jwt.WithValidMethods([]string{SigningAlgRS256, SigningAlgEdDSA}))
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		for _, key := range *k.keys.Load() {
+			if key.kid == kid {
+				if token.Method.Alg() != key.alg {
+					return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+				}
+				return key.public, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown signing key %s", kid)
+	}, options...)
+}
+
+// JWK is a public key in the JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []*JWK `json:"keys"`
+}
+
+// JWKS returns every published public key, including the ones not signing yet or anymore
+func (k *KeySet) JWKS() *JWKS {
+	jwks := &JWKS{Keys: make([]*JWK, 0)}
+	for _, key := range *k.keys.Load() {
+		jwk := &JWK{Use: "sig", Alg: key.alg, Kid: key.kid}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
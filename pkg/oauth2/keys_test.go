@@ -0,0 +1,100 @@
+package oauth2
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestKey(t *testing.T, kid, alg string, notBefore time.Time) *signingKey {
+	var private crypto.Signer
+	var err error
+	if alg == SigningAlgEdDSA {
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	} else {
+		private, err = rsa.GenerateKey(rand.Reader, RSAKeyBits)
+	}
+	require.NoError(t, err)
+
+	return &signingKey{
+		kid:       kid,
+		alg:       alg,
+		notBefore: notBefore,
+		expiresAt: notBefore.Add(time.Hour),
+		private:   private,
+		public:    private.Public(),
+	}
+}
+
+func TestKeySetSignParse(t *testing.T) {
+	now := time.Now()
+	// the next key is published but doesn't sign yet, the retired one still verifies
+	keys := []*signingKey{
+		newTestKey(t, "next", SigningAlgRS256, now.Add(KeyPublishDelay)),
+		newTestKey(t, "current", SigningAlgRS256, now.Add(-time.Minute)),
+		newTestKey(t, "retired", SigningAlgEdDSA, now.Add(-time.Hour)),
+	}
+	k := &KeySet{}
+	k.keys.Store(&keys)
+
+	claims := &IdTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "1",
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+		Nonce: "n-0S6_WzA2Mj",
+	}
+	signed, err := k.Sign(claims)
+	require.NoError(t, err)
+
+	token, _, err := jwt.NewParser().ParseUnverified(signed, &IdTokenClaims{})
+	require.NoError(t, err)
+	require.Equal(t, "current", token.Header["kid"])
+
+	parsed := &IdTokenClaims{}
+	_, err = k.Parse(signed, parsed)
+	require.NoError(t, err)
+	require.Equal(t, "1", parsed.Subject)
+	require.Equal(t, claims.Nonce, parsed.Nonce)
+
+	// a token signed by the retired key is still valid
+	retired := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	retired.Header["kid"] = "retired"
+	signed, err = retired.SignedString(keys[2].private)
+	require.NoError(t, err)
+	_, err = k.Parse(signed, &IdTokenClaims{})
+	require.NoError(t, err)
+
+	// once the key isn't published anymore its tokens are rejected
+	keys = keys[:2]
+	k.keys.Store(&keys)
+	_, err = k.Parse(signed, &IdTokenClaims{})
+	require.Error(t, err)
+}
+
+func TestKeySetJWKS(t *testing.T) {
+	now := time.Now()
+	keys := []*signingKey{
+		newTestKey(t, "rsa", SigningAlgRS256, now),
+		newTestKey(t, "ed", SigningAlgEdDSA, now),
+	}
+	k := &KeySet{}
+	k.keys.Store(&keys)
+
+	jwks := k.JWKS()
+	require.Len(t, jwks.Keys, 2)
+
+	require.Equal(t, "RSA", jwks.Keys[0].Kty)
+	require.Equal(t, "AQAB", jwks.Keys[0].E)
+	require.NotEmpty(t, jwks.Keys[0].N)
+
+	require.Equal(t, "OKP", jwks.Keys[1].Kty)
+	require.Equal(t, "Ed25519", jwks.Keys[1].Crv)
+	require.NotEmpty(t, jwks.Keys[1].X)
+}
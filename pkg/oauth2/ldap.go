@@ -0,0 +1,284 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"greenlync-api-gateway/config"
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/errors"
+
+	"github.com/go-ldap/ldap/v3"
+	"gorm.io/gorm"
+)
+
+// GroupRole gives the role to the members of a directory group
+type GroupRole struct {
+	Group string
+	Role  string
+}
+
+// ParseGroupRoles parses the <group dn>=<role> pairs separated by ;, the role is after the last =
+// since the group DN has its own
+func ParseGroupRoles(s string) ([]GroupRole, error) {
+	groupRoles := make([]GroupRole, 0)
+	for _, pair := range strings.Split(s, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		i := strings.LastIndex(pair, "=")
+		if i <= 0 || i == len(pair)-1 {
+			return nil, fmt.Errorf("%s: should be <group dn>=<role>", pair)
+		}
+		groupRoles = append(groupRoles, GroupRole{
+			Group: strings.TrimSpace(pair[:i]),
+			Role:  strings.TrimSpace(pair[i+1:]),
+		})
+	}
+
+	return groupRoles, nil
+}
+
+// LDAPAuthenticator binds as the directory user to check its password, the users are found by a
+// search of the service account. A directory user is created on its first login and its profile
+// and role follow the directory on every login
+type LDAPAuthenticator struct {
+	o          *OAuth2
+	cfg        config.LDAP
+	groupRoles []GroupRole
+	timeout    time.Duration
+}
+
+func NewLDAPAuthenticator(o *OAuth2, cfg config.LDAP) (*LDAPAuthenticator, error) {
+	if cfg.URL == "" || cfg.BaseDN == "" {
+		return nil, fmt.Errorf("the ldap backend needs LDAP_URL and LDAP_BASE_DN")
+	}
+	if !strings.Contains(cfg.UserFilter, "%s") {
+		return nil, fmt.Errorf("LDAP_USER_FILTER %s: should contain %%s", cfg.UserFilter)
+	}
+
+	groupRoles, err := ParseGroupRoles(cfg.GroupRoles)
+	if err != nil {
+		return nil, fmt.Errorf("LDAP_GROUP_ROLES %w", err)
+	}
+
+	return &LDAPAuthenticator{
+		o:          o,
+		cfg:        cfg,
+		groupRoles: groupRoles,
+		timeout:    time.Duration(cfg.Timeout) * time.Second,
+	}, nil
+}
+
+func (a *LDAPAuthenticator) Name() string {
+	return model.AuthSource_LDAP
+}
+
+func (a *LDAPAuthenticator) Authenticate(ctx context.Context, username, password string) (*model.User, error) {
+	// an empty password would be an unauthenticated bind, which directories accept
+	if username == "" || password == "" {
+		return nil, errors.ErrInvalidCredentials
+	}
+
+	entry, err := a.bind(username, password)
+	if err != nil {
+		if err == errors.ErrInvalidCredentials && entry != nil {
+			user, _ := a.provisioned(ctx, entry.DN)
+			return user, err
+		}
+		return nil, err
+	}
+
+	role := a.role(entry.GetAttributeValues(a.cfg.GroupAttribute))
+	if role == "" {
+		a.o.Log.Logger.Errorf("directory user %s has no role, none of its groups is in LDAP_GROUP_ROLES", entry.DN)
+		user, _ := a.provisioned(ctx, entry.DN)
+		return user, errors.ErrDirectoryAccount
+	}
+
+	return a.provision(ctx, username, entry, role)
+}
+
+// bind finds the entry of the user and binds as it with the password, the entry is returned with
+// ErrInvalidCredentials when only the password is wrong
+func (a *LDAPAuthenticator) bind(username, password string) (*ldap.Entry, error) {
+	conn, err := ldap.DialURL(a.cfg.URL, ldap.DialWithDialer(&net.Dialer{Timeout: a.timeout}))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetTimeout(a.timeout)
+
+	if a.cfg.StartTLS {
+		u, err := url.Parse(a.cfg.URL)
+		if err != nil {
+			return nil, err
+		}
+		err = conn.StartTLS(&tls.Config{ServerName: u.Hostname()})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if a.cfg.BindDN != "" {
+		err = conn.Bind(a.cfg.BindDN, a.cfg.BindPassword)
+		if err != nil {
+			return nil, fmt.Errorf("service account bind: %w", err)
+		}
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.cfg.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		// a second entry makes the username ambiguous
+		2,
+		int(a.timeout.Seconds()),
+		false,
+		fmt.Sprintf(a.cfg.UserFilter, ldap.EscapeFilter(username)),
+		[]string{"mail", "givenName", "sn", a.cfg.GroupAttribute},
+		nil,
+	))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			a.o.Log.Logger.Errorf("directory username %s matches several entries", username)
+			return nil, errors.ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	if len(result.Entries) != 1 {
+		return nil, errors.ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	err = conn.Bind(entry.DN, password)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return entry, errors.ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// role returns the role of the first group of the user in the group roles, the default role when
+// the user is in none
+func (a *LDAPAuthenticator) role(groups []string) string {
+	for _, groupRole := range a.groupRoles {
+		for _, group := range groups {
+			if strings.EqualFold(group, groupRole.Group) {
+				return groupRole.Role
+			}
+		}
+	}
+	return a.cfg.DefaultRole
+}
+
+// provisioned returns the user of the directory entry, nil if it never logged in
+func (a *LDAPAuthenticator) provisioned(ctx context.Context, dn string) (*model.User, error) {
+	user := &model.User{}
+	err := a.o.DB.WithContext(ctx).Where("auth_source = ? AND external_id = ?", model.AuthSource_LDAP, dn).First(user).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// provision creates the user of the directory entry on its first login or updates its profile and
+// role. The sessions of a user whose role changed are logged out since they carry the old role
+func (a *LDAPAuthenticator) provision(ctx context.Context, username string, entry *ldap.Entry, role string) (*model.User, error) {
+	db := a.o.DB.WithContext(ctx)
+
+	var count int64
+	err := db.Model(&model.Role{}).Where("`desc` = ?", role).Count(&count).Error
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		a.o.Log.Logger.Errorf("role %s of directory user %s doesn't exist", role, entry.DN)
+		return nil, errors.ErrDirectoryAccount
+	}
+
+	email := entry.GetAttributeValue("mail")
+	user, err := a.provisioned(ctx, entry.DN)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		if email == "" {
+			a.o.Log.Logger.Errorf("directory user %s has no mail", entry.DN)
+			return nil, errors.ErrDirectoryAccount
+		}
+
+		// a local account with the same username or email isn't taken over, the next backend checks it
+		err = db.Model(&model.User{}).Where("username = ? OR email = ?", username, email).Count(&count).Error
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			a.o.Log.Logger.Errorf("directory user %s conflicts with an existing account", entry.DN)
+			return nil, errors.ErrInvalidCredentials
+		}
+
+		now := time.Now()
+		user = &model.User{
+			Username:        username,
+			Email:           email,
+			FirstName:       entry.GetAttributeValue("givenName"),
+			LastName:        entry.GetAttributeValue("sn"),
+			Role:            role,
+			IsActive:        true,
+			EmailVerifiedAt: &now,
+			AuthSource:      model.AuthSource_LDAP,
+			ExternalId:      entry.DN,
+		}
+		err = db.Create(user).Error
+		if err != nil {
+			return nil, err
+		}
+
+		return user, nil
+	}
+
+	roleChanged := user.Role != role
+	user.FirstName = entry.GetAttributeValue("givenName")
+	user.LastName = entry.GetAttributeValue("sn")
+	user.Role = role
+
+	columns := []interface{}{"last_name", "role"}
+	if email != "" && email != user.Email {
+		err = db.Model(&model.User{}).Where("id <> ? AND email = ?", user.Id, email).Count(&count).Error
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			user.Email = email
+			columns = append(columns, "email")
+		}
+	}
+
+	err = db.Model(user).Select("first_name", columns...).Updates(user).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if roleChanged {
+		_, err = a.o.LogoutUser(ctx, user.Id, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
@@ -0,0 +1,181 @@
+package oauth2
+
+import (
+	"net"
+	"testing"
+
+	"greenlync-api-gateway/config"
+	"greenlync-api-gateway/pkg/errors"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/require"
+)
+
+// ldapStub is an in-process directory answering the simple binds and the searches of the LDAP
+// backend, the searches are matched on their filter
+type ldapStub struct {
+	listener net.Listener
+	// dn to password
+	passwords map[string]string
+	// filter to entries
+	entries map[string][]*ldap.Entry
+}
+
+func newLDAPStub(t *testing.T) *ldapStub {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	stub := &ldapStub{
+		listener:  listener,
+		passwords: make(map[string]string),
+		entries:   make(map[string][]*ldap.Entry),
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go stub.serve(conn)
+		}
+	}()
+
+	return stub
+}
+
+func (s *ldapStub) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *ldapStub) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageId := packet.Children[0].Value
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			code := uint16(ldap.LDAPResultInvalidCredentials)
+			password, ok := s.passwords[op.Children[1].Data.String()]
+			if ok && password == op.Children[2].Data.String() {
+				code = ldap.LDAPResultSuccess
+			}
+			conn.Write(ldapResponse(messageId, ldap.ApplicationBindResponse, code).Bytes())
+		case ldap.ApplicationSearchRequest:
+			filter, err := ldap.DecompileFilter(op.Children[6])
+			if err != nil {
+				conn.Write(ldapResponse(messageId, ldap.ApplicationSearchResultDone, ldap.LDAPResultFilterError).Bytes())
+				continue
+			}
+			for _, entry := range s.entries[filter] {
+				conn.Write(ldapEntry(messageId, entry).Bytes())
+			}
+			conn.Write(ldapResponse(messageId, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+		default:
+			return
+		}
+	}
+}
+
+func ldapResponse(messageId interface{}, tag ber.Tag, code uint16) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+
+	return ldapMessage(messageId, op)
+}
+
+func ldapEntry(messageId interface{}, entry *ldap.Entry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "DN"))
+
+	attributes := ber.NewSequence("Attributes")
+	for _, attribute := range entry.Attributes {
+		a := ber.NewSequence("Attribute")
+		a.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, attribute.Name, "Type"))
+		values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range attribute.Values {
+			values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		a.AppendChild(values)
+		attributes.AppendChild(a)
+	}
+	op.AppendChild(attributes)
+
+	return ldapMessage(messageId, op)
+}
+
+func ldapMessage(messageId interface{}, op *ber.Packet) *ber.Packet {
+	envelope := ber.NewSequence("LDAP Message")
+	envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageId, "Message ID"))
+	envelope.AppendChild(op)
+	return envelope
+}
+
+func TestParseGroupRoles(t *testing.T) {
+	groupRoles, err := ParseGroupRoles("cn=admins,ou=groups,dc=example,dc=com=Admin; cn=staff,ou=groups,dc=example,dc=com = User;")
+	require.NoError(t, err)
+	require.Equal(t, []GroupRole{
+		{Group: "cn=admins,ou=groups,dc=example,dc=com", Role: "Admin"},
+		{Group: "cn=staff,ou=groups,dc=example,dc=com", Role: "User"},
+	}, groupRoles)
+
+	_, err = ParseGroupRoles("cn=admins,ou=groups,dc=example,dc=com=")
+	require.Error(t, err)
+}
+
+func TestLDAPAuthenticatorBind(t *testing.T) {
+	stub := newLDAPStub(t)
+	stub.passwords["cn=gateway,ou=services,dc=example,dc=com"] = "service"
+	stub.passwords["uid=alice,ou=people,dc=example,dc=com"] = "secret"
+	stub.entries["(uid=alice)"] = []*ldap.Entry{
+		ldap.NewEntry("uid=alice,ou=people,dc=example,dc=com", map[string][]string{
+			"mail":     {"alice@example.com"},
+			"memberOf": {"cn=staff,ou=groups,dc=example,dc=com", "CN=Admins,OU=Groups,DC=example,DC=com"},
+		}),
+	}
+
+	a, err := NewLDAPAuthenticator(&OAuth2{}, config.LDAP{
+		URL:            stub.URL(),
+		BindDN:         "cn=gateway,ou=services,dc=example,dc=com",
+		BindPassword:   "service",
+		BaseDN:         "ou=people,dc=example,dc=com",
+		UserFilter:     "(uid=%s)",
+		GroupAttribute: "memberOf",
+		GroupRoles:     "cn=admins,ou=groups,dc=example,dc=com=Admin;cn=staff,ou=groups,dc=example,dc=com=User",
+		Timeout:        5,
+	})
+	require.NoError(t, err)
+
+	entry, err := a.bind("alice", "secret")
+	require.NoError(t, err)
+	require.Equal(t, "alice@example.com", entry.GetAttributeValue("mail"))
+	// the first group of the list wins whatever the order and the case of the user groups
+	require.Equal(t, "Admin", a.role(entry.GetAttributeValues("memberOf")))
+	require.Equal(t, "", a.role([]string{"cn=others,ou=groups,dc=example,dc=com"}))
+
+	entry, err = a.bind("alice", "wrong")
+	require.Equal(t, errors.ErrInvalidCredentials, err)
+	require.Equal(t, "uid=alice,ou=people,dc=example,dc=com", entry.DN)
+
+	entry, err = a.bind("bob", "secret")
+	require.Equal(t, errors.ErrInvalidCredentials, err)
+	require.Nil(t, entry)
+
+	// the filter can't be injected through the username
+	_, err = a.bind("*", "secret")
+	require.Equal(t, errors.ErrInvalidCredentials, err)
+
+	a.cfg.BindPassword = "wrong"
+	_, err = a.bind("alice", "secret")
+	require.Error(t, err)
+	require.NotEqual(t, errors.ErrInvalidCredentials, err)
+}
@@ -0,0 +1,237 @@
+package oauth2
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"greenlync-api-gateway/config"
+	"greenlync-api-gateway/pkg/cache"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// delay after the first failed login of an account, doubled by every other failure
+	LoginBaseDelay = time.Second
+	// longest delay between two failed logins of an account
+	LoginMaxDelay = 30 * time.Second
+)
+
+// Lockout subjects, the failures are counted per account, per unknown username and per client ip
+const (
+	LoginSubjectAccount = "account:"
+	LoginSubjectUser    = "user:"
+	LoginSubjectIP      = "ip:"
+)
+
+// LoginGuard counts the failed logins per account and per client ip in redis so every replica
+// shares them. Each failure of an account delays its next attempt a bit more and too many failures
+// lock the account or the client ip out for a while
+type LoginGuard struct {
+	redis         *redis.Client
+	maxFailures   int
+	ipMaxFailures int
+	window        time.Duration
+	duration      time.Duration
+}
+
+// Lockout is an account, a username or a client ip locked out after too many failed logins
+type Lockout struct {
+	Subject   string `json:"subject" example:"account:42"`
+	ExpiresIn int    `json:"expires_in"`
+}
+
+func NewLoginGuard(redis *redis.Client, cfg config.Lockout) *LoginGuard {
+	return &LoginGuard{
+		redis:         redis,
+		maxFailures:   cfg.MaxFailures,
+		ipMaxFailures: cfg.IPMaxFailures,
+		window:        time.Duration(cfg.FailureWindow) * time.Second,
+		duration:      time.Duration(cfg.Duration) * time.Second,
+	}
+}
+
+// AccountSubject returns the lockout subject of an existing account, the failures of every name
+// the account answers to are counted together
+func AccountSubject(userId int32) string {
+	return LoginSubjectAccount + strconv.Itoa(int(userId))
+}
+
+// UserSubject returns the lockout subject of a username without an account, usernames aren't
+// case sensitive
+func UserSubject(username string) string {
+	return LoginSubjectUser + strings.ToLower(strings.TrimSpace(username))
+}
+
+// LoginSubject returns the lockout subject of a login, the account when the username resolved to
+// one and the username otherwise
+func LoginSubject(username string, userId int32) string {
+	if userId != 0 {
+		return AccountSubject(userId)
+	}
+	return UserSubject(username)
+}
+
+// IPSubject returns the lockout subject of the client ip
+func IPSubject(ip string) string {
+	return LoginSubjectIP + ip
+}
+
+// LoginDelay returns how long an account waits after its nth failed login
+func LoginDelay(failures int) time.Duration {
+	if failures < 1 {
+		return 0
+	}
+
+	delay := LoginBaseDelay
+	for i := 1; i < failures; i++ {
+		delay *= 2
+		if delay >= LoginMaxDelay {
+			return LoginMaxDelay
+		}
+	}
+	return delay
+}
+
+// Check returns how long the login of the subject has to wait, zero if it can be attempted now.
+// locked reports whether the subject or the client ip is locked out rather than only delayed
+func (g *LoginGuard) Check(ctx context.Context, subject, ip string) (time.Duration, bool, error) {
+	if g == nil {
+		return 0, false, nil
+	}
+
+	pipe := g.redis.Pipeline()
+	userLock := pipe.PTTL(ctx, cache.LoginLockoutKey(subject))
+	ipLock := pipe.PTTL(ctx, cache.LoginLockoutKey(IPSubject(ip)))
+	userDelay := pipe.PTTL(ctx, cache.LoginDelayKey(subject))
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+
+	// missing keys have a negative ttl
+	locked := max(userLock.Val(), ipLock.Val())
+	if locked > 0 {
+		return locked, true, nil
+	}
+
+	return max(userDelay.Val(), 0), false, nil
+}
+
+// Fail counts a failed login of the subject, the subjects locked out by this failure are returned
+func (g *LoginGuard) Fail(ctx context.Context, subject, ip string) ([]string, error) {
+	if g == nil {
+		return nil, nil
+	}
+
+	locked := make([]string, 0, 2)
+
+	failures, err := g.count(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+	if g.maxFailures > 0 && failures >= g.maxFailures {
+		err = g.lock(ctx, subject)
+		if err != nil {
+			return nil, err
+		}
+		locked = append(locked, subject)
+	} else {
+		err = g.redis.Set(ctx, cache.LoginDelayKey(subject), failures, LoginDelay(failures)).Err()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// a client ip isn't delayed, clients behind a NAT share it, it's only locked out
+	subject = IPSubject(ip)
+	failures, err = g.count(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+	if g.ipMaxFailures > 0 && failures >= g.ipMaxFailures {
+		err = g.lock(ctx, subject)
+		if err != nil {
+			return nil, err
+		}
+		locked = append(locked, subject)
+	}
+
+	return locked, nil
+}
+
+// Succeed forgets the failed logins of the subject, the client ip failures are kept so one
+// valid account doesn't reset the count of an ip guessing others
+func (g *LoginGuard) Succeed(ctx context.Context, subject string) error {
+	if g == nil {
+		return nil
+	}
+	return g.redis.Del(ctx, cache.LoginFailuresKey(subject), cache.LoginDelayKey(subject)).Err()
+}
+
+// Unlock lifts the lockout of the subject and forgets its failed logins
+func (g *LoginGuard) Unlock(ctx context.Context, subject string) error {
+	if g == nil {
+		return nil
+	}
+	return g.redis.Del(ctx, cache.LoginLockoutKey(subject), cache.LoginFailuresKey(subject), cache.LoginDelayKey(subject)).Err()
+}
+
+// Lockouts returns the accounts, usernames and client ips locked out at the moment
+func (g *LoginGuard) Lockouts(ctx context.Context) ([]*Lockout, error) {
+	lockouts := make([]*Lockout, 0)
+	if g == nil {
+		return lockouts, nil
+	}
+
+	prefix := cache.LoginLockoutKey("")
+	iter := g.redis.Scan(ctx, 0, prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		ttl, err := g.redis.TTL(ctx, iter.Val()).Result()
+		if err != nil {
+			return nil, err
+		}
+		// expired between the scan and the ttl
+		if ttl <= 0 {
+			continue
+		}
+		lockouts = append(lockouts, &Lockout{
+			Subject:   strings.TrimPrefix(iter.Val(), prefix),
+			ExpiresIn: int(ttl.Seconds()),
+		})
+	}
+
+	return lockouts, iter.Err()
+}
+
+// LockoutDuration returns how long a lockout lasts
+func (g *LoginGuard) LockoutDuration() time.Duration {
+	return g.duration
+}
+
+// count adds a failure of the subject within the failure window
+func (g *LoginGuard) count(ctx context.Context, subject string) (int, error) {
+	key := cache.LoginFailuresKey(subject)
+	failures, err := g.redis.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if failures == 1 {
+		err = g.redis.Expire(ctx, key, g.window).Err()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return int(failures), nil
+}
+
+// lock locks the subject out, the failures start over once the lockout is over
+func (g *LoginGuard) lock(ctx context.Context, subject string) error {
+	pipe := g.redis.TxPipeline()
+	pipe.Set(ctx, cache.LoginLockoutKey(subject), time.Now().Unix(), g.duration)
+	pipe.Del(ctx, cache.LoginFailuresKey(subject), cache.LoginDelayKey(subject))
+	_, err := pipe.Exec(ctx)
+	return err
+}
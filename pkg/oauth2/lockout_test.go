@@ -0,0 +1,33 @@
+package oauth2
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginDelay(t *testing.T) {
+	require.Equal(t, time.Duration(0), LoginDelay(0))
+	require.Equal(t, LoginBaseDelay, LoginDelay(1))
+	require.Equal(t, 2*LoginBaseDelay, LoginDelay(2))
+	require.Equal(t, 8*LoginBaseDelay, LoginDelay(4))
+	require.Equal(t, LoginMaxDelay, LoginDelay(100))
+}
+
+func TestLoginSubjects(t *testing.T) {
+	require.Equal(t, "user:alice", UserSubject(" Alice "))
+	require.Equal(t, "ip:2001:db8::1", IPSubject("2001:db8::1"))
+	// an existing account is one subject whatever name it was logged in with
+	require.Equal(t, "account:1", LoginSubject("admin", 1))
+	require.Equal(t, "account:1", LoginSubject("01", 1))
+	require.Equal(t, "user:bob", LoginSubject("Bob", 0))
+
+	// without a guard logins are never delayed
+	var g *LoginGuard
+	wait, locked, err := g.Check(context.Background(), UserSubject("alice"), "127.0.0.1")
+	require.NoError(t, err)
+	require.False(t, locked)
+	require.Zero(t, wait)
+}
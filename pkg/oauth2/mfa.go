@@ -0,0 +1,400 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/cache"
+	"greenlync-api-gateway/pkg/errors"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/goccy/go-json"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Config store keys of the MFA policy
+const (
+	MfaConfigPrefix = "mfa."
+	// mfa.role.<role> true makes MFA mandatory for the users of the role
+	MfaConfigRolePrefix = "mfa.role."
+)
+
+var (
+	// how long the second login step can be completed
+	MfaChallengeTTL = 300
+	// random characters of the token of the second login step
+	MfaTokenLength = 48
+	// codes tried before the challenge is dropped and the user has to login again
+	MfaMaxAttempts = 5
+	// recovery codes generated when MFA is confirmed, each can be used once instead of a code
+	RecoveryCodesCount = 10
+	// issuer shown by the authenticator apps
+	TotpIssuer = "GreenLync"
+	// characters of the codes emailed to verify an unknown device
+	DeviceCodeLength = 8
+)
+
+// MfaChallenge is the first login step, stored in redis until the second step verifies a code
+type MfaChallenge struct {
+	UserId     int32
+	RememberMe bool
+	// MFA is mandatory for the role and the user has to enroll before a session is issued
+	EnrollmentRequired bool
+	// the user has no MFA and signs in from an unknown device, the code was emailed to them
+	EmailCode bool
+}
+
+// NewMfaRoles builds the roles MFA is mandatory for from the mfa.* configs, invalid configs are
+// skipped and returned as an error next to the valid roles
+func NewMfaRoles(configs []*model.Config) (map[string]bool, error) {
+	roles := make(map[string]bool)
+
+	errs := make([]error, 0)
+	for _, cfg := range configs {
+		if !strings.HasPrefix(cfg.Key, MfaConfigPrefix) {
+			continue
+		}
+
+		role := strings.TrimPrefix(cfg.Key, MfaConfigRolePrefix)
+		if !strings.HasPrefix(cfg.Key, MfaConfigRolePrefix) || role == "" {
+			errs = append(errs, fmt.Errorf("%s: unknown mfa key", cfg.Key))
+			continue
+		}
+
+		required, err := strconv.ParseBool(strings.TrimSpace(cfg.Value))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: should be true or false", cfg.Key))
+			continue
+		}
+		if required {
+			roles[role] = true
+		}
+	}
+
+	return roles, stderrors.Join(errs...)
+}
+
+// ReloadMfaRoles loads the mfa.* configs into the roles MFA is mandatory for
+func (o *OAuth2) ReloadMfaRoles() error {
+	configs := []*model.Config{}
+	err := o.DB.Where("`key` LIKE ?", MfaConfigPrefix+"%").Find(&configs).Error
+	if err != nil {
+		return err
+	}
+
+	roles, err := NewMfaRoles(configs)
+	o.mfaRoles.Store(&roles)
+
+	return err
+}
+
+// MfaRequired reports whether the users of the role can't login without MFA
+func (o *OAuth2) MfaRequired(role string) bool {
+	roles := o.mfaRoles.Load()
+	if roles == nil {
+		return false
+	}
+	return (*roles)[role]
+}
+
+// GetMfa returns the MFA factor of the user, confirmed or not, nil if the user never enrolled
+func (o *OAuth2) GetMfa(ctx context.Context, userId int32) (*model.UserMfa, error) {
+	mfa := &model.UserMfa{}
+	err := o.DB.WithContext(ctx).Where("user_id = ?", userId).First(mfa).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return mfa, nil
+}
+
+// NewMfaChallenge stores the first login step and returns the token of the second step
+func (o *OAuth2) NewMfaChallenge(ctx context.Context, challenge *MfaChallenge) (string, error) {
+	token, err := randomString(MfaTokenLength)
+	if err != nil {
+		return "", err
+	}
+
+	js, err := json.Marshal(challenge)
+	if err != nil {
+		return "", err
+	}
+
+	err = o.Cache.Set(ctx, cache.MfaChallengeKey(token), js, MfaChallengeTTL)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// GetMfaChallenge returns the challenge of the token, it stays valid until consumed or expired
+func (o *OAuth2) GetMfaChallenge(ctx context.Context, token string) (*MfaChallenge, error) {
+	js, err := o.Cache.Get(ctx, cache.MfaChallengeKey(token))
+	if err != nil {
+		if err == redis.Nil {
+			return nil, errors.ErrInvalidMfaToken
+		}
+		return nil, err
+	}
+
+	challenge := &MfaChallenge{}
+	err = json.Unmarshal([]byte(js), challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// AttemptMfaChallenge counts an attempt to answer the challenge before its code is checked, the
+// counter is atomic so parallel attempts can't go over MfaMaxAttempts. The challenge is dropped
+// once they're used up
+func (o *OAuth2) AttemptMfaChallenge(ctx context.Context, token string) error {
+	key := cache.MfaAttemptsKey(token)
+	pipe := o.Cache.GetRedisClient().TxPipeline()
+	attempts := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, time.Duration(MfaChallengeTTL)*time.Second)
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	if attempts.Val() > int64(MfaMaxAttempts) {
+		err = o.Cache.Delete(ctx, cache.MfaChallengeKey(token))
+		if err != nil {
+			return err
+		}
+		return errors.ErrInvalidMfaToken
+	}
+
+	return nil
+}
+
+// NewDeviceCode returns the code emailed to a user without MFA to verify an unknown device, it's
+// valid as long as the challenge and the previous code of the user stops working
+func (o *OAuth2) NewDeviceCode(ctx context.Context, userId int32) (string, error) {
+	return deviceCodes.new(ctx, o.Cache, userId, DeviceCodeLength, MfaChallengeTTL)
+}
+
+// VerifyDeviceCode checks the code emailed to the user, a code can't be used twice
+func (o *OAuth2) VerifyDeviceCode(ctx context.Context, userId int32, code string) error {
+	owner, err := deviceCodes.lookup(ctx, o.Cache, code)
+	if err != nil {
+		if err == redis.Nil {
+			return errors.ErrInvalidMfaCode
+		}
+		return err
+	}
+	if owner != userId {
+		return errors.ErrInvalidMfaCode
+	}
+
+	_, err = deviceCodes.consume(ctx, o.Cache, code)
+	if err != nil {
+		if err == redis.Nil {
+			return errors.ErrInvalidMfaCode
+		}
+		return err
+	}
+
+	return nil
+}
+
+// ConsumeMfaChallenge drops the challenge once the second step succeeded, a challenge
+// can't be used twice even when both requests verified a code
+func (o *OAuth2) ConsumeMfaChallenge(ctx context.Context, token string) error {
+	_, err := o.Cache.GetDel(ctx, cache.MfaChallengeKey(token))
+	if err != nil {
+		if err == redis.Nil {
+			return errors.ErrInvalidMfaToken
+		}
+		return err
+	}
+	return nil
+}
+
+// EnrollTotp starts the enrollment with a new secret, it replaces an unconfirmed enrollment
+func (o *OAuth2) EnrollTotp(ctx context.Context, userId int32) (string, error) {
+	mfa, err := o.GetMfa(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+	if mfa != nil && mfa.ConfirmedAt != nil {
+		return "", errors.ErrMfaAlreadyEnabled
+	}
+
+	secret, err := GenerateTotpSecret()
+	if err != nil {
+		return "", err
+	}
+
+	if mfa == nil {
+		mfa = &model.UserMfa{UserId: userId}
+	}
+	mfa.Secret = secret
+	mfa.LastStep = 0
+	mfa.RecoveryCodes = nil
+
+	err = o.DB.WithContext(ctx).Save(mfa).Error
+	if err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// ConfirmTotp enables MFA once the user proved the authenticator app has the secret,
+// the recovery codes are returned in plain text only here
+func (o *OAuth2) ConfirmTotp(ctx context.Context, userId int32, code string) ([]string, error) {
+	mfa, err := o.GetMfa(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if mfa == nil {
+		return nil, errors.ErrMfaNotEnrolled
+	}
+	if mfa.ConfirmedAt != nil {
+		return nil, errors.ErrMfaAlreadyEnabled
+	}
+
+	step, ok := ValidateTotp(mfa.Secret, code, time.Now())
+	if !ok {
+		return nil, errors.ErrInvalidMfaCode
+	}
+
+	codes, hashes, err := GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	// a struct update so the recovery codes go through their serializer
+	now := time.Now()
+	res := o.DB.WithContext(ctx).Model(mfa).Where("confirmed_at IS NULL").Updates(&model.UserMfa{
+		ConfirmedAt:   &now,
+		LastStep:      step,
+		RecoveryCodes: hashes,
+	})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, errors.ErrMfaAlreadyEnabled
+	}
+
+	return codes, nil
+}
+
+// VerifyMfa checks a TOTP code or a recovery code of a user with MFA enabled, a code can't be
+// accepted twice and a recovery code is used up
+func (o *OAuth2) VerifyMfa(ctx context.Context, userId int32, code, recoveryCode string) error {
+	mfa, err := o.GetMfa(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if mfa == nil || mfa.ConfirmedAt == nil {
+		return errors.ErrMfaNotEnrolled
+	}
+
+	if recoveryCode != "" {
+		return o.useRecoveryCode(ctx, mfa.Id, recoveryCode)
+	}
+
+	step, ok := ValidateTotp(mfa.Secret, code, time.Now())
+	if !ok {
+		return errors.ErrInvalidMfaCode
+	}
+
+	// replays of the code, or of an older one, don't move the last step forward
+	res := o.DB.WithContext(ctx).Model(&model.UserMfa{}).
+		Where("id = ? AND last_step < ?", mfa.Id, step).
+		Update("last_step", step)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errors.ErrInvalidMfaCode
+	}
+
+	return nil
+}
+
+func (o *OAuth2) useRecoveryCode(ctx context.Context, mfaId int32, recoveryCode string) error {
+	hash := HashRecoveryCode(recoveryCode)
+
+	return o.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		mfa := &model.UserMfa{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(mfa, mfaId).Error
+		if err != nil {
+			return err
+		}
+
+		for i, h := range mfa.RecoveryCodes {
+			if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+				mfa.RecoveryCodes = append(mfa.RecoveryCodes[:i], mfa.RecoveryCodes[i+1:]...)
+				return tx.Model(mfa).Select("recovery_codes").Updates(&model.UserMfa{RecoveryCodes: mfa.RecoveryCodes}).Error
+			}
+		}
+
+		return errors.ErrInvalidMfaCode
+	})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of a user with MFA enabled
+func (o *OAuth2) RegenerateRecoveryCodes(ctx context.Context, userId int32) ([]string, error) {
+	codes, hashes, err := GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	res := o.DB.WithContext(ctx).Model(&model.UserMfa{}).
+		Where("user_id = ? AND confirmed_at IS NOT NULL", userId).
+		Updates(&model.UserMfa{RecoveryCodes: hashes})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, errors.ErrMfaNotEnrolled
+	}
+
+	return codes, nil
+}
+
+// DisableMfa removes the MFA factor of the user, confirmed or not
+func (o *OAuth2) DisableMfa(ctx context.Context, userId int32) error {
+	return o.DB.WithContext(ctx).Where("user_id = ?", userId).Delete(&model.UserMfa{}).Error
+}
+
+// GenerateRecoveryCodes returns new recovery codes and their hashes
+func GenerateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, RecoveryCodesCount)
+	hashes := make([]string, RecoveryCodesCount)
+	for i := range codes {
+		s, err := randomString(10)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes[i] = strings.ToLower(s[:5] + "-" + s[5:])
+		hashes[i] = HashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode returns the hex encoded SHA-256 of the recovery code, the codes are random
+// enough that a slow password hash isn't needed. Case and dashes don't matter
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	hash := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(hash[:])
+}
@@ -6,13 +6,14 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"fmt"
 	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 	"greenlync-api-gateway/config"
 	model "greenlync-api-gateway/model/common/v1"
 	"greenlync-api-gateway/pkg/cache"
+	"greenlync-api-gateway/pkg/errors"
 	"greenlync-api-gateway/pkg/logger"
 
 	"github.com/go-redis/redis/v8"
@@ -51,6 +52,36 @@ type Config struct {
 	Ws bool
 	// Remember me
 	RememberMe bool
+	// API key the client authenticated with, 0 for sessions
+	ApiKeyId int32
+	// Casbin resources the API key or OAuth client token is restricted to,
+	// nil means everything the role allows
+	Resources []string
+	// OpenID Connect id token and the nonce it carries, returned once and never cached
+	IdToken string `json:"-"`
+	Nonce   string `json:"-"`
+	// id of a JWT access token
+	Jti string `json:"-"`
+	// admin impersonating the user of the session, 0 for the sessions of the user
+	ImpersonatorId int32
+}
+
+// Allows reports whether the client may use the resource on top of its role, sessions
+// can use everything their role allows while API keys and client tokens only their own resources.
+// Impersonation sessions can't use the destructive resources
+func (c *Config) Allows(resource string) bool {
+	if c.ImpersonatorId != 0 && IsDestructive(resource) {
+		return false
+	}
+	if c.Resources == nil {
+		return true
+	}
+	for _, r := range c.Resources {
+		if r == resource {
+			return true
+		}
+	}
+	return false
 }
 
 type OAuth2 struct {
@@ -64,67 +95,78 @@ type OAuth2 struct {
 	TokenExpiresIn int
 	// Long Token Expiration
 	LongTokenExpiresIn int
-	// this is a list of the active sessions
-	SessionsList ActiveSessionsList
-	// protect sessionMap
+	// active sessions shared by the replicas
+	Sessions *SessionRegistry
+	// keys signing the id tokens, no id tokens are issued without them
+	Keys *KeySet
+	// OpenID Connect issuer, default audience and id token expiration
+	Issuer           string
+	Audience         string
+	IdTokenExpiresIn int
+	// opaque or jwt access tokens, jwt needs the signing keys
+	TokenFormat string
+	// revoked JWT access tokens and sessions, JWTs can't be verified without it
+	Revocations *RevocationList
+	// failed logins delays and lockouts
+	Logins *LoginGuard
+	// rules of the new passwords
+	Passwords *PasswordPolicy
+	// backends checking the password logins in order
+	Authenticators []Authenticator
+	// roles MFA is mandatory for, from the mfa.* configs
+	mfaRoles atomic.Pointer[map[string]bool]
+	// concurrent sessions policy per role, from the sessions.* configs
+	sessionPolicies atomic.Pointer[SessionPolicies]
+	// protect the session ids deletion
 	sync.RWMutex
 }
 
 func NewOAuth2(cache *cache.Cache, db *gorm.DB, cfg *config.Config, log *logger.Logger) *OAuth2 {
-	return &OAuth2{
+	o := &OAuth2{
 		Cache:              cache,
 		DB:                 db,
 		Log:                log,
-		SessionsList:       make(ActiveSessionsList),
+		Sessions:           NewSessionRegistry(cache.GetRedisClient()),
 		TokenExpiresIn:     cfg.HTTP.OAuthTokenExpiresIn,
 		LongTokenExpiresIn: cfg.HTTP.OAuthLongTokenExpiresIn,
+		Issuer:             cfg.OIDC.Issuer,
+		Audience:           cfg.OIDC.Audience,
+		IdTokenExpiresIn:   cfg.OIDC.IdTokenExpiresIn,
+		TokenFormat:        cfg.HTTP.OAuthTokenFormat,
+		Logins:             NewLoginGuard(cache.GetRedisClient(), cfg.Lockout),
+		Passwords:          NewPasswordPolicy(cfg.Passwords),
 	}
-}
-
-// func (o *OAuth2) ClientCredentialsToken(ctx context.Context, expiresIn int64, config *Config) (*model.Token, error) {
-// 	tokenstr := o.GenerateToken()
-// 	token := &model.Token{
-// 		UserId:   config.ClientId,
-// 		Scope:       config.Scope,
-// 		AccessToken: tokenstr,
-// 		ExpiresIn:   o.TokenExpiresIn,
-// 	}
+	o.Authenticators = []Authenticator{NewLocalAuthenticator(o)}
 
-// 	js, err := json.Marshal(config)
-// 	if err != nil {
-// 		return nil, err
-// 	}
-
-// 	err = o.Cache.Set(ctx, token.AccessToken, js, 0)
-// 	if err != nil {
-// 		return nil, err
-// 	}
-
-// 	err = o.DB.Create(token).Error
-
-// 	if err != nil {
-// 		o.DeleteToken(ctx, token.AccessToken)
-// 		return nil, err
-// 	}
-
-// 	return token, nil
-// }
+	return o
+}
 
 func (o *OAuth2) PasswordCredentialsToken(ctx context.Context, config *Config) (*Config, error) {
-	config.AccessToken = o.GenerateToken()
 	config.RefreshToken = o.GenerateToken()
 	config.SessionId = o.GenerateToken()
 	config.StartedAt = time.Now()
 	config.LastActivity = time.Now()
+	jti, err := o.newAccessToken(config)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresIn := o.accessTokenExpiresIn(config)
 
 	token := &model.Token{
 		AccessToken:  config.AccessToken,
 		RefreshToken: config.RefreshToken,
 		SessionId:    config.SessionId,
-		ExpiresIn:    o.TokenExpiresIn,
+		ExpiresIn:    expiresIn,
 		Scope:        config.Scope,
 		IpAddress:    config.IpAddress,
 		UserId:       config.ClientId,
+		ClientId:     config.ClientSecretId,
+		Resources:    config.Resources,
+	}
+	if jti != "" {
+		token.AccessToken = ""
+		token.Jti = jti
 	}
 	session := &model.Session{
 		SessionId: config.SessionId,
@@ -132,10 +174,11 @@ func (o *OAuth2) PasswordCredentialsToken(ctx context.Context, config *Config) (
 		IpAddress: config.IpAddress,
 		UserAgent: config.UserAgent,
 		UserId: config.ClientId,
+		ImpersonatorId: config.ImpersonatorId,
 	}
 
 	tx := o.DB.Begin()
-	err := tx.Create(token).Error
+	err = tx.Create(token).Error
 	if err != nil {
 		tx.Rollback()
 		return nil, err
@@ -153,27 +196,39 @@ func (o *OAuth2) PasswordCredentialsToken(ctx context.Context, config *Config) (
 		return nil, err
 	}
 
-	// ctx.Deadline()
-	err = o.Cache.Set(ctx, config.AccessToken, js, o.TokenExpiresIn)
+	// JWT access tokens are verified without the cache
+	if jti == "" {
+		err = o.Cache.Set(ctx, config.AccessToken, js, expiresIn)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	err = o.Cache.Set(ctx, cache.SessionsKey(config.SessionId), js, expiresIn)
 	if err != nil {
 		tx.Rollback()
 		return nil, err
 	}
 
-	err = o.Cache.Set(ctx, cache.SessionsKey(config.SessionId), js, o.TokenExpiresIn)
+	err = o.NewActiveSession(ctx, config)
 	if err != nil {
 		tx.Rollback()
 		return nil, err
 	}
 
-	o.NewActiveSession(config)
-
 	tx.Commit()
 
+	o.issueIdToken(ctx, config)
+
 	return config, nil
 }
 
 func (o *OAuth2) Inspect(ctx context.Context, accessToken string) (*Config, error) {
+	if IsJWT(accessToken) {
+		return o.inspectJWT(accessToken)
+	}
+
 	js, err := o.Cache.Get(ctx, accessToken)
 	if err != nil {
 
@@ -189,6 +244,10 @@ func (o *OAuth2) Inspect(ctx context.Context, accessToken string) (*Config, erro
 	return config, nil
 }
 
+// RefreshToken rotates the refresh token, the previous one is consumed and the refresh tokens of a
+// session form its family. A consumed refresh token being used again means it was stolen, the whole
+// family is revoked and the session logged out, ErrRefreshTokenReused is returned with the config of
+// the revoked session. Unknown, revoked and logged out refresh tokens return redis.Nil
 func (o *OAuth2) RefreshToken(ctx context.Context, ipAddr, useragent, refreshToken string) (*Config, error) {
 	// find the session
 
@@ -197,24 +256,68 @@ func (o *OAuth2) RefreshToken(ctx context.Context, ipAddr, useragent, refreshTok
 
 	err := o.DB.Where("refresh_token = ?", refreshToken).First(token).Error
 	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, redis.Nil
+		}
+		return nil, err
+	}
+
+	if token.RefreshToken != refreshToken || token.RevokedAt != nil {
+		return nil, redis.Nil
+	}
+
+	if token.ConsumedAt != nil {
+		return o.refreshTokenReused(ctx, token)
+	}
+
+	session := &model.Session{}
+	err = o.DB.Where("session_id = ? AND finished_at IS NULL", token.SessionId).First(session).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, redis.Nil
+		}
 		return nil, err
 	}
 
-	if token.RefreshToken != refreshToken {
-		return nil, fmt.Errorf("invalid refresh token")
+	// impersonation sessions end with their access token
+	if session.ImpersonatorId != 0 {
+		return nil, redis.Nil
+	}
+
+	// tokens of an OAuth client can only be refreshed while the client is allowed to
+	if token.ClientId != "" {
+		client := &model.OAuthClient{}
+		err = o.DB.Where("client_id = ? AND is_active = ?", token.ClientId, true).First(client).Error
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return nil, err
+		}
+		if err == gorm.ErrRecordNotFound || !client.HasGrant(model.GrantType_RefreshToken) {
+			return nil, errors.ErrUnauthorizedGrant
+		}
 	}
 
 	config = &Config{
-		AccessToken:  o.GenerateToken(),
-		RefreshToken: o.GenerateToken(),
-		SessionId:    token.SessionId,
-		ExpiresIn:    o.TokenExpiresIn,
-		Scope:        token.Scope,
-		IpAddress:    ipAddr,
-		ClientId:     token.UserId,
-		LastActivity: time.Now(),
-		StartedAt:    time.Now(),
-		UserAgent:    useragent,
+		RefreshToken:   o.GenerateToken(),
+		SessionId:      token.SessionId,
+		ExpiresIn:      o.TokenExpiresIn,
+		Scope:          token.Scope,
+		IpAddress:      ipAddr,
+		ClientId:       token.UserId,
+		ClientSecretId: token.ClientId,
+		Resources:      token.Resources,
+		LastActivity:   time.Now(),
+		StartedAt:      time.Now(),
+		UserAgent:      useragent,
+	}
+	jti, err := o.newAccessToken(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// the old JWT access token can't be deleted, it's revoked instead
+	err = o.revokeJti(ctx, token.Jti)
+	if err != nil {
+		return nil, err
 	}
 
 	// get the old access token of exist in cache
@@ -247,11 +350,16 @@ func (o *OAuth2) RefreshToken(ctx context.Context, ipAddr, useragent, refreshTok
 		}
 	}
 
+	// only one refresh can consume the token, a concurrent one is a reuse
 	tx := o.DB.Begin()
-	err = tx.Save(token).Error
-	if err != nil {
+	res := tx.Model(token).Where("consumed_at IS NULL").Update("consumed_at", time.Now())
+	if res.Error != nil {
 		tx.Rollback()
-		return nil, err
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		tx.Rollback()
+		return o.refreshTokenReused(ctx, token)
 	}
 
 	newToken := &model.Token{
@@ -262,6 +370,12 @@ func (o *OAuth2) RefreshToken(ctx context.Context, ipAddr, useragent, refreshTok
 		Scope:        config.Scope,
 		IpAddress:    token.IpAddress,
 		UserId:    token.UserId,
+		ClientId:     token.ClientId,
+		Resources:    token.Resources,
+	}
+	if jti != "" {
+		newToken.AccessToken = ""
+		newToken.Jti = jti
 	}
 
 	err = tx.Save(newToken).Error
@@ -275,9 +389,11 @@ func (o *OAuth2) RefreshToken(ctx context.Context, ipAddr, useragent, refreshTok
 		return nil, err
 	}
 
-	err = o.Cache.Set(ctx, config.AccessToken, b, o.TokenExpiresIn)
-	if err != nil {
-		return nil, err
+	if jti == "" {
+		err = o.Cache.Set(ctx, config.AccessToken, b, o.TokenExpiresIn)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	err = o.Cache.Set(ctx, cache.SessionsKey(config.SessionId), b, o.TokenExpiresIn)
@@ -285,13 +401,36 @@ func (o *OAuth2) RefreshToken(ctx context.Context, ipAddr, useragent, refreshTok
 		return nil, err
 	}
 
-	o.NewActiveSession(config)
+	err = o.NewActiveSession(ctx, config)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
 
 	tx.Commit()
 
+	o.issueIdToken(ctx, config)
+
 	return config, nil
 }
 
+// refreshTokenReused revokes the family of the reused refresh token and logs its session out
+func (o *OAuth2) refreshTokenReused(ctx context.Context, token *model.Token) (*Config, error) {
+	config := &Config{
+		ClientId:       token.UserId,
+		ClientSecretId: token.ClientId,
+		SessionId:      token.SessionId,
+		Scope:          token.Scope,
+	}
+
+	err := o.RevokeSession(ctx, token.SessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	return config, errors.ErrRefreshTokenReused
+}
+
 // returns true(valid) if the token exists otherwise returns false(unvalid)
 func (o *OAuth2) VerifyToken(ctx context.Context, accessToken string) (bool, error) {
 	_, err := o.Cache.Get(ctx, accessToken)
@@ -383,16 +522,89 @@ func (o *OAuth2) Logout(ctx context.Context, accessToken string, sessionId strin
 		}
 	}
 
-	o.DeleteActiveSession(sessionId)
+	// JWT access tokens of the session stay valid until revoked
+	err = o.revokeSession(ctx, sessionId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = o.DeleteActiveSession(ctx, sessionId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
 
 	tx.Commit()
 
 	return nil
 }
 
+// RevokeSession revokes every refresh token of the session and logs it out, which
+// revokes its access tokens as well
+func (o *OAuth2) RevokeSession(ctx context.Context, sessionId string) error {
+	err := o.DB.WithContext(ctx).Model(&model.Token{}).
+		Where("session_id = ? AND revoked_at IS NULL", sessionId).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		return err
+	}
+
+	// the newest token of the session holds its current access token
+	current := &model.Token{}
+	err = o.DB.WithContext(ctx).Where("session_id = ?", sessionId).Order("id DESC").First(current).Error
+	if err != nil {
+		return err
+	}
+
+	// the session may already be logged out
+	err = o.Logout(ctx, current.AccessToken, sessionId)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+
+	return nil
+}
+
+// LogoutUser logs every active session of the user out except the kept one, e.g. the session
+// changing the password, and returns the ids of the sessions logged out
+func (o *OAuth2) LogoutUser(ctx context.Context, userId int32, keepSessionId string) ([]string, error) {
+	sessions := []*model.Session{}
+	err := o.DB.WithContext(ctx).
+		Where("user_id = ? AND finished_at IS NULL AND session_id <> ?", userId, keepSessionId).
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	sessionIds := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		// the newest token of the session holds its current access token
+		current := &model.Token{}
+		err = o.DB.WithContext(ctx).Where("session_id = ?", session.SessionId).Order("id DESC").First(current).Error
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return sessionIds, err
+		}
+
+		err = o.Logout(ctx, current.AccessToken, session.SessionId)
+		if err != nil {
+			return sessionIds, err
+		}
+		sessionIds = append(sessionIds, session.SessionId)
+	}
+
+	return sessionIds, nil
+}
+
 func (o *OAuth2) LogoutAll() {
-	for _, v := range o.SessionsList {
-		o.Logout(context.Background(), v.AccessToken, v.SessionId)
+	ctx := context.Background()
+	sessions, err := o.Sessions.All(ctx)
+	if err != nil {
+		o.Log.Logger.Errorf("error getting the active sessions: %v", err)
+		return
+	}
+	for _, v := range sessions {
+		o.Logout(ctx, v.AccessToken, v.SessionId)
 	}
 }
 
@@ -0,0 +1,105 @@
+package oauth2
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Profile holds the standard OpenID Connect claims of a user
+type Profile struct {
+	Name              string `json:"name,omitempty"`
+	GivenName         string `json:"given_name,omitempty"`
+	FamilyName        string `json:"family_name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Email             string `json:"email,omitempty"`
+	PhoneNumber       string `json:"phone_number,omitempty"`
+	// Casbin role of the user
+	Role string `json:"role,omitempty"`
+}
+
+func NewProfile(user *model.User) Profile {
+	return Profile{
+		Name:              strings.TrimSpace(user.FirstName + " " + user.LastName),
+		GivenName:         user.FirstName,
+		FamilyName:        user.LastName,
+		PreferredUsername: user.Username,
+		Email:             user.Email,
+		PhoneNumber:       user.Phone,
+		Role:              user.Role,
+	}
+}
+
+// UserInfo is the response of the userinfo endpoint
+type UserInfo struct {
+	Subject string `json:"sub"`
+	Profile
+}
+
+type IdTokenClaims struct {
+	jwt.RegisteredClaims
+	Profile
+	Nonce     string `json:"nonce,omitempty"`
+	AuthTime  int64  `json:"auth_time,omitempty"`
+	SessionId string `json:"sid,omitempty"`
+}
+
+// IdToken returns the signed id token of the session, the audience is the OAuth client
+// the session was issued to or the gateway audience for first-party logins
+func (o *OAuth2) IdToken(ctx context.Context, config *Config) (string, error) {
+	user := &model.User{}
+	err := o.DB.WithContext(ctx).First(user, config.ClientId).Error
+	if err != nil {
+		return "", err
+	}
+
+	// the user authenticated when the session started, not when it was refreshed
+	authTime := config.StartedAt
+	session := &model.Session{}
+	err = o.DB.WithContext(ctx).Where("session_id = ?", config.SessionId).First(session).Error
+	if err == nil {
+		authTime = session.StartedAt
+	}
+
+	audience := o.Audience
+	if config.ClientSecretId != "" {
+		audience = config.ClientSecretId
+	}
+
+	now := time.Now()
+	claims := &IdTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    o.Issuer,
+			Subject:   strconv.Itoa(int(user.Id)),
+			Audience:  jwt.ClaimStrings{audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Duration(o.IdTokenExpiresIn) * time.Second)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		Profile:   NewProfile(user),
+		Nonce:     config.Nonce,
+		AuthTime:  authTime.Unix(),
+		SessionId: config.SessionId,
+	}
+
+	return o.Keys.Sign(claims)
+}
+
+// issueIdToken sets the id token of the session when the gateway signs tokens, a failure
+// is logged but doesn't fail the login since the access token is usable without it
+func (o *OAuth2) issueIdToken(ctx context.Context, config *Config) {
+	if o.Keys == nil {
+		return
+	}
+
+	idToken, err := o.IdToken(ctx, config)
+	if err != nil {
+		o.Log.Logger.Errorf("error issuing id token of session %s: %v", config.SessionId, err)
+		return
+	}
+	config.IdToken = idToken
+}
@@ -0,0 +1,172 @@
+package oauth2
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"greenlync-api-gateway/config"
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/errors"
+
+	"gorm.io/gorm"
+)
+
+// PasswordPolicy is checked on every new password, the current passwords of the users aren't
+// checked until they change them
+type PasswordPolicy struct {
+	// characters of a password
+	MinLength int
+	// of lowercase, uppercase, digits and symbols
+	MinClasses int
+	// previous passwords of a user that can't be reused, 0 allows any
+	History int
+	// lowercase common and breached passwords
+	blocklist map[string]struct{}
+}
+
+func NewPasswordPolicy(cfg config.PasswordPolicy) *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength:  cfg.MinLength,
+		MinClasses: cfg.MinClasses,
+		History:    cfg.History,
+		blocklist:  make(map[string]struct{}),
+	}
+}
+
+// LoadBlocklist reads the refused passwords from the file, one per line, empty lines and lines
+// starting with # are skipped
+func (p *PasswordPolicy) LoadBlocklist(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	blocklist := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		blocklist[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	p.blocklist = blocklist
+	return nil
+}
+
+// Validate checks the password against the policy, the returned error wraps ErrWeakPassword
+// and tells the rule it breaks
+func (p *PasswordPolicy) Validate(password string) error {
+	length := len([]rune(password))
+	if length < p.MinLength {
+		return fmt.Errorf("%w: it should have at least %d characters", errors.ErrWeakPassword, p.MinLength)
+	}
+	if len(password) > MaxPasswordLength {
+		return fmt.Errorf("%w: it should have at most %d bytes", errors.ErrWeakPassword, MaxPasswordLength)
+	}
+
+	if passwordClasses(password) < p.MinClasses {
+		return fmt.Errorf("%w: it should mix at least %d of lowercase, uppercase, digits and symbols", errors.ErrWeakPassword, p.MinClasses)
+	}
+
+	if _, ok := p.blocklist[strings.ToLower(password)]; ok {
+		return fmt.Errorf("%w: it's a common or breached password", errors.ErrWeakPassword)
+	}
+
+	return nil
+}
+
+// passwordClasses counts the character classes of the password among lowercase, uppercase,
+// digits and symbols
+func passwordClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// ValidatePassword checks a new password of the user against the password policy and their
+// previous passwords, userId is 0 for a user being created
+func (o *OAuth2) ValidatePassword(ctx context.Context, userId int32, password string) error {
+	err := o.Passwords.Validate(password)
+	if err != nil {
+		return err
+	}
+
+	if userId == 0 || o.Passwords.History <= 0 {
+		return nil
+	}
+
+	hashes := []string{}
+	err = o.DB.WithContext(ctx).Model(&model.PasswordHistory{}).
+		Where("user_id = ?", userId).
+		Order("id DESC").
+		Limit(o.Passwords.History).
+		Pluck("password_hash", &hashes).Error
+	if err != nil {
+		return err
+	}
+
+	// the users created before the history have their current password only
+	user := &model.User{}
+	err = o.DB.WithContext(ctx).Select("password_hash").First(user, userId).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+	if user.PasswordHash != "" {
+		hashes = append(hashes, user.PasswordHash)
+	}
+
+	for _, hash := range hashes {
+		if ComparePassword(hash, password) {
+			return fmt.Errorf("%w: it should differ from your last %d passwords", errors.ErrWeakPassword, o.Passwords.History)
+		}
+	}
+
+	return nil
+}
+
+// RecordPassword adds the new password hash of the user to their password history, only the
+// hashes the policy checks are kept. tx is the transaction storing the password
+func (o *OAuth2) RecordPassword(tx *gorm.DB, userId int32, hash string) error {
+	if o.Passwords.History <= 0 {
+		return nil
+	}
+
+	err := tx.Create(&model.PasswordHistory{UserId: userId, PasswordHash: hash}).Error
+	if err != nil {
+		return err
+	}
+
+	outdated := []int32{}
+	err = tx.Model(&model.PasswordHistory{}).
+		Where("user_id = ?", userId).
+		Order("id DESC").
+		Offset(o.Passwords.History).
+		Limit(1000).
+		Pluck("id", &outdated).Error
+	if err != nil || len(outdated) == 0 {
+		return err
+	}
+
+	return tx.Delete(&model.PasswordHistory{}, outdated).Error
+}
@@ -0,0 +1,33 @@
+package oauth2
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"greenlync-api-gateway/config"
+	"greenlync-api-gateway/pkg/errors"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	policy := NewPasswordPolicy(config.PasswordPolicy{MinLength: 10, MinClasses: 3})
+
+	require.NoError(t, policy.Validate("correct-Horse7"))
+	require.ErrorIs(t, policy.Validate("Short-1"), errors.ErrWeakPassword)
+	require.ErrorIs(t, policy.Validate("onlylowercaseletters"), errors.ErrWeakPassword)
+	require.ErrorIs(t, policy.Validate(strings.Repeat("aB1-", 33)), errors.ErrWeakPassword)
+
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	err := os.WriteFile(path, []byte("# common passwords\n\nCorrect-Horse7\n"), 0o600)
+	require.NoError(t, err)
+	require.NoError(t, policy.LoadBlocklist(path))
+
+	// the blocklist ignores the case
+	require.ErrorIs(t, policy.Validate("correct-horse7"), errors.ErrWeakPassword)
+	require.NoError(t, policy.Validate("Battery-Staple9"))
+
+	require.Error(t, policy.LoadBlocklist(filepath.Join(t.TempDir(), "missing.txt")))
+}
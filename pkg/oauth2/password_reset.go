@@ -0,0 +1,50 @@
+package oauth2
+
+import (
+	"context"
+	"time"
+
+	"greenlync-api-gateway/pkg/cache"
+	"greenlync-api-gateway/pkg/errors"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// how long a password reset code can be used
+	PasswordResetTTL = 900
+	// characters of the password reset codes sent by email
+	PasswordResetCodeLength = 12
+	// seconds between two password reset emails to the same address
+	PasswordResetInterval = 60
+)
+
+// ThrottlePasswordReset reserves the next password reset email to the address, when one was sent
+// within the interval it returns how long to wait instead
+func (o *OAuth2) ThrottlePasswordReset(ctx context.Context, email string) (time.Duration, error) {
+	return o.throttleEmail(ctx, cache.PasswordResetThrottleKey(normalizeEmail(email)), time.Duration(PasswordResetInterval)*time.Second)
+}
+
+// NewPasswordReset returns a password reset code of the user, the previous code of the user stops working
+func (o *OAuth2) NewPasswordReset(ctx context.Context, userId int32) (string, error) {
+	return passwordResetCodes.new(ctx, o.Cache, userId, PasswordResetCodeLength, PasswordResetTTL)
+}
+
+// PasswordResetUser returns the user of the password reset code without using the code, so a
+// refused new password doesn't cost the user their code
+func (o *OAuth2) PasswordResetUser(ctx context.Context, code string) (int32, error) {
+	userId, err := passwordResetCodes.lookup(ctx, o.Cache, code)
+	if err == redis.Nil {
+		return 0, errors.ErrInvalidResetCode
+	}
+	return userId, err
+}
+
+// ConsumePasswordReset returns the user of the password reset code, a code can't be used twice
+func (o *OAuth2) ConsumePasswordReset(ctx context.Context, code string) (int32, error) {
+	userId, err := passwordResetCodes.consume(ctx, o.Cache, code)
+	if err == redis.Nil {
+		return 0, errors.ErrInvalidResetCode
+	}
+	return userId, err
+}
@@ -4,6 +4,7 @@
 package oauth2
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -18,10 +19,30 @@ func TestCrypto(t *testing.T) {
 		require.NotEmpty(t, password)
 
 		require.True(t, ComparePassword(password, "saif"))
+		require.False(t, ComparePassword(password, "saif1"))
+		require.False(t, NeedsRehash(password))
 	})
 	t.Run("tooLongPassword", func(t *testing.T) {
-		password, err := EncryptPassword("W7Px4TcHrQnljd1212KGJ9skL1gdIBvuXZftqY2aU0mo3SiDhfewfefd12C6z5wEpRbFOVeM8NyA")
-		require.EqualError(t, err, bcrypt.ErrPasswordTooLong.Error())
+		password, err := EncryptPassword(strings.Repeat("W7Px4TcHrQnljd1212KGJ9skL1gdIBvuX", 4) + "Z")
+		require.EqualError(t, err, ErrPasswordTooLong.Error())
 		require.Empty(t, password)
 	})
+	t.Run("legacyBcrypt", func(t *testing.T) {
+		password, err := bcrypt.GenerateFromPassword([]byte("saif"), bcrypt.MinCost)
+		require.NoError(t, err)
+
+		require.True(t, ComparePassword(string(password), "saif"))
+		require.False(t, ComparePassword(string(password), "saif1"))
+		require.True(t, NeedsRehash(string(password)))
+	})
+	t.Run("outdatedParams", func(t *testing.T) {
+		defaults := DefaultArgon2Params
+		DefaultArgon2Params.Iterations = 1
+		password, err := EncryptPassword("saif")
+		DefaultArgon2Params = defaults
+		require.NoError(t, err)
+
+		require.True(t, ComparePassword(password, "saif"))
+		require.True(t, NeedsRehash(password))
+	})
 }
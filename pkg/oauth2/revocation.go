@@ -0,0 +1,150 @@
+package oauth2
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"greenlync-api-gateway/pkg/cache"
+	"greenlync-api-gateway/pkg/logger"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// every replica reloads the revocation list on this interval in case it missed a published revocation
+var RevocationReloadInterval = 1 * time.Minute
+
+// RevokedJti is the revocation entry of a JWT access token
+func RevokedJti(jti string) string {
+	return fmt.Sprint("jti:", jti)
+}
+
+// RevokedSession is the revocation entry of every access token of a session
+func RevokedSession(sessionId string) string {
+	return fmt.Sprint("sid:", sessionId)
+}
+
+// RevocationList keeps the revoked JWT access tokens and sessions, JWTs are verified without
+// redis so each replica holds the list in memory. Revocations are stored in a redis sorted set
+// and published so every replica applies them right away, an entry is kept until the tokens it revokes expire
+type RevocationList struct {
+	redis   *redis.Client
+	log     *logger.Logger
+	mu      sync.RWMutex
+	revoked map[string]time.Time
+}
+
+func NewRevocationList(redis *redis.Client, log *logger.Logger) (*RevocationList, error) {
+	r := &RevocationList{
+		redis:   redis,
+		log:     log,
+		revoked: make(map[string]time.Time),
+	}
+
+	err := r.reload(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Revoke revokes the entry until expiresAt, when the tokens it revokes are expired anyway
+func (r *RevocationList) Revoke(ctx context.Context, entry string, expiresAt time.Time) error {
+	r.add(entry, expiresAt)
+
+	pipe := r.redis.TxPipeline()
+	pipe.ZAdd(ctx, cache.KeyRevokedTokens, &redis.Z{Score: float64(expiresAt.Unix()), Member: entry})
+	pipe.Publish(ctx, cache.ChannelRevokedTokens, fmt.Sprint(entry, "|", expiresAt.Unix()))
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+// IsRevoked reports whether one of the entries is revoked
+func (r *RevocationList) IsRevoked(entries ...string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	for _, entry := range entries {
+		if expiresAt, ok := r.revoked[entry]; ok && expiresAt.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch applies the revocations published by the other replicas and reloads the list periodically
+func (r *RevocationList) Watch() {
+	ctx := context.Background()
+	pubsub := r.redis.Subscribe(ctx, cache.ChannelRevokedTokens)
+	defer pubsub.Close()
+
+	ticker := time.NewTicker(RevocationReloadInterval)
+	defer ticker.Stop()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case msg := <-messages:
+			entry, expiresAt, ok := strings.Cut(msg.Payload, "|")
+			unix, err := strconv.ParseInt(expiresAt, 10, 64)
+			if !ok || err != nil {
+				r.log.Logger.Errorf("invalid token revocation %s", msg.Payload)
+				continue
+			}
+			r.add(entry, time.Unix(unix, 0))
+		case <-ticker.C:
+			err := r.reload(ctx)
+			if err != nil {
+				r.log.Logger.Errorf("error reloading token revocations: %v", err)
+			}
+		}
+	}
+}
+
+func (r *RevocationList) add(entry string, expiresAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.revoked[entry] = expiresAt
+}
+
+// reload drops the expired entries and merges the list stored in redis
+func (r *RevocationList) reload(ctx context.Context) error {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	err := r.redis.ZRemRangeByScore(ctx, cache.KeyRevokedTokens, "-inf", now).Err()
+	if err != nil {
+		return err
+	}
+
+	entries, err := r.redis.ZRangeByScoreWithScores(ctx, cache.KeyRevokedTokens, &redis.ZRangeBy{Min: now, Max: "+inf"}).Result()
+	if err != nil {
+		return err
+	}
+
+	revoked := make(map[string]time.Time, len(entries))
+	for _, z := range entries {
+		entry, ok := z.Member.(string)
+		if !ok {
+			continue
+		}
+		revoked[entry] = time.Unix(int64(z.Score), 0)
+	}
+
+	// entries are only ever dropped once expired, keep the ones revoked meanwhile
+	r.mu.Lock()
+	for entry, expiresAt := range r.revoked {
+		if _, ok := revoked[entry]; !ok && expiresAt.After(time.Now()) {
+			revoked[entry] = expiresAt
+		}
+	}
+	r.revoked = revoked
+	r.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,227 @@
+package oauth2
+
+import (
+	stderrors "errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	model "greenlync-api-gateway/model/common/v1"
+)
+
+// Config store keys of the concurrent sessions policy. sessions.max, sessions.on_limit and
+// sessions.channel.<channel> apply to every role, sessions.role.<role>.<key> overrides them for a role
+const (
+	SessionsConfigPrefix     = "sessions."
+	SessionsConfigRolePrefix = "sessions.role."
+)
+
+// What happens to a login once the user has the maximum sessions
+const (
+	// the oldest session is logged out to make room
+	SessionLimitEvict = "evict"
+	// the login is refused until another session logs out
+	SessionLimitReject = "reject"
+)
+
+// concurrent sessions of a user when the config store has no sessions.max
+var DefaultMaxSessions = 5
+
+// SessionPolicy limits the concurrent sessions of the users of a role
+type SessionPolicy struct {
+	// sessions of a user across all channels, 0 is unlimited
+	Max int `json:"max"`
+	// evict or reject
+	OnLimit string `json:"on_limit"`
+	// sessions of a user on a channel, a missing channel or 0 is unlimited
+	Channels map[model.ChannelType]int `json:"channels,omitempty"`
+}
+
+// SessionPolicies are the policy of every role and the role overrides
+type SessionPolicies struct {
+	Default *SessionPolicy
+	Roles   map[string]*SessionPolicy
+}
+
+func DefaultSessionPolicy() *SessionPolicy {
+	return &SessionPolicy{
+		Max:      DefaultMaxSessions,
+		OnLimit:  SessionLimitEvict,
+		Channels: map[model.ChannelType]int{},
+	}
+}
+
+func (p *SessionPolicy) clone() *SessionPolicy {
+	c := *p
+	c.Channels = make(map[model.ChannelType]int, len(p.Channels))
+	for k, v := range p.Channels {
+		c.Channels[k] = v
+	}
+	return &c
+}
+
+// NewSessionPolicies builds the session policies from the sessions.* configs, invalid configs are
+// skipped and returned as an error next to the valid policies
+func NewSessionPolicies(configs []*model.Config) (*SessionPolicies, error) {
+	policies := &SessionPolicies{
+		Default: DefaultSessionPolicy(),
+		Roles:   make(map[string]*SessionPolicy),
+	}
+
+	errs := make([]error, 0)
+
+	// the role policies start from the default one so it's parsed first
+	for _, cfg := range configs {
+		if !strings.HasPrefix(cfg.Key, SessionsConfigPrefix) || strings.HasPrefix(cfg.Key, SessionsConfigRolePrefix) {
+			continue
+		}
+
+		err := policies.Default.set(strings.TrimPrefix(cfg.Key, SessionsConfigPrefix), cfg.Value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", cfg.Key, err))
+		}
+	}
+
+	for _, cfg := range configs {
+		if !strings.HasPrefix(cfg.Key, SessionsConfigRolePrefix) {
+			continue
+		}
+
+		role, key, ok := strings.Cut(strings.TrimPrefix(cfg.Key, SessionsConfigRolePrefix), ".")
+		if !ok || role == "" {
+			errs = append(errs, fmt.Errorf("%s: should be %s<role>.<key>", cfg.Key, SessionsConfigRolePrefix))
+			continue
+		}
+
+		policy, ok := policies.Roles[role]
+		if !ok {
+			policy = policies.Default.clone()
+		}
+
+		err := policy.set(key, cfg.Value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", cfg.Key, err))
+			continue
+		}
+		policies.Roles[role] = policy
+	}
+
+	return policies, stderrors.Join(errs...)
+}
+
+// set applies a max, on_limit or channel.<channel> key
+func (p *SessionPolicy) set(key, value string) error {
+	value = strings.TrimSpace(value)
+
+	switch {
+	case key == "max":
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return fmt.Errorf("should be a number of sessions, 0 for unlimited")
+		}
+		p.Max = limit
+	case key == "on_limit":
+		if value != SessionLimitEvict && value != SessionLimitReject {
+			return fmt.Errorf("should be %s or %s", SessionLimitEvict, SessionLimitReject)
+		}
+		p.OnLimit = value
+	case strings.HasPrefix(key, "channel."):
+		name := strings.TrimPrefix(key, "channel.")
+		channel, ok := channelTypes()[name]
+		if !ok {
+			return fmt.Errorf("unknown channel %s", name)
+		}
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return fmt.Errorf("should be a number of sessions, 0 for unlimited")
+		}
+		p.Channels[channel] = limit
+	default:
+		return fmt.Errorf("unknown sessions key")
+	}
+
+	return nil
+}
+
+func channelTypes() map[string]model.ChannelType {
+	channels := make(map[string]model.ChannelType, len(model.ChannelType_name))
+	for k, v := range model.ChannelType_name {
+		channels[v] = model.ChannelType(k)
+	}
+	return channels
+}
+
+// For returns the policy of the role
+func (p *SessionPolicies) For(role string) *SessionPolicy {
+	if policy, ok := p.Roles[role]; ok {
+		return policy
+	}
+	return p.Default
+}
+
+// Admit decides a new login on the channel given the active sessions of the user. It returns the
+// sessions to log out to make room for it, or false when the login is rejected
+func (p *SessionPolicy) Admit(sessions []*Config, channel model.ChannelType, channelOf func(*Config) model.ChannelType) ([]*Config, bool) {
+	// the oldest sessions are evicted first
+	sessions = slices.Clone(sessions)
+	slices.SortFunc(sessions, func(a, b *Config) int {
+		return a.StartedAt.Compare(b.StartedAt)
+	})
+
+	evict := make([]*Config, 0)
+
+	if limit := p.Channels[channel]; limit > 0 {
+		same := make([]*Config, 0, len(sessions))
+		for _, session := range sessions {
+			if channelOf(session) == channel {
+				same = append(same, session)
+			}
+		}
+		if len(same) >= limit {
+			if p.OnLimit == SessionLimitReject {
+				return nil, false
+			}
+			evict = append(evict, same[:len(same)-limit+1]...)
+		}
+	}
+
+	if p.Max > 0 && len(sessions)-len(evict) >= p.Max {
+		if p.OnLimit == SessionLimitReject {
+			return nil, false
+		}
+		for _, session := range sessions {
+			if len(sessions)-len(evict) < p.Max {
+				break
+			}
+			if !slices.Contains(evict, session) {
+				evict = append(evict, session)
+			}
+		}
+	}
+
+	return evict, true
+}
+
+// ReloadSessionPolicies loads the sessions.* configs into the session policies
+func (o *OAuth2) ReloadSessionPolicies() error {
+	configs := []*model.Config{}
+	err := o.DB.Where("`key` LIKE ?", SessionsConfigPrefix+"%").Find(&configs).Error
+	if err != nil {
+		return err
+	}
+
+	policies, err := NewSessionPolicies(configs)
+	o.sessionPolicies.Store(policies)
+
+	return err
+}
+
+// SessionPolicy returns the concurrent sessions policy of the role
+func (o *OAuth2) SessionPolicy(role string) *SessionPolicy {
+	policies := o.sessionPolicies.Load()
+	if policies == nil {
+		return DefaultSessionPolicy()
+	}
+	return policies.For(role)
+}
@@ -0,0 +1,69 @@
+package oauth2
+
+import (
+	"testing"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSessionPolicies(t *testing.T) {
+	policies, err := NewSessionPolicies([]*model.Config{
+		{Key: "sessions.role.Admin.max", Value: "1"},
+		{Key: "sessions.max", Value: "3"},
+		{Key: "sessions.channel.mobile", Value: "1"},
+		{Key: "sessions.role.Admin.on_limit", Value: "reject"},
+		{Key: "mfa.role.Admin", Value: "true"},
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, &SessionPolicy{Max: 3, OnLimit: SessionLimitEvict, Channels: map[model.ChannelType]int{model.ChannelType_Mobile: 1}}, policies.For("User"))
+	// the role overrides start from the default policy whatever the order of the configs
+	require.Equal(t, &SessionPolicy{Max: 1, OnLimit: SessionLimitReject, Channels: map[model.ChannelType]int{model.ChannelType_Mobile: 1}}, policies.For("Admin"))
+
+	_, err = NewSessionPolicies([]*model.Config{{Key: "sessions.max", Value: "-1"}})
+	require.Error(t, err)
+	_, err = NewSessionPolicies([]*model.Config{{Key: "sessions.on_limit", Value: "block"}})
+	require.Error(t, err)
+	_, err = NewSessionPolicies([]*model.Config{{Key: "sessions.channel.tv", Value: "1"}})
+	require.Error(t, err)
+	_, err = NewSessionPolicies([]*model.Config{{Key: "sessions.role.Admin", Value: "1"}})
+	require.Error(t, err)
+}
+
+func TestSessionPolicyAdmit(t *testing.T) {
+	now := time.Now()
+	// the channel of the test sessions is in their user agent
+	channelOf := func(cfg *Config) model.ChannelType {
+		if cfg.UserAgent == "mobile" {
+			return model.ChannelType_Mobile
+		}
+		return model.ChannelType_Web
+	}
+	web1 := &Config{SessionId: "web1", UserAgent: "web", StartedAt: now.Add(-3 * time.Hour)}
+	mobile := &Config{SessionId: "mobile", UserAgent: "mobile", StartedAt: now.Add(-2 * time.Hour)}
+	web2 := &Config{SessionId: "web2", UserAgent: "web", StartedAt: now.Add(-time.Hour)}
+	sessions := []*Config{web2, mobile, web1}
+
+	policy := &SessionPolicy{Max: 3, OnLimit: SessionLimitEvict, Channels: map[model.ChannelType]int{}}
+	evict, ok := policy.Admit(sessions, model.ChannelType_Web, channelOf)
+	require.True(t, ok)
+	require.Equal(t, []*Config{web1}, evict)
+
+	// a channel limit evicts the oldest session of the channel
+	policy.Channels[model.ChannelType_Mobile] = 1
+	evict, ok = policy.Admit(sessions, model.ChannelType_Mobile, channelOf)
+	require.True(t, ok)
+	require.Equal(t, []*Config{mobile}, evict)
+
+	policy.Max = 0
+	evict, ok = policy.Admit(sessions, model.ChannelType_Web, channelOf)
+	require.True(t, ok)
+	require.Empty(t, evict)
+
+	policy.OnLimit = SessionLimitReject
+	_, ok = policy.Admit(sessions, model.ChannelType_Mobile, channelOf)
+	require.False(t, ok)
+}
@@ -0,0 +1,329 @@
+package oauth2
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"greenlync-api-gateway/pkg/cache"
+	"greenlync-api-gateway/pkg/shortuuid"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/goccy/go-json"
+)
+
+// SessionRegistry keeps the active sessions in redis so every replica sees the same sessions.
+// The sessions are a hash by session id indexed by their public id and by user, the last activity
+// is a sorted set so the idle sessions are a range query and the websocket connections are held
+// per replica, a connection of a replica that stopped sending heartbeats no longer keeps its session active
+type SessionRegistry struct {
+	redis *redis.Client
+	// id of this replica, it holds its websocket connections
+	replica string
+	// last activity of the sessions touched since the last flush, keeps the writes off the request path
+	mu      sync.Mutex
+	touched map[string]int64
+}
+
+func NewSessionRegistry(redis *redis.Client) *SessionRegistry {
+	return &SessionRegistry{
+		redis:   redis,
+		replica: shortuuid.New(),
+		touched: make(map[string]int64),
+	}
+}
+
+// Replica returns the id of this replica
+func (r *SessionRegistry) Replica() string {
+	return r.replica
+}
+
+// Add registers the session or updates it when its tokens are refreshed, a refreshed session
+// keeps its id, start and remember me
+func (r *SessionRegistry) Add(ctx context.Context, cfg *Config) error {
+	current, ok, err := r.Get(ctx, cfg.SessionId)
+	if err != nil {
+		return err
+	}
+	if ok {
+		if cfg.Id == "" {
+			cfg.Id = current.Id
+		}
+		cfg.StartedAt = current.StartedAt
+		cfg.RememberMe = cfg.RememberMe || current.RememberMe
+	}
+
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	lastActivity := cfg.LastActivity
+	if lastActivity.IsZero() {
+		lastActivity = time.Now()
+	}
+
+	pipe := r.redis.TxPipeline()
+	pipe.HSet(ctx, cache.KeySessionsMap, cfg.SessionId, b)
+	if cfg.Id != "" {
+		pipe.HSet(ctx, cache.KeySessionIds, cfg.Id, cfg.SessionId)
+	}
+	pipe.SAdd(ctx, cache.UserSessionsKey(cfg.ClientId), cfg.SessionId)
+	pipe.ZAdd(ctx, cache.KeySessionsActivity, &redis.Z{Score: float64(lastActivity.Unix()), Member: cfg.SessionId})
+	_, err = pipe.Exec(ctx)
+
+	return err
+}
+
+// Touch records an activity of the session, it's written on the next flush
+func (r *SessionRegistry) Touch(sessionId string) {
+	r.mu.Lock()
+	r.touched[sessionId] = time.Now().Unix()
+	r.mu.Unlock()
+}
+
+// Flush writes the activities recorded since the last flush, nothing happens for the sessions
+// that aren't active anymore
+func (r *SessionRegistry) Flush(ctx context.Context) error {
+	r.mu.Lock()
+	touched := r.touched
+	r.touched = make(map[string]int64)
+	r.mu.Unlock()
+
+	if len(touched) == 0 {
+		return nil
+	}
+
+	pipe := r.redis.Pipeline()
+	for sessionId, at := range touched {
+		pipe.ZAddXX(ctx, cache.KeySessionsActivity, &redis.Z{Score: float64(at), Member: sessionId})
+	}
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+// Remove unregisters the session and its indexes
+func (r *SessionRegistry) Remove(ctx context.Context, sessionId string) error {
+	cfg, ok, err := r.Get(ctx, sessionId)
+	if err != nil {
+		return err
+	}
+
+	pipe := r.redis.TxPipeline()
+	pipe.HDel(ctx, cache.KeySessionsMap, sessionId)
+	pipe.ZRem(ctx, cache.KeySessionsActivity, sessionId)
+	pipe.HDel(ctx, cache.KeySessionsWs, sessionId)
+	if ok {
+		if cfg.Id != "" {
+			pipe.HDel(ctx, cache.KeySessionIds, cfg.Id)
+		}
+		pipe.SRem(ctx, cache.UserSessionsKey(cfg.ClientId), sessionId)
+	}
+	_, err = pipe.Exec(ctx)
+
+	return err
+}
+
+// SetWs marks the session connected on a websocket of this replica, a disconnection counts as an activity
+func (r *SessionRegistry) SetWs(ctx context.Context, sessionId string, connected bool) error {
+	if connected {
+		return r.redis.HSet(ctx, cache.KeySessionsWs, sessionId, r.replica).Err()
+	}
+
+	pipe := r.redis.TxPipeline()
+	pipe.HDel(ctx, cache.KeySessionsWs, sessionId)
+	pipe.ZAddXX(ctx, cache.KeySessionsActivity, &redis.Z{Score: float64(time.Now().Unix()), Member: sessionId})
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+// Get returns the session without its last activity and websocket flag
+func (r *SessionRegistry) Get(ctx context.Context, sessionId string) (*Config, bool, error) {
+	b, err := r.redis.HGet(ctx, cache.KeySessionsMap, sessionId).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	cfg := &Config{}
+	err = json.Unmarshal(b, cfg)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return cfg, true, nil
+}
+
+// GetById returns the session by its public id
+func (r *SessionRegistry) GetById(ctx context.Context, id string) (*Config, bool, error) {
+	sessionId, err := r.redis.HGet(ctx, cache.KeySessionIds, id).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	cfgs, err := r.load(ctx, sessionId)
+	if err != nil || len(cfgs) == 0 {
+		return nil, false, err
+	}
+
+	return cfgs[0], true, nil
+}
+
+// All returns every active session
+func (r *SessionRegistry) All(ctx context.Context) ([]*Config, error) {
+	sessionIds, err := r.redis.HKeys(ctx, cache.KeySessionsMap).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.load(ctx, sessionIds...)
+}
+
+// ByUser returns the active sessions of the user
+func (r *SessionRegistry) ByUser(ctx context.Context, clientId int32) ([]*Config, error) {
+	sessionIds, err := r.redis.SMembers(ctx, cache.UserSessionsKey(clientId)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	cfgs, err := r.load(ctx, sessionIds...)
+	if err != nil {
+		return nil, err
+	}
+
+	// the sessions removed while the index was read are dropped from it
+	if len(cfgs) < len(sessionIds) {
+		found := make(map[string]bool, len(cfgs))
+		for _, cfg := range cfgs {
+			found[cfg.SessionId] = true
+		}
+		for _, sessionId := range sessionIds {
+			if !found[sessionId] {
+				r.redis.SRem(ctx, cache.UserSessionsKey(clientId), sessionId)
+			}
+		}
+	}
+
+	return cfgs, nil
+}
+
+// Idle returns the sessions with no activity since before and no websocket connection, the
+// connections of replicas that stopped sending heartbeats don't count
+func (r *SessionRegistry) Idle(ctx context.Context, before time.Time) ([]*Config, error) {
+	sessionIds, err := r.redis.ZRangeByScore(ctx, cache.KeySessionsActivity, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(before.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	cfgs, err := r.load(ctx, sessionIds...)
+	if err != nil {
+		return nil, err
+	}
+
+	alive := make(map[string]bool)
+	idle := make([]*Config, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		if !cfg.Ws {
+			idle = append(idle, cfg)
+			continue
+		}
+
+		replica, err := r.redis.HGet(ctx, cache.KeySessionsWs, cfg.SessionId).Result()
+		if err != nil {
+			return nil, err
+		}
+		live, ok := alive[replica]
+		if !ok {
+			n, err := r.redis.Exists(ctx, cache.SessionReplicaKey(replica)).Result()
+			if err != nil {
+				return nil, err
+			}
+			live = n > 0
+			alive[replica] = live
+		}
+		if !live {
+			idle = append(idle, cfg)
+		}
+	}
+
+	return idle, nil
+}
+
+// Heartbeat tells the other replicas the websocket connections of this one are still open for ttl
+func (r *SessionRegistry) Heartbeat(ctx context.Context, ttl time.Duration) error {
+	return r.redis.Set(ctx, cache.SessionReplicaKey(r.replica), 1, ttl).Err()
+}
+
+// Lead elects this replica to expire the idle sessions for ttl, or renews it if it's already
+// elected. It reports whether this replica is the elected one
+func (r *SessionRegistry) Lead(ctx context.Context, ttl time.Duration) (bool, error) {
+	ok, err := r.redis.SetNX(ctx, cache.KeySessionsMonitor, r.replica, ttl).Result()
+	if err != nil || ok {
+		return ok, err
+	}
+
+	leader, err := r.redis.Get(ctx, cache.KeySessionsMonitor).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return false, nil
+		}
+		return false, err
+	}
+	if leader != r.replica {
+		return false, nil
+	}
+
+	return true, r.redis.PExpire(ctx, cache.KeySessionsMonitor, ttl).Err()
+}
+
+// load returns the sessions with their last activity and websocket flag, the missing ones are skipped
+func (r *SessionRegistry) load(ctx context.Context, sessionIds ...string) ([]*Config, error) {
+	if len(sessionIds) == 0 {
+		return []*Config{}, nil
+	}
+
+	pipe := r.redis.Pipeline()
+	sessions := pipe.HMGet(ctx, cache.KeySessionsMap, sessionIds...)
+	ws := pipe.HMGet(ctx, cache.KeySessionsWs, sessionIds...)
+	activities := make([]*redis.FloatCmd, len(sessionIds))
+	for i, sessionId := range sessionIds {
+		activities[i] = pipe.ZScore(ctx, cache.KeySessionsActivity, sessionId)
+	}
+	_, err := pipe.Exec(ctx)
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	cfgs := make([]*Config, 0, len(sessionIds))
+	for i, v := range sessions.Val() {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+
+		cfg := &Config{}
+		err = json.Unmarshal([]byte(s), cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.Ws = ws.Val()[i] != nil
+		if score, err := activities[i].Result(); err == nil {
+			cfg.LastActivity = time.Unix(int64(score), 0)
+		}
+		cfgs = append(cfgs, cfg)
+	}
+
+	return cfgs, nil
+}
@@ -2,6 +2,7 @@ package oauth2
 
 import (
 	"context"
+	"slices"
 	"time"
 )
 
@@ -13,143 +14,119 @@ var (
 // map[session_id]=*config
 type ActiveSessionsList map[string]*Config
 
-func (o *OAuth2) GetActiveSessions() ActiveSessionsList {
-	o.RLock()
-	defer o.RUnlock()
-
-	return o.SessionsList
-}
-
-func (o *OAuth2) GetActiveSessionById(id string) (*Config, bool) {
-	o.RLock()
-	defer o.RUnlock()
+func (o *OAuth2) GetActiveSessions(ctx context.Context) (ActiveSessionsList, error) {
+	cfgs, err := o.Sessions.All(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	for k := range o.SessionsList {
-		if o.SessionsList[k].Id == id {
-			return o.SessionsList[k], true
-		}
+	sessions := make(ActiveSessionsList, len(cfgs))
+	for _, cfg := range cfgs {
+		sessions[cfg.SessionId] = cfg
 	}
 
-	return nil, false
+	return sessions, nil
 }
 
-func (o *OAuth2) GetActiveSessionsCountByClientId(clientId int32) (*Config, int) {
-	o.RLock()
-	defer o.RUnlock()
-
-	count := 0
-	var cfg *Config
-	for k := range o.SessionsList {
-		if o.SessionsList[k].ClientId == clientId {
-			count++
-			if cfg == nil {
-				cfg = o.SessionsList[k]
-			} else {
-				if o.SessionsList[k].StartedAt.Before(cfg.StartedAt) {
-					cfg = o.SessionsList[k]
-				}
-			}
-		}
-	}
-
-	return cfg, count
+func (o *OAuth2) GetActiveSessionById(ctx context.Context, id string) (*Config, bool, error) {
+	return o.Sessions.GetById(ctx, id)
 }
 
 // get all active sessions by client id and retuns the newest one as the first element
-func (o *OAuth2) GetAllActiveSessionsCountByClientId(clientId int32) []*Config {
-	o.RLock()
-	defer o.RUnlock()
-
-	cfg := []*Config{}
-	oldestOne := &Config{}
-	index := -1
-	for k := range o.SessionsList {
-		if o.SessionsList[k].ClientId == clientId {
-			cfg = append(cfg, o.SessionsList[k])
-			if o.SessionsList[k].StartedAt.After(oldestOne.StartedAt) {
-				oldestOne = o.SessionsList[k]
-				index = len(cfg) - 1
-			}
-		}
+func (o *OAuth2) GetAllActiveSessionsCountByClientId(ctx context.Context, clientId int32) ([]*Config, error) {
+	cfg, err := o.Sessions.ByUser(ctx, clientId)
+	if err != nil {
+		return nil, err
 	}
 
-	if index != -1 {
-		cfg[index] = cfg[0]
-		cfg[0] = oldestOne
-	}
+	slices.SortFunc(cfg, func(a, b *Config) int {
+		return b.StartedAt.Compare(a.StartedAt)
+	})
 
-	return cfg
+	return cfg, nil
 }
 
-func (o *OAuth2) NewActiveSession(cfg *Config) {
-	defer o.Unlock()
-	o.Lock()
-
-	o.SessionsList[cfg.SessionId] = cfg
+func (o *OAuth2) NewActiveSession(ctx context.Context, cfg *Config) error {
+	return o.Sessions.Add(ctx, cfg)
 }
 
 func (o *OAuth2) NewActivity(sessionId string) {
-	o.Lock()
-	defer o.Unlock()
-
-	if _, ok := o.getActiveSession(sessionId); ok {
-		o.SessionsList[sessionId].LastActivity = time.Now()
-	}
+	o.Sessions.Touch(sessionId)
 }
 
-func (o *OAuth2) DeleteActiveSession(sessionId string) {
-	defer o.Unlock()
-	o.Lock()
-
-	if _, ok := o.getActiveSession(sessionId); ok {
-		o.Log.Logger.Infof("removing %s session", sessionId)
-		delete(o.SessionsList, sessionId)
-	}
+func (o *OAuth2) DeleteActiveSession(ctx context.Context, sessionId string) error {
+	o.Log.Logger.Infof("removing %s session", sessionId)
+	return o.Sessions.Remove(ctx, sessionId)
 }
 
 func (o *OAuth2) WSConnected(sessionId string) {
-	defer o.Unlock()
-	o.Lock()
-
-	if _, ok := o.getActiveSession(sessionId); ok {
-		o.SessionsList[sessionId].Ws = true
+	err := o.Sessions.SetWs(context.Background(), sessionId, true)
+	if err != nil {
+		o.Log.Logger.Errorf("error marking %s session connected: %v", sessionId, err)
 	}
 }
 
 func (o *OAuth2) WSDisconnected(sessionId string) {
-	defer o.Unlock()
-	o.Lock()
-
-	if _, ok := o.getActiveSession(sessionId); ok {
-		o.SessionsList[sessionId].Ws = false
-		o.SessionsList[sessionId].LastActivity = time.Now()
+	err := o.Sessions.SetWs(context.Background(), sessionId, false)
+	if err != nil {
+		o.Log.Logger.Errorf("error marking %s session disconnected: %v", sessionId, err)
 	}
 }
 
 var onSessionDelete = func(cfg *Config) {}
 
+// MonitoryActivity expires the idle sessions. Every replica sends heartbeats so its websocket
+// connections keep their sessions active, the idle sessions are expired by one elected replica
 func (o *OAuth2) MonitoryActivity() {
 	for {
 		time.Sleep(SessionInterval)
-		oldSessions := make([]*Config, 0)
-		o.RLock()
-		for _, v := range o.SessionsList {
-			if time.Since(v.LastActivity) >= SessionIdleWait && !v.Ws {
-				oldSessions = append(oldSessions, v)
+		ctx, cancel := context.WithTimeout(context.Background(), SessionInterval)
+		o.monitorActivity(ctx)
+		cancel()
+	}
+}
+
+func (o *OAuth2) monitorActivity(ctx context.Context) {
+	// the activities of the requests are batched, an interval behind is far below the idle wait
+	err := o.Sessions.Flush(ctx)
+	if err != nil {
+		o.Log.Logger.Errorf("error recording the sessions activity: %v", err)
+	}
+
+	// a replica missing a few heartbeats is considered gone
+	err = o.Sessions.Heartbeat(ctx, 3*SessionInterval)
+	if err != nil {
+		o.Log.Logger.Errorf("error sending the sessions heartbeat: %v", err)
+	}
+
+	// another replica takes over if the elected one stops renewing
+	lead, err := o.Sessions.Lead(ctx, 2*SessionInterval)
+	if err != nil {
+		o.Log.Logger.Errorf("error electing the sessions monitor: %v", err)
+		return
+	}
+	if !lead {
+		return
+	}
+
+	oldSessions, err := o.Sessions.Idle(ctx, time.Now().Add(-SessionIdleWait))
+	if err != nil {
+		o.Log.Logger.Errorf("error getting the idle sessions: %v", err)
+		return
+	}
+
+	for i := range oldSessions {
+		onSessionDelete(oldSessions[i])
+
+		if !oldSessions[i].RememberMe {
+			err := o.Logout(ctx, oldSessions[i].AccessToken, oldSessions[i].SessionId)
+			if err != nil {
+				o.Log.Logger.Errorf("error removing %s session", oldSessions[i].SessionId)
 			}
-		}
-		o.RUnlock()
-		for i := range oldSessions {
-			onSessionDelete(oldSessions[i])
-
-			if !oldSessions[i].RememberMe {
-				ctx := context.Background()
-				err := o.Logout(ctx, oldSessions[i].AccessToken, oldSessions[i].SessionId)
-				if err != nil {
-					o.Log.Logger.Errorf("error removing %s session", oldSessions[i].SessionId)
-				}
-			} else {
-				o.DeleteActiveSession(oldSessions[i].SessionId)
+		} else {
+			err := o.DeleteActiveSession(ctx, oldSessions[i].SessionId)
+			if err != nil {
+				o.Log.Logger.Errorf("error removing %s session", oldSessions[i].SessionId)
 			}
 		}
 	}
@@ -158,10 +135,3 @@ func (o *OAuth2) MonitoryActivity() {
 func (o *OAuth2) SetOnSessionDelete(f func(cfg *Config)) {
 	onSessionDelete = f
 }
-
-// not concurrent safe
-func (o *OAuth2) getActiveSession(sessionId string) (*Config, bool) {
-
-	v, ok := o.SessionsList[sessionId]
-	return v, ok
-}
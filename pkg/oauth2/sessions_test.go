@@ -4,6 +4,7 @@ import (
 	"context"
 	"sync"
 	"testing"
+	"time"
 	"greenlync-api-gateway/config"
 	"greenlync-api-gateway/pkg/cache"
 	"greenlync-api-gateway/pkg/db"
@@ -32,7 +33,7 @@ func TestSessions(t *testing.T) {
 	for i := 0; i < 10000; i++ {
 		id := shortuuid.New()
 		cg := &Config{ClientId: 1, ClientSecretId: "", SessionId: id}
-		oauth.NewActiveSession(cg)
+		oauth.NewActiveSession(context.Background(), cg)
 		wg.Add(4)
 		go func() {
 			oauth.DeleteSessionId(context.Background(), id)
@@ -43,13 +44,74 @@ func TestSessions(t *testing.T) {
 			wg.Done()
 		}()
 		go func() {
-			oauth.GetActiveSessionById(cg.Id)
+			oauth.GetActiveSessionById(context.Background(), cg.Id)
 			wg.Done()
 		}()
 		go func() {
-			oauth.GetActiveSessions()
+			oauth.GetActiveSessions(context.Background())
 			wg.Done()
 		}()
 	}
 	wg.Wait()
 }
+
+func TestSessionRegistry(t *testing.T) {
+	cfg := config.NewConfig()
+	redis, err := redis.NewRedisClient(cfg)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	registry := NewSessionRegistry(redis)
+
+	session := &Config{Id: shortuuid.New(), ClientId: 1, SessionId: shortuuid.New(), StartedAt: time.Now(), LastActivity: time.Now().Add(-time.Hour)}
+	require.NoError(t, registry.Add(ctx, session))
+	defer registry.Remove(ctx, session.SessionId)
+
+	// refreshing the tokens keeps the id and the start of the session
+	require.NoError(t, registry.Add(ctx, &Config{ClientId: 1, SessionId: session.SessionId, StartedAt: time.Now(), LastActivity: time.Now().Add(-time.Hour)}))
+	got, ok, err := registry.GetById(ctx, session.Id)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, session.StartedAt.Unix(), got.StartedAt.Unix())
+
+	sessions, err := registry.ByUser(ctx, 1)
+	require.NoError(t, err)
+	require.Contains(t, sessionIds(sessions), session.SessionId)
+
+	idle, err := registry.Idle(ctx, time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	require.Contains(t, sessionIds(idle), session.SessionId)
+
+	// a websocket keeps the session active while its replica sends heartbeats
+	require.NoError(t, registry.SetWs(ctx, session.SessionId, true))
+	require.NoError(t, registry.Heartbeat(ctx, time.Minute))
+	idle, err = registry.Idle(ctx, time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	require.NotContains(t, sessionIds(idle), session.SessionId)
+
+	// an activity counts once it's flushed
+	touched := &Config{Id: shortuuid.New(), ClientId: 1, SessionId: shortuuid.New(), StartedAt: time.Now(), LastActivity: time.Now().Add(-time.Hour)}
+	require.NoError(t, registry.Add(ctx, touched))
+	defer registry.Remove(ctx, touched.SessionId)
+	registry.Touch(touched.SessionId)
+	idle, err = registry.Idle(ctx, time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	require.Contains(t, sessionIds(idle), touched.SessionId)
+	require.NoError(t, registry.Flush(ctx))
+	idle, err = registry.Idle(ctx, time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	require.NotContains(t, sessionIds(idle), touched.SessionId)
+
+	require.NoError(t, registry.Remove(ctx, session.SessionId))
+	_, ok, err = registry.GetById(ctx, session.Id)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func sessionIds(sessions []*Config) []string {
+	ids := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.SessionId)
+	}
+	return ids
+}
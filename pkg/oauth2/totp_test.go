@@ -0,0 +1,71 @@
+package oauth2
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateTotp(t *testing.T) {
+	// RFC 6238 appendix B SHA-1 vectors, truncated to the last 6 of their 8 digits
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for ts, code := range vectors {
+		step, ok := ValidateTotp(secret, code, time.Unix(ts, 0))
+		require.True(t, ok, "time %d", ts)
+		require.Equal(t, ts/TotpPeriod, step)
+	}
+
+	// the previous step is accepted for clock drift, older ones aren't
+	_, ok := ValidateTotp(secret, "287082", time.Unix(59+TotpPeriod, 0))
+	require.True(t, ok)
+	_, ok = ValidateTotp(secret, "287082", time.Unix(59+2*TotpPeriod, 0))
+	require.False(t, ok)
+
+	_, ok = ValidateTotp(secret, "28708", time.Unix(59, 0))
+	require.False(t, ok)
+	_, ok = ValidateTotp("not base32!", "287082", time.Unix(59, 0))
+	require.False(t, ok)
+
+	generated, err := GenerateTotpSecret()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(TotpURI(TotpIssuer, "user@greenlync.com", generated), "otpauth://totp/GreenLync:user@greenlync.com?"))
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes()
+	require.NoError(t, err)
+	require.Len(t, codes, RecoveryCodesCount)
+	require.Equal(t, HashRecoveryCode(codes[0]), hashes[0])
+
+	// users may type the codes in upper case or without the dash
+	require.Equal(t, hashes[0], HashRecoveryCode(strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))))
+}
+
+func TestNewMfaRoles(t *testing.T) {
+	roles, err := NewMfaRoles([]*model.Config{
+		{Key: "mfa.role.Admin", Value: "true"},
+		{Key: "mfa.role.User", Value: "false"},
+		{Key: "ratelimit.ip", Value: "100/1m"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"Admin": true}, roles)
+
+	_, err = NewMfaRoles([]*model.Config{{Key: "mfa.role.Admin", Value: "yes please"}})
+	require.Error(t, err)
+	_, err = NewMfaRoles([]*model.Config{{Key: "mfa.enabled", Value: "true"}})
+	require.Error(t, err)
+}
@@ -0,0 +1,68 @@
+package oauth2
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"greenlync-api-gateway/pkg/cache"
+	"greenlync-api-gateway/pkg/errors"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// characters of the email verification tokens, they are sent as links so they can be long
+var EmailVerificationTokenLength = 32
+
+// NewEmailVerification returns an email verification token of the user valid for ttl, the previous
+// token of the user stops working
+func (o *OAuth2) NewEmailVerification(ctx context.Context, userId int32, ttl time.Duration) (string, error) {
+	return emailVerificationCodes.new(ctx, o.Cache, userId, EmailVerificationTokenLength, int(ttl.Seconds()))
+}
+
+// ConsumeEmailVerification returns the user of the email verification token, a token can't be used twice
+func (o *OAuth2) ConsumeEmailVerification(ctx context.Context, token string) (int32, error) {
+	userId, err := emailVerificationCodes.consume(ctx, o.Cache, token)
+	if err == redis.Nil {
+		return 0, errors.ErrInvalidVerificationToken
+	}
+	return userId, err
+}
+
+// ThrottleEmailVerification reserves the next verification email to the address, when one was sent
+// within the interval it returns how long to wait instead
+func (o *OAuth2) ThrottleEmailVerification(ctx context.Context, email string, interval time.Duration) (time.Duration, error) {
+	return o.throttleEmail(ctx, cache.EmailVerificationThrottleKey(normalizeEmail(email)), interval)
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// throttleEmail reserves the next email of the key, when one was sent within the interval it
+// returns how long to wait instead
+func (o *OAuth2) throttleEmail(ctx context.Context, key string, interval time.Duration) (time.Duration, error) {
+	if interval <= 0 {
+		return 0, nil
+	}
+
+	rdb := o.Cache.GetRedisClient()
+
+	ok, err := rdb.SetNX(ctx, key, time.Now().Unix(), interval).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		return 0, nil
+	}
+
+	wait, err := rdb.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	// expired between the two calls
+	if wait <= 0 {
+		return time.Millisecond, nil
+	}
+	return wait, nil
+}
@@ -0,0 +1,162 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Load balancing strategies picking a healthy upstream for each proxied request
+
+package proxy
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Load balancing strategies
+const (
+	StrategyRoundRobin       = "round_robin"
+	StrategyLeastConnections = "least_connections"
+	StrategyWeighted         = "weighted"
+)
+
+var ErrNoHealthyUpstream = errors.New("no healthy upstream available")
+
+// Upstream is a single upstream service instance, shared by every route
+// pointing to the same url so health and in-flight requests are tracked once
+type Upstream struct {
+	// upstream base url without the trailing /
+	URL string
+	// requests currently forwarded to the upstream
+	active int64
+	// false once the health check ejected the upstream
+	healthy atomic.Bool
+	// consecutive health check results
+	successes int
+	failures  int
+	// circuit of the upstream
+	breaker breaker
+}
+
+func newUpstream(url string) *Upstream {
+	u := &Upstream{URL: strings.TrimSuffix(url, "/")}
+	u.healthy.Store(true)
+	return u
+}
+
+// CircuitState returns the state of the upstream circuit breaker
+func (u *Upstream) CircuitState() CircuitState {
+	return u.breaker.State()
+}
+
+// available reports whether the balancer can pick the upstream
+func (u *Upstream) available(now time.Time) bool {
+	return u.Healthy() && u.breaker.Ready(now)
+}
+
+// Healthy reports whether the upstream can receive requests
+func (u *Upstream) Healthy() bool {
+	return u.healthy.Load()
+}
+
+// Active returns the number of in-flight requests to the upstream
+func (u *Upstream) Active() int64 {
+	return atomic.LoadInt64(&u.active)
+}
+
+func (u *Upstream) acquire() {
+	atomic.AddInt64(&u.active, 1)
+}
+
+func (u *Upstream) release() {
+	atomic.AddInt64(&u.active, -1)
+}
+
+// Target is an upstream as seen by a route, with the route's weight for it
+type Target struct {
+	*Upstream
+	Weight int
+	// smooth weighted round robin state
+	current int
+}
+
+// Targets returns the upstreams the route balances over
+func (r *Route) Targets() []*Target {
+	return r.targets
+}
+
+// NextTarget picks a healthy upstream whose circuit lets calls through with the route strategy
+func (r *Route) NextTarget() (*Target, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var t *Target
+	switch r.Strategy {
+	case StrategyLeastConnections:
+		t = r.leastConnections(now)
+	case StrategyWeighted:
+		t = r.weighted(now)
+	default:
+		t = r.roundRobin(now)
+	}
+
+	if t == nil {
+		return nil, ErrNoHealthyUpstream
+	}
+	return t, nil
+}
+
+// roundRobin returns the next healthy target after the cursor
+func (r *Route) roundRobin(now time.Time) *Target {
+	for i := 0; i < len(r.targets); i++ {
+		t := r.targets[(r.next+i)%len(r.targets)]
+		if t.available(now) {
+			r.next = (r.next + i + 1) % len(r.targets)
+			return t
+		}
+	}
+	return nil
+}
+
+// leastConnections returns the healthy target with the fewest in-flight requests,
+// ties are broken in round robin order so idle upstreams share the load
+func (r *Route) leastConnections(now time.Time) *Target {
+	var best *Target
+	bestIdx := 0
+	for i := 0; i < len(r.targets); i++ {
+		idx := (r.next + i) % len(r.targets)
+		t := r.targets[idx]
+		if !t.available(now) {
+			continue
+		}
+		if best == nil || t.Active() < best.Active() {
+			best = t
+			bestIdx = idx
+		}
+	}
+
+	if best != nil {
+		r.next = (bestIdx + 1) % len(r.targets)
+	}
+	return best
+}
+
+// weighted is the smooth weighted round robin used by nginx, upstreams are picked
+// in proportion to their weight without sending bursts to the heaviest one
+func (r *Route) weighted(now time.Time) *Target {
+	var best *Target
+	total := 0
+	for _, t := range r.targets {
+		if !t.available(now) {
+			continue
+		}
+		t.current += t.Weight
+		total += t.Weight
+		if best == nil || t.current > best.current {
+			best = t
+		}
+	}
+
+	if best != nil {
+		best.current -= total
+	}
+	return best
+}
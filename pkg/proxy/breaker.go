@@ -0,0 +1,241 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Per upstream circuit breaker stopping the gateway from hammering a degraded backend
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("upstream circuit is open")
+
+// Circuit breaker defaults
+const (
+	DefaultBreakerWindow           = 10
+	DefaultBreakerMinRequests      = 20
+	DefaultBreakerErrorRate        = 50
+	DefaultBreakerOpenDuration     = 30
+	DefaultBreakerHalfOpenRequests = 5
+)
+
+type CircuitState int32
+
+const (
+	CircuitState_Closed   CircuitState = 0
+	CircuitState_Open     CircuitState = 1
+	CircuitState_HalfOpen CircuitState = 2
+)
+
+var CircuitState_name = map[CircuitState]string{
+	0: "closed",
+	1: "open",
+	2: "half_open",
+}
+
+func (s CircuitState) String() string {
+	return CircuitState_name[s]
+}
+
+// CircuitBreaker opens the circuit of an upstream when too many of its calls fail or are slow,
+// zero values use the defaults
+type CircuitBreaker struct {
+	// seconds of the window the error rate is computed over
+	Window int `json:"window"`
+	// calls needed in the window before the error rate is considered
+	MinRequests int `json:"min_requests"`
+	// percentage of failed calls opening the circuit
+	ErrorRate int `json:"error_rate"`
+	// calls slower than this many milliseconds count as failures, 0 disables it
+	LatencyThreshold int `json:"latency_threshold"`
+	// seconds the circuit stays open before trial calls are let through
+	OpenDuration int `json:"open_duration"`
+	// trial calls let through while half open, all of them should succeed to close the circuit
+	HalfOpenRequests int `json:"half_open_requests"`
+}
+
+// Validate checks the circuit breaker settings
+func (cb *CircuitBreaker) Validate() error {
+	if cb.Window < 0 || cb.MinRequests < 0 || cb.LatencyThreshold < 0 || cb.OpenDuration < 0 || cb.HalfOpenRequests < 0 {
+		return fmt.Errorf("circuit breaker values can't be negative")
+	}
+
+	if cb.ErrorRate < 0 || cb.ErrorRate > 100 {
+		return fmt.Errorf("circuit breaker error rate should be between 0 and 100")
+	}
+
+	return nil
+}
+
+func (cb *CircuitBreaker) window() time.Duration {
+	if cb.Window == 0 {
+		return DefaultBreakerWindow * time.Second
+	}
+	return time.Duration(cb.Window) * time.Second
+}
+
+func (cb *CircuitBreaker) minRequests() int {
+	if cb.MinRequests == 0 {
+		return DefaultBreakerMinRequests
+	}
+	return cb.MinRequests
+}
+
+func (cb *CircuitBreaker) errorRate() int {
+	if cb.ErrorRate == 0 {
+		return DefaultBreakerErrorRate
+	}
+	return cb.ErrorRate
+}
+
+func (cb *CircuitBreaker) openDuration() time.Duration {
+	if cb.OpenDuration == 0 {
+		return DefaultBreakerOpenDuration * time.Second
+	}
+	return time.Duration(cb.OpenDuration) * time.Second
+}
+
+func (cb *CircuitBreaker) halfOpenRequests() int {
+	if cb.HalfOpenRequests == 0 {
+		return DefaultBreakerHalfOpenRequests
+	}
+	return cb.HalfOpenRequests
+}
+
+// breaker is the circuit state of one upstream
+type breaker struct {
+	sync.Mutex
+	// nil disables the breaker, the circuit stays closed
+	cfg   *CircuitBreaker
+	state CircuitState
+	// closed state counters over the current window
+	windowStart time.Time
+	requests    int
+	failures    int
+	// when the circuit was opened
+	openedAt time.Time
+	// half open trial calls let through and succeeded
+	trials    int
+	successes int
+	// called after every state transition, outside the lock
+	onChange func(from, to CircuitState)
+}
+
+func (b *breaker) setConfig(cfg *CircuitBreaker) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.cfg = cfg
+	if cfg == nil {
+		b.state = CircuitState_Closed
+		b.requests, b.failures = 0, 0
+	}
+}
+
+// State returns the current circuit state
+func (b *breaker) State() CircuitState {
+	b.Lock()
+	defer b.Unlock()
+	return b.state
+}
+
+// Ready reports whether a call would be let through, without reserving it
+func (b *breaker) Ready(now time.Time) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	switch {
+	case b.cfg == nil || b.state == CircuitState_Closed:
+		return true
+	case b.state == CircuitState_Open:
+		return now.Sub(b.openedAt) >= b.cfg.openDuration()
+	default:
+		return b.trials < b.cfg.halfOpenRequests()
+	}
+}
+
+// Allow reserves a call, an open circuit moves to half open once its open duration elapsed
+func (b *breaker) Allow(now time.Time) bool {
+	b.Lock()
+	if b.cfg == nil || b.state == CircuitState_Closed {
+		b.Unlock()
+		return true
+	}
+
+	from := b.state
+	if b.state == CircuitState_Open {
+		if now.Sub(b.openedAt) < b.cfg.openDuration() {
+			b.Unlock()
+			return false
+		}
+		b.state = CircuitState_HalfOpen
+		b.trials, b.successes = 0, 0
+	}
+
+	allowed := b.trials < b.cfg.halfOpenRequests()
+	if allowed {
+		b.trials++
+	}
+	to := b.state
+	b.Unlock()
+
+	b.changed(from, to)
+	return allowed
+}
+
+// Record reports the result of a call let through by Allow
+func (b *breaker) Record(now time.Time, success bool, latency time.Duration) {
+	b.Lock()
+	if b.cfg == nil {
+		b.Unlock()
+		return
+	}
+
+	if b.cfg.LatencyThreshold > 0 && latency > time.Duration(b.cfg.LatencyThreshold)*time.Millisecond {
+		success = false
+	}
+
+	from := b.state
+	switch b.state {
+	case CircuitState_Closed:
+		if now.Sub(b.windowStart) >= b.cfg.window() {
+			b.windowStart = now
+			b.requests, b.failures = 0, 0
+		}
+		b.requests++
+		if !success {
+			b.failures++
+		}
+		if b.requests >= b.cfg.minRequests() && b.failures*100 >= b.cfg.errorRate()*b.requests {
+			b.open(now)
+		}
+	case CircuitState_HalfOpen:
+		if !success {
+			b.open(now)
+			break
+		}
+		b.successes++
+		if b.successes >= b.cfg.halfOpenRequests() {
+			b.state = CircuitState_Closed
+			b.windowStart = now
+			b.requests, b.failures = 0, 0
+		}
+	}
+	to := b.state
+	b.Unlock()
+
+	b.changed(from, to)
+}
+
+func (b *breaker) open(now time.Time) {
+	b.state = CircuitState_Open
+	b.openedAt = now
+}
+
+func (b *breaker) changed(from, to CircuitState) {
+	if from != to && b.onChange != nil {
+		b.onChange(from, to)
+	}
+}
@@ -0,0 +1,220 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Active health checks ejecting unhealthy upstreams from the balancer
+
+package proxy
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"greenlync-api-gateway/pkg/monitor"
+
+	"github.com/valyala/fasthttp"
+)
+
+// how often the monitor looks for upstreams due for a probe
+var HealthCheckTick = time.Second
+
+// Health check defaults
+const (
+	DefaultHealthCheckInterval = 10
+	DefaultHealthCheckTimeout  = 2
+	DefaultHealthyThreshold    = 2
+	DefaultUnhealthyThreshold  = 3
+)
+
+// HealthCheck probes GET upstream+Path, any 2xx or 3xx response counts as a success
+type HealthCheck struct {
+	// path requested on the upstream e.g. /healthz
+	Path string `json:"path"`
+	// seconds between probes
+	Interval int `json:"interval"`
+	// probe timeout in seconds, should be less than the interval
+	Timeout int `json:"timeout"`
+	// consecutive successes needed to bring an ejected upstream back
+	HealthyThreshold int `json:"healthy_threshold"`
+	// consecutive failures needed to eject an upstream
+	UnhealthyThreshold int `json:"unhealthy_threshold"`
+}
+
+// Validate checks the health check settings, zero values use the defaults
+func (h *HealthCheck) Validate() error {
+	if !strings.HasPrefix(h.Path, "/") {
+		return fmt.Errorf("health check path should start with /")
+	}
+
+	if h.Interval < 0 || h.Timeout < 0 || h.HealthyThreshold < 0 || h.UnhealthyThreshold < 0 {
+		return fmt.Errorf("health check values can't be negative")
+	}
+
+	if h.timeout() >= h.interval() {
+		return fmt.Errorf("health check timeout should be less than the interval")
+	}
+
+	return nil
+}
+
+func (h *HealthCheck) interval() time.Duration {
+	if h.Interval == 0 {
+		return DefaultHealthCheckInterval * time.Second
+	}
+	return time.Duration(h.Interval) * time.Second
+}
+
+func (h *HealthCheck) timeout() time.Duration {
+	if h.Timeout == 0 {
+		return DefaultHealthCheckTimeout * time.Second
+	}
+	return time.Duration(h.Timeout) * time.Second
+}
+
+func (h *HealthCheck) healthyThreshold() int {
+	if h.HealthyThreshold == 0 {
+		return DefaultHealthyThreshold
+	}
+	return h.HealthyThreshold
+}
+
+func (h *HealthCheck) unhealthyThreshold() int {
+	if h.UnhealthyThreshold == 0 {
+		return DefaultUnhealthyThreshold
+	}
+	return h.UnhealthyThreshold
+}
+
+// link points the table targets to the shared upstreams, keeping the health
+// and in-flight state of upstreams that were already known before the reload
+func (p *Proxy) link(t *Table) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	upstreams := make(map[string]*Upstream)
+	checks := make(map[string]*HealthCheck)
+	breakers := make(map[string]*CircuitBreaker)
+	for _, r := range t.routes {
+		for _, target := range r.targets {
+			u, ok := upstreams[target.URL]
+			if !ok {
+				u, ok = p.upstreams[target.URL]
+			}
+			if !ok {
+				u = target.Upstream
+				u.breaker.onChange = func(from, to CircuitState) {
+					p.circuitChanged(u, from, to)
+				}
+				monitor.AddService(monitor.UpstreamHealthKey(u.URL), monitor.HealthStatus_unknown)
+			}
+			target.Upstream = u
+			upstreams[u.URL] = u
+
+			// the first route declaring a health check or circuit breaker for the upstream defines it
+			if _, ok := checks[u.URL]; !ok && r.HealthCheck != nil {
+				checks[u.URL] = r.HealthCheck
+			}
+			if _, ok := breakers[u.URL]; !ok && r.CircuitBreaker != nil {
+				breakers[u.URL] = r.CircuitBreaker
+			}
+		}
+	}
+
+	for url, u := range upstreams {
+		u.breaker.setConfig(breakers[url])
+
+		// nothing can bring back an ejected upstream once its health check is removed
+		if _, ok := checks[url]; !ok && !u.Healthy() {
+			u.healthy.Store(true)
+			monitor.UpdateServiceDetail(monitor.UpstreamHealthKey(url), monitor.HealthStatus_unknown, nil, nil)
+		}
+	}
+
+	for url := range p.upstreams {
+		if _, ok := upstreams[url]; !ok {
+			monitor.RemoveService(monitor.UpstreamHealthKey(url))
+			circuitState.DeleteLabelValues(url)
+			delete(p.nextCheck, url)
+		}
+	}
+
+	p.upstreams = upstreams
+	p.checks = checks
+}
+
+// MonitorUpstreams probes the upstreams that have a health check, ejecting the
+// failing ones from the balancer and reporting their state to the monitor
+func (p *Proxy) MonitorUpstreams() {
+	for {
+		time.Sleep(HealthCheckTick)
+		p.checkUpstreams(time.Now())
+	}
+}
+
+// checkUpstreams probes every upstream due for a health check and waits for the results
+func (p *Proxy) checkUpstreams(now time.Time) {
+	type probe struct {
+		upstream *Upstream
+		check    *HealthCheck
+	}
+
+	due := make([]probe, 0)
+	p.mu.Lock()
+	for url, hc := range p.checks {
+		if now.Before(p.nextCheck[url]) {
+			continue
+		}
+		p.nextCheck[url] = now.Add(hc.interval())
+		due = append(due, probe{upstream: p.upstreams[url], check: hc})
+	}
+	p.mu.Unlock()
+
+	wg := sync.WaitGroup{}
+	for i := range due {
+		wg.Add(1)
+		go func(pr probe) {
+			defer wg.Done()
+			p.probe(pr.upstream, pr.check)
+		}(due[i])
+	}
+	wg.Wait()
+}
+
+// probe sends one health check request and updates the upstream state
+func (p *Proxy) probe(u *Upstream, hc *HealthCheck) {
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.SetRequestURI(u.URL + hc.Path)
+	req.Header.SetMethod(fasthttp.MethodGet)
+
+	err := p.client.DoTimeout(req, resp, hc.timeout())
+	if err == nil && (resp.StatusCode() < 200 || resp.StatusCode() >= 400) {
+		err = fmt.Errorf("health check returned status %d", resp.StatusCode())
+	}
+
+	if err != nil {
+		u.successes = 0
+		u.failures++
+		if u.Healthy() && u.failures >= hc.unhealthyThreshold() {
+			u.healthy.Store(false)
+			p.Log.Logger.Warnf("upstream %s ejected after %d failed health checks: %v", u.URL, u.failures, err)
+		}
+	} else {
+		u.failures = 0
+		u.successes++
+		if !u.Healthy() && u.successes >= hc.healthyThreshold() {
+			u.healthy.Store(true)
+			p.Log.Logger.Infof("upstream %s is healthy again", u.URL)
+		}
+	}
+
+	status := monitor.HealthStatus_running
+	if !u.Healthy() {
+		status = monitor.HealthStatus_error
+	}
+	monitor.UpdateServiceDetail(monitor.UpstreamHealthKey(u.URL), status, err, map[string]interface{}{
+		"active_requests": u.Active(),
+	})
+}
@@ -0,0 +1,32 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Prometheus metrics of the upstream circuit breakers and retries,
+// registered in the default registry served on /metrics with the fiberprometheus metrics
+
+package proxy
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	circuitState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gateway_upstream_circuit_state",
+		Help: "Circuit state of the upstream, 0 closed, 1 open, 2 half open",
+	}, []string{"upstream"})
+
+	circuitTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_upstream_circuit_transitions_total",
+		Help: "Circuit state transitions of the upstream",
+	}, []string{"upstream", "from", "to"})
+
+	upstreamRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_upstream_retries_total",
+		Help: "Retried requests of the route",
+	}, []string{"route"})
+
+	retryBudgetExhausted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_upstream_retry_budget_exhausted_total",
+		Help: "Retries of the route skipped because the retry budget was exhausted",
+	}, []string{"route"})
+)
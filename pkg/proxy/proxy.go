@@ -0,0 +1,243 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Reverse proxy forwarding authenticated gateway requests to upstream services
+
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"greenlync-api-gateway/config"
+	"greenlync-api-gateway/pkg/logger"
+	"greenlync-api-gateway/pkg/oauth2"
+
+	"github.com/goccy/go-json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/proxy"
+	"github.com/valyala/fasthttp"
+)
+
+// Trusted headers injected by the gateway, upstreams can rely on them
+// because any client supplied value is removed before forwarding
+const (
+	HeaderUserId    = "X-Gateway-User-Id"
+	HeaderScope     = "X-Gateway-Scope"
+	HeaderSessionId = "X-Gateway-Session-Id"
+	HeaderApiKeyId  = "X-Gateway-Api-Key-Id"
+	HeaderClientId  = "X-Gateway-Client-Id"
+	HeaderActorId   = "X-Gateway-Actor-Id"
+	HeaderRealIP    = "X-Real-IP"
+)
+
+var trustedHeaders = []string{HeaderUserId, HeaderScope, HeaderSessionId, HeaderApiKeyId, HeaderClientId, HeaderActorId}
+
+type Proxy struct {
+	// zab logger for log to files and stdout
+	Log *logger.Logger
+	// default upstream timeout
+	Timeout time.Duration
+	// shared upstream http client
+	client *fasthttp.Client
+	// routes from the declarative routes file, always part of the table
+	static []*Route
+	// live routing table, swapped atomically
+	table atomic.Pointer[Table]
+	// serializes reloads so an older fetch never overwrites a newer one
+	reload sync.Mutex
+	// upstreams of the live table by url with their health checks
+	mu        sync.Mutex
+	upstreams map[string]*Upstream
+	checks    map[string]*HealthCheck
+	nextCheck map[string]time.Time
+	// called when the circuit of an upstream changes state
+	onCircuitChange func(upstream string, from, to CircuitState)
+}
+
+func NewProxy(cfg *config.Config, log *logger.Logger) *Proxy {
+	p := &Proxy{
+		Log:     log,
+		Timeout: time.Duration(cfg.Proxy.Timeout) * time.Second,
+		client: &fasthttp.Client{
+			NoDefaultUserAgentHeader: true,
+			DisablePathNormalizing:   true,
+		},
+		upstreams: make(map[string]*Upstream),
+		checks:    make(map[string]*HealthCheck),
+		nextCheck: make(map[string]time.Time),
+	}
+	p.table.Store(&Table{})
+
+	return p
+}
+
+// LoadFile loads the declarative route table from a json file,
+// a missing file is not an error, the gateway just has no upstreams
+func (p *Proxy) LoadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			p.Log.Logger.Infof("proxy routes file %s not found, no upstream routes loaded", path)
+			return nil
+		}
+		return err
+	}
+
+	routes := []*Route{}
+	err = json.Unmarshal(b, &routes)
+	if err != nil {
+		return fmt.Errorf("couldn't parse proxy routes file %s: %w", path, err)
+	}
+
+	_, err = NewTable(routes)
+	if err != nil {
+		return err
+	}
+	p.static = routes
+
+	return p.Load(nil)
+}
+
+// Validate checks the dynamic routes can be loaded next to the static ones
+// without touching the live routing table
+func (p *Proxy) Validate(routes []*Route) error {
+	_, err := NewTable(append(append([]*Route{}, p.static...), routes...))
+	return err
+}
+
+// Load validates the dynamic routes and replaces the live routing table
+// with them plus the static routes
+func (p *Proxy) Load(routes []*Route) error {
+	all := append(append([]*Route{}, p.static...), routes...)
+	t, err := NewTable(all)
+	if err != nil {
+		return err
+	}
+
+	p.link(t)
+	p.table.Store(t)
+	p.Log.Logger.Infof("proxy routing table loaded with %d routes", len(all))
+
+	return nil
+}
+
+// Reload fetches the dynamic routes and loads them, concurrent reloads run one at a time
+func (p *Proxy) Reload(fetch func() ([]*Route, error)) error {
+	p.reload.Lock()
+	defer p.reload.Unlock()
+
+	routes, err := fetch()
+	if err != nil {
+		return err
+	}
+
+	return p.Load(routes)
+}
+
+// Table returns the live routing table
+func (p *Proxy) Table() *Table {
+	return p.table.Load()
+}
+
+// Match finds the route for the path in the live routing table
+func (p *Proxy) Match(path string) (*Route, bool) {
+	return p.Table().Match(path)
+}
+
+// Forward sends the request to one of the route upstreams and copies the upstream
+// response back to the client, client is the authenticated session if there is one.
+// Idempotent requests are retried on another pick of the balancer when the route has a retry policy
+func (p *Proxy) Forward(c *fiber.Ctx, route *Route, client *oauth2.Config) error {
+	req := c.Request()
+
+	for _, h := range trustedHeaders {
+		req.Header.Del(h)
+	}
+	// the API key is a gateway credential, upstreams only get the key id
+	req.Header.Del(oauth2.ApiKeyHeader)
+	if client != nil {
+		req.Header.Set(HeaderUserId, strconv.FormatInt(int64(client.ClientId), 10))
+		req.Header.Set(HeaderScope, client.Scope)
+		req.Header.Set(HeaderSessionId, client.SessionId)
+		if client.ApiKeyId != 0 {
+			req.Header.Set(HeaderApiKeyId, strconv.FormatInt(int64(client.ApiKeyId), 10))
+		}
+		if client.ClientSecretId != "" {
+			req.Header.Set(HeaderClientId, client.ClientSecretId)
+		}
+		// the admin impersonating the user
+		if client.ImpersonatorId != 0 {
+			req.Header.Set(HeaderActorId, strconv.FormatInt(int64(client.ImpersonatorId), 10))
+		}
+	}
+	req.Header.Set(HeaderRealIP, c.IP())
+
+	path := route.UpstreamPath(c.Path())
+	if q := req.URI().QueryString(); len(q) > 0 {
+		path += "?" + string(q)
+	}
+
+	timeout := p.Timeout
+	if route.Timeout > 0 {
+		timeout = time.Duration(route.Timeout) * time.Second
+	}
+
+	retry := route.Retry != nil && idempotent(c.Method())
+	if retry {
+		route.budget.request(time.Now())
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := p.forward(c, route, path, timeout)
+		if !retry || attempt >= route.Retry.attempts() || !retryable(err, c.Response().StatusCode()) {
+			return err
+		}
+
+		if !route.budget.retry(time.Now(), route.Retry) {
+			retryBudgetExhausted.WithLabelValues(route.Name).Inc()
+			return err
+		}
+		upstreamRetries.WithLabelValues(route.Name).Inc()
+
+		time.Sleep(route.Retry.backoff(attempt))
+	}
+}
+
+// forward sends one attempt of the request to the next upstream of the route
+func (p *Proxy) forward(c *fiber.Ctx, route *Route, path string, timeout time.Duration) error {
+	target, err := route.NextTarget()
+	if err != nil {
+		return err
+	}
+
+	if !target.breaker.Allow(time.Now()) {
+		return ErrCircuitOpen
+	}
+
+	target.acquire()
+	defer target.release()
+
+	start := time.Now()
+	err = proxy.DoTimeout(c, target.URL+path, timeout, p.client)
+	target.breaker.Record(time.Now(), err == nil && c.Response().StatusCode() < fiber.StatusInternalServerError, time.Since(start))
+
+	return err
+}
+
+// SetOnCircuitChange sets the function called when the circuit of an upstream changes state
+func (p *Proxy) SetOnCircuitChange(f func(upstream string, from, to CircuitState)) {
+	p.onCircuitChange = f
+}
+
+func (p *Proxy) circuitChanged(u *Upstream, from, to CircuitState) {
+	circuitState.WithLabelValues(u.URL).Set(float64(to))
+	circuitTransitions.WithLabelValues(u.URL, from.String(), to.String()).Inc()
+	p.Log.Logger.Warnf("upstream %s circuit %s -> %s", u.URL, from, to)
+
+	if p.onCircuitChange != nil {
+		p.onCircuitChange(u.URL, from, to)
+	}
+}
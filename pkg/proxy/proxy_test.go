@@ -0,0 +1,377 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"greenlync-api-gateway/config"
+	"greenlync-api-gateway/pkg/logger"
+	"greenlync-api-gateway/pkg/monitor"
+	"greenlync-api-gateway/pkg/oauth2"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableMatch(t *testing.T) {
+	table, err := NewTable([]*Route{
+		{Name: "orders", Prefix: "/api/v1/orders", Upstreams: []string{"http://orders:8080"}},
+		{Name: "orders-reports", Prefix: "/api/v1/orders/reports", Upstreams: []string{"http://reports:8080"}},
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		path  string
+		route string
+	}{
+		{"/api/v1/orders", "orders"},
+		{"/api/v1/orders/1", "orders"},
+		{"/api/v1/orders/reports/daily", "orders-reports"},
+		{"/api/v1/ordersx", ""},
+		{"/api/v1/users", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			r, ok := table.Match(tc.path)
+			if tc.route == "" {
+				require.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			require.Equal(t, tc.route, r.Name)
+		})
+	}
+}
+
+func TestNewTableValidation(t *testing.T) {
+	testCases := []struct {
+		name   string
+		routes []*Route
+	}{
+		{"NoPrefixSlash", []*Route{{Name: "a", Prefix: "api", Upstreams: []string{"http://a"}}}},
+		{"OutsideProxyPath", []*Route{{Name: "a", Prefix: "/orders", Upstreams: []string{"http://a"}}}},
+		{"ProxyPathOnly", []*Route{{Name: "a", Prefix: "/api/v1/", Upstreams: []string{"http://a"}}}},
+		{"NoUpstreams", []*Route{{Name: "a", Prefix: "/api/v1/a"}}},
+		{"RelativeUpstream", []*Route{{Name: "a", Prefix: "/api/v1/a", Upstreams: []string{"a:8080"}}}},
+		{"BadResource", []*Route{{Name: "a", Prefix: "/api/v1/a", Upstreams: []string{"http://a"}, Resource: "orders"}}},
+		{"DuplicateName", []*Route{
+			{Name: "a", Prefix: "/api/v1/a", Upstreams: []string{"http://a"}},
+			{Name: "a", Prefix: "/api/v1/b", Upstreams: []string{"http://b"}},
+		}},
+		{"DuplicatePrefix", []*Route{
+			{Name: "a", Prefix: "/api/v1/a", Upstreams: []string{"http://a"}},
+			{Name: "b", Prefix: "/api/v1/a/", Upstreams: []string{"http://b"}},
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewTable(tc.routes)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestRouteUpstreamPath(t *testing.T) {
+	r := &Route{Prefix: "/api/v1/orders", StripPrefix: true}
+	require.Equal(t, "/", r.UpstreamPath("/api/v1/orders"))
+	require.Equal(t, "/1/items", r.UpstreamPath("/api/v1/orders/1/items"))
+
+	r.StripPrefix = false
+	require.Equal(t, "/api/v1/orders/1", r.UpstreamPath("/api/v1/orders/1"))
+}
+
+func newTestRoute(t *testing.T, r *Route) *Route {
+	table, err := NewTable([]*Route{r})
+	require.NoError(t, err)
+	return table.Routes()[0]
+}
+
+func nextURL(t *testing.T, r *Route) string {
+	target, err := r.NextTarget()
+	require.NoError(t, err)
+	return target.URL
+}
+
+func TestRouteRoundRobin(t *testing.T) {
+	r := newTestRoute(t, &Route{Name: "a", Prefix: "/api/v1/a", Upstreams: []string{"http://a/", "http://b", "http://c"}})
+	require.Equal(t, "http://a", nextURL(t, r))
+	require.Equal(t, "http://b", nextURL(t, r))
+	require.Equal(t, "http://c", nextURL(t, r))
+	require.Equal(t, "http://a", nextURL(t, r))
+
+	// ejected upstreams are skipped
+	r.Targets()[1].healthy.Store(false)
+	require.Equal(t, "http://c", nextURL(t, r))
+	require.Equal(t, "http://a", nextURL(t, r))
+	require.Equal(t, "http://c", nextURL(t, r))
+
+	for _, target := range r.Targets() {
+		target.healthy.Store(false)
+	}
+	_, err := r.NextTarget()
+	require.ErrorIs(t, err, ErrNoHealthyUpstream)
+}
+
+func TestRouteLeastConnections(t *testing.T) {
+	r := newTestRoute(t, &Route{Name: "a", Prefix: "/api/v1/a", Upstreams: []string{"http://a", "http://b"}, Strategy: StrategyLeastConnections})
+
+	r.Targets()[0].acquire()
+	require.Equal(t, "http://b", nextURL(t, r))
+	require.Equal(t, "http://b", nextURL(t, r))
+
+	r.Targets()[0].release()
+	r.Targets()[1].acquire()
+	require.Equal(t, "http://a", nextURL(t, r))
+}
+
+func TestRouteWeighted(t *testing.T) {
+	r := newTestRoute(t, &Route{Name: "a", Prefix: "/api/v1/a", Upstreams: []string{"http://a", "http://b"}, Strategy: StrategyWeighted, Weights: []int{3, 1}})
+
+	counts := make(map[string]int)
+	for i := 0; i < 8; i++ {
+		counts[nextURL(t, r)]++
+	}
+	require.Equal(t, 6, counts["http://a"])
+	require.Equal(t, 2, counts["http://b"])
+}
+
+func TestHealthCheckEjectsUpstream(t *testing.T) {
+	healthy := true
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer upstream.Close()
+
+	log, err := logger.NewLogger(&config.Config{})
+	require.NoError(t, err)
+
+	p := NewProxy(&config.Config{}, log)
+	err = p.Load([]*Route{{
+		Name:        "orders",
+		Prefix:      "/api/v1/orders",
+		Upstreams:   []string{upstream.URL},
+		HealthCheck: &HealthCheck{Path: "/healthz", Interval: 1, Timeout: 0, UnhealthyThreshold: 2, HealthyThreshold: 1},
+	}})
+	require.Error(t, err, "timeout should be less than the interval")
+
+	err = p.Load([]*Route{{
+		Name:        "orders",
+		Prefix:      "/api/v1/orders",
+		Upstreams:   []string{upstream.URL},
+		HealthCheck: &HealthCheck{Path: "/healthz", Interval: 2, Timeout: 1, UnhealthyThreshold: 2, HealthyThreshold: 1},
+	}})
+	require.NoError(t, err)
+
+	target := p.Table().Routes()[0].Targets()[0]
+	key := monitor.UpstreamHealthKey(upstream.URL)
+	now := time.Now()
+
+	healthy = false
+	p.checkUpstreams(now)
+	require.True(t, target.Healthy())
+	p.checkUpstreams(now.Add(2 * time.Second))
+	require.False(t, target.Healthy())
+	status, ok := monitor.GetServiceStatus(key)
+	require.True(t, ok)
+	require.Equal(t, monitor.HealthStatus_error, status)
+
+	// the health state survives a reload of the table
+	err = p.Load([]*Route{{
+		Name:        "orders",
+		Prefix:      "/api/v1/orders",
+		Upstreams:   []string{upstream.URL},
+		HealthCheck: &HealthCheck{Path: "/healthz", Interval: 2, Timeout: 1, UnhealthyThreshold: 2, HealthyThreshold: 1},
+	}})
+	require.NoError(t, err)
+	target = p.Table().Routes()[0].Targets()[0]
+	require.False(t, target.Healthy())
+
+	healthy = true
+	p.checkUpstreams(now.Add(4 * time.Second))
+	require.True(t, target.Healthy())
+	status, _ = monitor.GetServiceStatus(key)
+	require.Equal(t, monitor.HealthStatus_running, status)
+
+	// removed upstreams are no longer monitored
+	err = p.Load(nil)
+	require.NoError(t, err)
+	_, ok = monitor.GetServiceStatus(key)
+	require.False(t, ok)
+}
+
+func TestForward(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream-Path", r.URL.RequestURI())
+		w.Header().Set("X-Upstream-User", r.Header.Get(HeaderUserId))
+		w.Header().Set("X-Upstream-Scope", r.Header.Get(HeaderScope))
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("upstream"))
+	}))
+	defer upstream.Close()
+
+	log, err := logger.NewLogger(&config.Config{})
+	require.NoError(t, err)
+
+	p := NewProxy(&config.Config{Proxy: config.Proxy{Timeout: 5}}, log)
+	err = p.Load([]*Route{
+		{Name: "orders", Prefix: "/api/v1/orders", Upstreams: []string{upstream.URL}, StripPrefix: true},
+	})
+	require.NoError(t, err)
+
+	app := fiber.New()
+	app.All("/*", func(c *fiber.Ctx) error {
+		route, ok := p.Match(c.Path())
+		require.True(t, ok)
+		return p.Forward(c, route, &oauth2.Config{ClientId: 7, Scope: "admin", SessionId: "s1"})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/orders/1?expand=items", nil)
+	// spoofed identity headers never reach the upstream
+	req.Header.Set(HeaderUserId, "1")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+
+	require.Equal(t, http.StatusTeapot, resp.StatusCode)
+	require.Equal(t, "/1?expand=items", resp.Header.Get("X-Upstream-Path"))
+	require.Equal(t, "7", resp.Header.Get("X-Upstream-User"))
+	require.Equal(t, "admin", resp.Header.Get("X-Upstream-Scope"))
+
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "upstream", string(b))
+}
+
+func TestReloadKeepsStaticRoutes(t *testing.T) {
+	log, err := logger.NewLogger(&config.Config{})
+	require.NoError(t, err)
+
+	p := NewProxy(&config.Config{}, log)
+	p.static = []*Route{{Name: "orders", Prefix: "/api/v1/orders", Upstreams: []string{"http://orders"}}}
+
+	// dynamic routes can't shadow the static ones
+	err = p.Validate([]*Route{{Name: "orders2", Prefix: "/api/v1/orders", Upstreams: []string{"http://b"}}})
+	require.Error(t, err)
+
+	err = p.Reload(func() ([]*Route, error) {
+		return []*Route{{Name: "catalog", Prefix: "/api/v1/catalog", Upstreams: []string{"http://catalog"}}}, nil
+	})
+	require.NoError(t, err)
+	require.Len(t, p.Table().Routes(), 2)
+
+	_, ok := p.Match("/api/v1/catalog/1")
+	require.True(t, ok)
+
+	// a failed reload keeps the live table
+	err = p.Reload(func() ([]*Route, error) {
+		return []*Route{{Name: "bad", Prefix: "bad"}}, nil
+	})
+	require.Error(t, err)
+	require.Len(t, p.Table().Routes(), 2)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	transitions := make([]CircuitState, 0)
+	b := &breaker{onChange: func(from, to CircuitState) {
+		transitions = append(transitions, to)
+	}}
+	b.setConfig(&CircuitBreaker{MinRequests: 4, ErrorRate: 50, OpenDuration: 10, HalfOpenRequests: 2, LatencyThreshold: 100})
+
+	now := time.Now()
+	require.True(t, b.Allow(now))
+	b.Record(now, true, time.Millisecond)
+	b.Record(now, true, time.Millisecond)
+	b.Record(now, false, time.Millisecond)
+	require.Equal(t, CircuitState_Closed, b.State())
+
+	// slow calls count as failures
+	b.Record(now, true, time.Second)
+	require.Equal(t, CircuitState_Open, b.State())
+	require.False(t, b.Ready(now))
+	require.False(t, b.Allow(now.Add(time.Second)))
+
+	// after the open duration a limited number of trial calls go through
+	later := now.Add(10 * time.Second)
+	require.True(t, b.Ready(later))
+	require.True(t, b.Allow(later))
+	require.Equal(t, CircuitState_HalfOpen, b.State())
+	require.True(t, b.Allow(later))
+	require.False(t, b.Allow(later))
+
+	b.Record(later, true, time.Millisecond)
+	b.Record(later, true, time.Millisecond)
+	require.Equal(t, CircuitState_Closed, b.State())
+
+	require.Equal(t, []CircuitState{CircuitState_Open, CircuitState_HalfOpen, CircuitState_Closed}, transitions)
+}
+
+func TestRetryBudget(t *testing.T) {
+	rp := &RetryPolicy{Budget: 10, MinRetries: 1}
+	b := &retryBudget{}
+	now := time.Now()
+
+	for i := 0; i < 20; i++ {
+		b.request(now)
+	}
+	require.True(t, b.retry(now, rp))
+	require.True(t, b.retry(now, rp))
+	require.False(t, b.retry(now, rp))
+
+	// a new window resets the budget
+	require.True(t, b.retry(now.Add(RetryBudgetWindow), rp))
+}
+
+func TestRetryBackoff(t *testing.T) {
+	rp := &RetryPolicy{BaseDelay: 10, MaxDelay: 40}
+	for retry := 0; retry < 5; retry++ {
+		d := rp.backoff(retry)
+		require.GreaterOrEqual(t, d, time.Duration(0))
+		require.LessOrEqual(t, d, 40*time.Millisecond)
+	}
+}
+
+func TestForwardRetriesIdempotentRequests(t *testing.T) {
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	log, err := logger.NewLogger(&config.Config{})
+	require.NoError(t, err)
+
+	p := NewProxy(&config.Config{Proxy: config.Proxy{Timeout: 5}}, log)
+	err = p.Load([]*Route{
+		{Name: "orders", Prefix: "/api/v1/orders", Upstreams: []string{upstream.URL}, Retry: &RetryPolicy{Attempts: 1, BaseDelay: 1, MaxDelay: 1}},
+	})
+	require.NoError(t, err)
+
+	app := fiber.New()
+	app.All("/*", func(c *fiber.Ctx) error {
+		route, _ := p.Match(c.Path())
+		return p.Forward(c, route, nil)
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/v1/orders", nil))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, 2, calls)
+
+	// non idempotent requests are sent once
+	calls = 0
+	resp, err = app.Test(httptest.NewRequest(http.MethodPost, "/api/v1/orders", nil))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.Equal(t, 1, calls)
+}
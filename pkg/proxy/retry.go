@@ -0,0 +1,151 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Bounded retries with jittered backoff and a retry budget for idempotent upstream calls
+
+package proxy
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Retry defaults
+const (
+	DefaultRetryAttempts   = 2
+	DefaultRetryBaseDelay  = 25
+	DefaultRetryMaxDelay   = 500
+	DefaultRetryBudget     = 20
+	DefaultRetryMinRetries = 3
+	// window the retry budget is computed over
+	RetryBudgetWindow = 10 * time.Second
+)
+
+// RetryPolicy retries idempotent requests failing with a transport error or a 502, 503 or 504,
+// zero values use the defaults
+type RetryPolicy struct {
+	// retries after the first attempt
+	Attempts int `json:"attempts"`
+	// base backoff in milliseconds, doubled on every retry
+	BaseDelay int `json:"base_delay"`
+	// maximum backoff in milliseconds
+	MaxDelay int `json:"max_delay"`
+	// percentage of the route requests that can be retries, so retries can't pile up on a degraded upstream
+	Budget int `json:"budget"`
+	// retries allowed in every budget window regardless of the percentage
+	MinRetries int `json:"min_retries"`
+}
+
+// Validate checks the retry settings
+func (rp *RetryPolicy) Validate() error {
+	if rp.Attempts < 0 || rp.BaseDelay < 0 || rp.MaxDelay < 0 || rp.MinRetries < 0 {
+		return fmt.Errorf("retry values can't be negative")
+	}
+
+	if rp.Budget < 0 || rp.Budget > 100 {
+		return fmt.Errorf("retry budget should be between 0 and 100")
+	}
+
+	return nil
+}
+
+func (rp *RetryPolicy) attempts() int {
+	if rp.Attempts == 0 {
+		return DefaultRetryAttempts
+	}
+	return rp.Attempts
+}
+
+func (rp *RetryPolicy) budget() int {
+	if rp.Budget == 0 {
+		return DefaultRetryBudget
+	}
+	return rp.Budget
+}
+
+func (rp *RetryPolicy) minRetries() int {
+	if rp.MinRetries == 0 {
+		return DefaultRetryMinRetries
+	}
+	return rp.MinRetries
+}
+
+// backoff returns a random delay up to the exponential backoff of the retry (full jitter)
+func (rp *RetryPolicy) backoff(retry int) time.Duration {
+	base := rp.BaseDelay
+	if base == 0 {
+		base = DefaultRetryBaseDelay
+	}
+	max := rp.MaxDelay
+	if max == 0 {
+		max = DefaultRetryMaxDelay
+	}
+
+	delay := max
+	if retry < 16 && base<<retry < max {
+		delay = base << retry
+	}
+
+	return time.Duration(rand.Intn(delay+1)) * time.Millisecond
+}
+
+// idempotent methods can be sent again without side effects on the upstream
+func idempotent(method string) bool {
+	switch method {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions, fiber.MethodPut, fiber.MethodDelete, fiber.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// retryable reports whether the attempt failed in a way another attempt could fix
+func retryable(err error, status int) bool {
+	if err != nil {
+		return err != ErrNoHealthyUpstream
+	}
+	return status == fiber.StatusBadGateway || status == fiber.StatusServiceUnavailable || status == fiber.StatusGatewayTimeout
+}
+
+// retryBudget counts the route requests and retries over a fixed window
+type retryBudget struct {
+	sync.Mutex
+	windowStart time.Time
+	requests    int
+	retries     int
+}
+
+func (b *retryBudget) reset(now time.Time) {
+	if now.Sub(b.windowStart) >= RetryBudgetWindow {
+		b.windowStart = now
+		b.requests, b.retries = 0, 0
+	}
+}
+
+// request counts a new request to the route
+func (b *retryBudget) request(now time.Time) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.reset(now)
+	b.requests++
+}
+
+// retry reserves a retry if the budget allows it
+func (b *retryBudget) retry(now time.Time, rp *RetryPolicy) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	b.reset(now)
+	allowed := b.requests * rp.budget() / 100
+	if allowed < rp.minRetries() {
+		allowed = rp.minRetries()
+	}
+	if b.retries >= allowed {
+		return false
+	}
+
+	b.retries++
+	return true
+}
@@ -0,0 +1,226 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Declarative route table for the gateway reverse proxy
+
+package proxy
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PathPrefix is where the gateway hands the requests it doesn't serve itself to the proxy, a route
+// prefix outside of it is never reached
+const PathPrefix = "/api/v1/"
+
+// Route maps a path prefix on the gateway to one or more upstream services
+type Route struct {
+	// unique name of the route, used in logs
+	Name string `json:"name"`
+	// path prefix the gateway accepts e.g. /api/v1/orders
+	Prefix string `json:"prefix"`
+	// upstream base urls e.g. http://orders:8080
+	Upstreams []string `json:"upstreams"`
+	// remove the prefix from the path before forwarding
+	StripPrefix bool `json:"strip_prefix"`
+	// upstream timeout in seconds, 0 uses the proxy default
+	Timeout int `json:"timeout"`
+	// casbin resource (resource_action) required to access the route,
+	// empty means any authenticated client can access it
+	Resource string `json:"resource"`
+	// load balancing strategy over Upstreams, round_robin by default
+	Strategy string `json:"strategy"`
+	// weight of each upstream in the same order as Upstreams, used by the weighted strategy
+	Weights []int `json:"weights"`
+	// active health check probing the upstreams, nil disables it
+	HealthCheck *HealthCheck `json:"health_check"`
+	// circuit breaker of the upstreams, nil disables it
+	CircuitBreaker *CircuitBreaker `json:"circuit_breaker"`
+	// retries of idempotent requests, nil disables them
+	Retry *RetryPolicy `json:"retry"`
+
+	// upstreams the balancer picks from
+	targets []*Target
+	// retries sent to the route in the current window
+	budget retryBudget
+	// round robin cursor and weighted state
+	mu   sync.Mutex
+	next int
+}
+
+// Validate checks the route is usable before it's added to a table
+func (r *Route) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("route name is required")
+	}
+
+	if !strings.HasPrefix(r.Prefix, PathPrefix) || len(strings.Trim(r.Prefix, "/")) <= len(strings.Trim(PathPrefix, "/")) {
+		return fmt.Errorf("route %s: prefix should be under %s", r.Name, PathPrefix)
+	}
+
+	if len(r.Upstreams) == 0 {
+		return fmt.Errorf("route %s: at least one upstream is required", r.Name)
+	}
+
+	for _, upstream := range r.Upstreams {
+		u, err := url.Parse(upstream)
+		if err != nil {
+			return fmt.Errorf("route %s: %w", r.Name, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("route %s: upstream %s should be an absolute http(s) url", r.Name, upstream)
+		}
+	}
+
+	if r.Timeout < 0 {
+		return fmt.Errorf("route %s: timeout can't be negative", r.Name)
+	}
+
+	switch r.Strategy {
+	case "", StrategyRoundRobin, StrategyLeastConnections, StrategyWeighted:
+	default:
+		return fmt.Errorf("route %s: unknown strategy %s", r.Name, r.Strategy)
+	}
+
+	if len(r.Weights) > 0 && len(r.Weights) != len(r.Upstreams) {
+		return fmt.Errorf("route %s: weights should have one entry per upstream", r.Name)
+	}
+	for _, w := range r.Weights {
+		if w <= 0 {
+			return fmt.Errorf("route %s: weights should be positive", r.Name)
+		}
+	}
+
+	if r.HealthCheck != nil {
+		if err := r.HealthCheck.Validate(); err != nil {
+			return fmt.Errorf("route %s: %w", r.Name, err)
+		}
+	}
+
+	if r.CircuitBreaker != nil {
+		if err := r.CircuitBreaker.Validate(); err != nil {
+			return fmt.Errorf("route %s: %w", r.Name, err)
+		}
+	}
+
+	if r.Retry != nil {
+		if err := r.Retry.Validate(); err != nil {
+			return fmt.Errorf("route %s: %w", r.Name, err)
+		}
+	}
+
+	// the authorization middleware expects resource_action
+	if r.Resource != "" && len(strings.Split(r.Resource, "_")) != 2 {
+		return fmt.Errorf("route %s: resource should be in the form resource_action", r.Name)
+	}
+
+	return nil
+}
+
+// Matches reports whether the path belongs to the route prefix,
+// /api/v1/orders matches /api/v1/orders and /api/v1/orders/1 but not /api/v1/ordersx
+func (r *Route) Matches(path string) bool {
+	prefix := strings.TrimSuffix(r.Prefix, "/")
+	if prefix == "" {
+		return true
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// UpstreamPath returns the path that should be requested on the upstream
+func (r *Route) UpstreamPath(path string) string {
+	if !r.StripPrefix {
+		return path
+	}
+
+	path = strings.TrimPrefix(path, strings.TrimSuffix(r.Prefix, "/"))
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// clone copies the route definition and creates its balancer targets
+func (r *Route) clone() *Route {
+	c := &Route{
+		Name:        r.Name,
+		Prefix:      r.Prefix,
+		Upstreams:   r.Upstreams,
+		StripPrefix: r.StripPrefix,
+		Timeout:     r.Timeout,
+		Resource:    r.Resource,
+		Strategy:    r.Strategy,
+		Weights:     r.Weights,
+		HealthCheck: r.HealthCheck,
+
+		CircuitBreaker: r.CircuitBreaker,
+		Retry:          r.Retry,
+	}
+
+	c.targets = make([]*Target, len(r.Upstreams))
+	for i, upstream := range r.Upstreams {
+		weight := 1
+		if len(r.Weights) > 0 {
+			weight = r.Weights[i]
+		}
+		c.targets[i] = &Target{Upstream: newUpstream(upstream), Weight: weight}
+	}
+
+	return c
+}
+
+// Table is an immutable set of routes ordered by the longest prefix first,
+// it's replaced as a whole whenever the routes change
+type Table struct {
+	routes []*Route
+}
+
+// NewTable validates the routes and builds a new table
+func NewTable(routes []*Route) (*Table, error) {
+	names := make(map[string]struct{})
+	prefixes := make(map[string]struct{})
+	for _, r := range routes {
+		if err := r.Validate(); err != nil {
+			return nil, err
+		}
+
+		if _, ok := names[r.Name]; ok {
+			return nil, fmt.Errorf("duplicate route name %s", r.Name)
+		}
+		names[r.Name] = struct{}{}
+
+		prefix := strings.TrimSuffix(r.Prefix, "/")
+		if _, ok := prefixes[prefix]; ok {
+			return nil, fmt.Errorf("duplicate route prefix %s", r.Prefix)
+		}
+		prefixes[prefix] = struct{}{}
+	}
+
+	// the table owns its routes, so balancer state is never shared between tables
+	sorted := make([]*Route, len(routes))
+	for i, r := range routes {
+		sorted[i] = r.clone()
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(strings.TrimSuffix(sorted[i].Prefix, "/")) > len(strings.TrimSuffix(sorted[j].Prefix, "/"))
+	})
+
+	return &Table{routes: sorted}, nil
+}
+
+// Match returns the most specific route for the path
+func (t *Table) Match(path string) (*Route, bool) {
+	for _, r := range t.routes {
+		if r.Matches(path) {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// Routes returns the routes in the table
+func (t *Table) Routes() []*Route {
+	return t.routes
+}
@@ -0,0 +1,107 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Rate limits loaded from the config store
+
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	model "greenlync-api-gateway/model/common/v1"
+)
+
+// Config store keys, every limit is written as rate/period[/burst] e.g. 100/1m,
+// an empty value disables the limit
+const (
+	ConfigPrefix = "ratelimit."
+	// true to enforce the limits
+	ConfigEnabled = "ratelimit.enabled"
+	// limit per client ip
+	ConfigIP = "ratelimit.ip"
+	// default limit per authenticated user
+	ConfigUser = "ratelimit.user"
+	// ratelimit.role.<role> limit per user of the role, overrides ratelimit.user
+	ConfigRolePrefix = "ratelimit.role."
+	// ratelimit.user.<user id> limit of one user, overrides the role limit
+	ConfigUserPrefix = "ratelimit.user."
+	// ratelimit.route.<route name> limit per user (or ip when anonymous) on the route
+	ConfigRoutePrefix = "ratelimit.route."
+)
+
+type Limits struct {
+	Enabled bool
+	IP      *Limit
+	User    *Limit
+	Roles   map[string]*Limit
+	Users   map[int32]*Limit
+	Routes  map[string]*Limit
+}
+
+// NewLimits builds the limits from the ratelimit.* configs, invalid configs are
+// skipped and returned as an error next to the valid limits
+func NewLimits(configs []*model.Config) (*Limits, error) {
+	l := &Limits{
+		Roles:  make(map[string]*Limit),
+		Users:  make(map[int32]*Limit),
+		Routes: make(map[string]*Limit),
+	}
+
+	errs := make([]error, 0)
+	for _, cfg := range configs {
+		if cfg.Key == ConfigEnabled {
+			l.Enabled, _ = strconv.ParseBool(cfg.Value)
+			continue
+		}
+
+		if !strings.HasPrefix(cfg.Key, ConfigPrefix) || strings.TrimSpace(cfg.Value) == "" {
+			continue
+		}
+
+		limit, err := ParseLimit(cfg.Value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", cfg.Key, err))
+			continue
+		}
+
+		switch {
+		case cfg.Key == ConfigIP:
+			l.IP = limit
+		case cfg.Key == ConfigUser:
+			l.User = limit
+		case strings.HasPrefix(cfg.Key, ConfigRolePrefix):
+			l.Roles[strings.TrimPrefix(cfg.Key, ConfigRolePrefix)] = limit
+		case strings.HasPrefix(cfg.Key, ConfigUserPrefix):
+			id, err := strconv.Atoi(strings.TrimPrefix(cfg.Key, ConfigUserPrefix))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid user id", cfg.Key))
+				continue
+			}
+			l.Users[int32(id)] = limit
+		case strings.HasPrefix(cfg.Key, ConfigRoutePrefix):
+			l.Routes[strings.TrimPrefix(cfg.Key, ConfigRoutePrefix)] = limit
+		default:
+			errs = append(errs, fmt.Errorf("%s: unknown rate limit key", cfg.Key))
+		}
+	}
+
+	return l, errors.Join(errs...)
+}
+
+// ForUser returns the limit of the user, the user override wins over the role limit
+// which wins over the default user limit
+func (l *Limits) ForUser(userId int32, role string) *Limit {
+	if limit, ok := l.Users[userId]; ok {
+		return limit
+	}
+	if limit, ok := l.Roles[role]; ok {
+		return limit
+	}
+	return l.User
+}
+
+// ForRoute returns the limit of the route, nil if it's not limited
+func (l *Limits) ForRoute(route string) *Limit {
+	return l.Routes[route]
+}
@@ -0,0 +1,152 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Distributed GCRA rate limiter on Redis, shared by every gateway replica
+
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var LimitKey = func(dimension, id string) string { return fmt.Sprint("ratelimit_", dimension, "_", id) }
+
+// Limit allows Rate requests per Period, with bursts up to Burst requests
+type Limit struct {
+	Rate   int
+	Period time.Duration
+	Burst  int
+}
+
+// ParseLimit parses rate/period[/burst] e.g. 100/1m or 10/1s/20,
+// the burst defaults to the rate
+func ParseLimit(s string) (*Limit, error) {
+	parts := strings.Split(strings.TrimSpace(s), "/")
+	if len(parts) != 2 && len(parts) != 3 {
+		return nil, fmt.Errorf("rate limit %q should be in the form rate/period[/burst]", s)
+	}
+
+	rate, err := strconv.Atoi(parts[0])
+	if err != nil || rate <= 0 {
+		return nil, fmt.Errorf("rate limit %q: rate should be a positive integer", s)
+	}
+
+	period, err := time.ParseDuration(parts[1])
+	if err != nil || period <= 0 {
+		return nil, fmt.Errorf("rate limit %q: period should be a positive duration", s)
+	}
+
+	burst := rate
+	if len(parts) == 3 {
+		burst, err = strconv.Atoi(parts[2])
+		if err != nil || burst <= 0 {
+			return nil, fmt.Errorf("rate limit %q: burst should be a positive integer", s)
+		}
+	}
+
+	return &Limit{Rate: rate, Period: period, Burst: burst}, nil
+}
+
+func (l *Limit) String() string {
+	return fmt.Sprintf("%d/%s/%d", l.Rate, l.Period, l.Burst)
+}
+
+// Result of a rate limit check
+type Result struct {
+	Limit *Limit
+	// request allowed or not
+	Allowed bool
+	// requests that can still be sent right now
+	Remaining int
+	// time until the request would be allowed, 0 when allowed
+	RetryAfter time.Duration
+	// time until the limit is fully reset
+	ResetAfter time.Duration
+}
+
+// GCRA in one script so concurrent replicas see a consistent state,
+// redis TIME is used so the replicas clocks don't matter
+var gcra = redis.NewScript(`
+redis.replicate_commands()
+
+local key = KEYS[1]
+local burst = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local period = tonumber(ARGV[3])
+
+local emission_interval = period / rate
+local burst_offset = emission_interval * burst
+
+local now = redis.call("TIME")
+now = (now[1] - 1483228800) + (now[2] / 1000000)
+
+local tat = redis.call("GET", key)
+if not tat then
+  tat = now
+else
+  tat = tonumber(tat)
+end
+tat = math.max(tat, now)
+
+local new_tat = tat + emission_interval
+local diff = now - (new_tat - burst_offset)
+local remaining = diff / emission_interval
+
+if remaining < 0 then
+  return {0, 0, tostring(-diff), tostring(tat - now)}
+end
+
+local reset_after = new_tat - now
+if reset_after > 0 then
+  redis.call("SET", key, new_tat, "EX", math.ceil(reset_after))
+end
+
+return {1, remaining, "0", tostring(reset_after)}
+`)
+
+type Limiter struct {
+	redis *redis.Client
+}
+
+func NewLimiter(redis *redis.Client) *Limiter {
+	return &Limiter{redis: redis}
+}
+
+// Allow consumes one request of the limit for the key
+func (l *Limiter) Allow(ctx context.Context, key string, limit *Limit) (*Result, error) {
+	v, err := gcra.Run(ctx, l.redis, []string{key}, limit.Burst, limit.Rate, limit.Period.Seconds()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	values, ok := v.([]interface{})
+	if !ok || len(values) != 4 {
+		return nil, fmt.Errorf("unexpected rate limit script result %v", v)
+	}
+
+	retryAfter, err := strconv.ParseFloat(values[2].(string), 64)
+	if err != nil {
+		return nil, err
+	}
+	resetAfter, err := strconv.ParseFloat(values[3].(string), 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{
+		Limit:      limit,
+		Allowed:    values[0].(int64) == 1,
+		Remaining:  int(values[1].(int64)),
+		RetryAfter: seconds(retryAfter),
+		ResetAfter: seconds(resetAfter),
+	}, nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
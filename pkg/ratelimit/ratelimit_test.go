@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"greenlync-api-gateway/config"
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/redis"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	l, err := ParseLimit("100/1m")
+	require.NoError(t, err)
+	require.Equal(t, &Limit{Rate: 100, Period: time.Minute, Burst: 100}, l)
+
+	l, err = ParseLimit("10/1s/20")
+	require.NoError(t, err)
+	require.Equal(t, &Limit{Rate: 10, Period: time.Second, Burst: 20}, l)
+
+	for _, s := range []string{"", "100", "0/1m", "10/abc", "10/1m/-1", "10/1m/1/1"} {
+		_, err = ParseLimit(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestNewLimits(t *testing.T) {
+	limits, err := NewLimits([]*model.Config{
+		{Key: ConfigEnabled, Value: "true"},
+		{Key: ConfigIP, Value: "300/1m"},
+		{Key: ConfigUser, Value: "600/1m"},
+		{Key: ConfigRolePrefix + "Admin", Value: "1200/1m"},
+		{Key: ConfigUserPrefix + "7", Value: "10/1m"},
+		{Key: ConfigRoutePrefix + "orders", Value: "5/1s"},
+		{Key: ConfigRoutePrefix + "catalog", Value: ""},
+		{Key: ConfigUserPrefix + "abc", Value: "10/1m"},
+	})
+	require.Error(t, err)
+	require.True(t, limits.Enabled)
+	require.Equal(t, 300, limits.IP.Rate)
+
+	require.Equal(t, 10, limits.ForUser(7, "Admin").Rate)
+	require.Equal(t, 1200, limits.ForUser(8, "Admin").Rate)
+	require.Equal(t, 600, limits.ForUser(8, "User").Rate)
+
+	require.Equal(t, 5, limits.ForRoute("orders").Rate)
+	require.Nil(t, limits.ForRoute("catalog"))
+}
+
+func TestLimiterAllow(t *testing.T) {
+	redis, err := redis.NewRedisClient(&config.Config{
+		Redis: config.Redis{
+			RedisAddr: "0.0.0.0:6379",
+		},
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	key := LimitKey("test", time.Now().String())
+	defer redis.Del(ctx, key)
+
+	limiter := NewLimiter(redis)
+	limit := &Limit{Rate: 2, Period: time.Minute, Burst: 2}
+
+	res, err := limiter.Allow(ctx, key, limit)
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+	require.Equal(t, 1, res.Remaining)
+
+	res, err = limiter.Allow(ctx, key, limit)
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+	require.Equal(t, 0, res.Remaining)
+
+	res, err = limiter.Allow(ctx, key, limit)
+	require.NoError(t, err)
+	require.False(t, res.Allowed)
+	require.Greater(t, res.RetryAfter, time.Duration(0))
+}
@@ -2,6 +2,7 @@ package smtp
 
 import (
 	"fmt"
+	"html"
 	"time"
 	model "greenlync-api-gateway/model/common/v1"
 )
@@ -101,3 +102,131 @@ func (s *SMTP) SendVerifyChangePasswordEmail(user *model.User, to string, accoun
 
 	return nil
 }
+
+func (s *SMTP) SendVerifyEmail(user *model.User, to, accountName, verifyURL string, expiryDate time.Duration) error {
+	companyName := user.CompanyName
+	if companyName == "" {
+		companyName = "GreenLync"
+	}
+
+	htmlContent := fmt.Sprintf(`
+		<html>
+		<body>
+			<h2>%s - Verify your email</h2>
+			<p>Hello %s,</p>
+			<p>Thank you for signing up, please verify your email to activate your account.</p>
+			<p><a href="%s">Verify Email</a></p>
+			<p>This link will expire in %d hours.</p>
+			<p>If you did not sign up, please ignore this email.</p>
+			<br>
+			<p>Best regards,<br>%s Team</p>
+		</body>
+		</html>
+		`, companyName, html.EscapeString(accountName), html.EscapeString(verifyURL), int(expiryDate.Hours()), companyName)
+
+	subject := fmt.Sprintf("%s, Verify your email", companyName)
+	err := s.QueueEmail(to, subject, htmlContent)
+	if err != nil {
+		s.Log.Logger.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *SMTP) SendAccountExistsEmail(user *model.User, to, accountName string) error {
+	companyName := user.CompanyName
+	if companyName == "" {
+		companyName = "GreenLync"
+	}
+
+	htmlContent := fmt.Sprintf(`
+		<html>
+		<body>
+			<h2>%s - You already have an account</h2>
+			<p>Hello %s,</p>
+			<p>Someone tried to sign up with this email, but it already belongs to your account.</p>
+			<p>If it was you, sign in with your account or reset your password if you forgot it.</p>
+			<p>If it wasn't you, you can ignore this email, your account hasn't changed.</p>
+			<br>
+			<p>Best regards,<br>%s Team</p>
+		</body>
+		</html>
+		`, companyName, html.EscapeString(accountName), companyName)
+
+	subject := fmt.Sprintf("%s, You already have an account", companyName)
+	err := s.QueueEmail(to, subject, htmlContent)
+	if err != nil {
+		s.Log.Logger.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *SMTP) SendNewSignInEmail(user *model.User, to, accountName, browser, os, ipAddress string, signedInAt time.Time) error {
+	companyName := user.CompanyName
+	if companyName == "" {
+		companyName = "GreenLync"
+	}
+
+	htmlContent := fmt.Sprintf(`
+		<html>
+		<body>
+			<h2>%s - New sign-in to your account</h2>
+			<p>Hello %s,</p>
+			<p>Your account was signed in from a new device.</p>
+			<p>Device: %s on %s</p>
+			<p>IP address: %s</p>
+			<p>Date: %s</p>
+			<p>If this was you, you can ignore this email. Otherwise change your password and revoke the session from your account.</p>
+			<br>
+			<p>Best regards,<br>%s Team</p>
+		</body>
+		</html>
+		`, companyName, html.EscapeString(accountName), html.EscapeString(browser), html.EscapeString(os), html.EscapeString(ipAddress),
+		signedInAt.UTC().Format(time.RFC1123), companyName)
+
+	subject := fmt.Sprintf("%s, New sign-in to your account", companyName)
+	err := s.QueueEmail(to, subject, htmlContent)
+	if err != nil {
+		s.Log.Logger.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *SMTP) SendDeviceCodeEmail(user *model.User, to, accountName, code, browser, os, ipAddress string, expiryDate time.Duration) error {
+	companyName := user.CompanyName
+	if companyName == "" {
+		companyName = "GreenLync"
+	}
+
+	htmlContent := fmt.Sprintf(`
+		<html>
+		<body>
+			<h2>%s - Verify your sign-in</h2>
+			<p>Hello %s,</p>
+			<p>Your password was used to sign in from a new device.</p>
+			<p>Device: %s on %s</p>
+			<p>IP address: %s</p>
+			<p>Verification Code: <strong>%s</strong></p>
+			<p>This code will expire in %d minutes.</p>
+			<p>If this wasn't you, don't share the code and change your password.</p>
+			<br>
+			<p>Best regards,<br>%s Team</p>
+		</body>
+		</html>
+		`, companyName, html.EscapeString(accountName), html.EscapeString(browser), html.EscapeString(os), html.EscapeString(ipAddress),
+		code, int(expiryDate.Minutes()), companyName)
+
+	subject := fmt.Sprintf("%s, Verify your sign-in", companyName)
+	err := s.QueueEmail(to, subject, htmlContent)
+	if err != nil {
+		s.Log.Logger.Error(err)
+		return err
+	}
+
+	return nil
+}
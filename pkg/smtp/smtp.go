@@ -2,9 +2,9 @@ package smtp
 
 import (
 	"crypto/tls"
-	"fmt"
 	"net"
 	"net/smtp"
+	"strconv"
 	"sync"
 	"time"
 
@@ -101,7 +101,7 @@ func (s *SMTP) MonitorSMTPHealth() error {
 	case 587:
 		auth = smtp.PlainAuth("", s.Login, s.Password, s.Host)
 	}
-	smtpAddr := fmt.Sprintf("%s:%d", s.Host, s.Port)
+	smtpAddr := net.JoinHostPort(s.Host, strconv.Itoa(int(s.Port)))
 
 	tlsconfig := &tls.Config{
 		InsecureSkipVerify: true,
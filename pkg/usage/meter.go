@@ -0,0 +1,226 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Quota tracking and usage metering in Redis, flushed periodically to MySQL
+
+package usage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+	"greenlync-api-gateway/pkg/logger"
+
+	"github.com/go-co-op/gocron"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// calls counted since the last flush, field date|consumer|user id|route
+	KeyUsagePending = "usage_pending"
+
+	QuotaKey    = func(consumer, window string) string { return fmt.Sprint("usage_quota_", consumer, "_", window) }
+	FlushingKey = func(id string) string { return fmt.Sprint("usage_flushing_", id) }
+)
+
+// how often the counted calls are written to the usage table
+var FlushInterval = 1 * time.Minute
+
+// UserConsumer is the consumer id of a user
+func UserConsumer(userId int32) string {
+	return fmt.Sprint("user:", userId)
+}
+
+// ClientConsumer is the consumer id of an OAuth client
+func ClientConsumer(clientId string) string {
+	return fmt.Sprint("client:", clientId)
+}
+
+// ApiKeyConsumer is the consumer id of an API key
+func ApiKeyConsumer(apiKeyId int32) string {
+	return fmt.Sprint("apikey:", apiKeyId)
+}
+
+// QuotaStatus is the consumption of one quota in its current period
+type QuotaStatus struct {
+	Calls     int64     `json:"calls"`
+	Period    string    `json:"period"`
+	Used      int64     `json:"used"`
+	Remaining int64     `json:"remaining"`
+	ResetAt   time.Time `json:"reset_at"`
+}
+
+type Meter struct {
+	redis *redis.Client
+	db    *gorm.DB
+	log   *logger.Logger
+}
+
+func NewMeter(redis *redis.Client, db *gorm.DB, log *logger.Logger, cron *gocron.Scheduler) (*Meter, error) {
+	m := &Meter{
+		redis: redis,
+		db:    db,
+		log:   log,
+	}
+
+	_, err := cron.Every(FlushInterval).Do(m.Flush)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Consume counts one call against every quota of the consumer, if one of them is
+// exhausted the call isn't counted and allowed is false
+func (m *Meter) Consume(ctx context.Context, consumer string, quotas []*Quota, now time.Time) ([]*QuotaStatus, bool, error) {
+	if len(quotas) == 0 {
+		return nil, true, nil
+	}
+
+	keys := make([]string, len(quotas))
+	cmds := make([]*redis.IntCmd, len(quotas))
+	status := make([]*QuotaStatus, len(quotas))
+
+	pipe := m.redis.TxPipeline()
+	for i, q := range quotas {
+		window, end := q.window(now)
+		keys[i] = QuotaKey(consumer, window)
+		cmds[i] = pipe.Incr(ctx, keys[i])
+		// keep the counter a day after the period so late replicas still see it
+		pipe.ExpireAt(ctx, keys[i], end.Add(24*time.Hour))
+		status[i] = &QuotaStatus{Calls: q.Calls, Period: q.Period, ResetAt: end}
+	}
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	allowed := true
+	for i, q := range quotas {
+		status[i].Used = cmds[i].Val()
+		if status[i].Used > q.Calls {
+			allowed = false
+		}
+	}
+
+	if !allowed {
+		pipe := m.redis.TxPipeline()
+		for i := range quotas {
+			pipe.Decr(ctx, keys[i])
+			status[i].Used--
+		}
+		_, err = pipe.Exec(ctx)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	for i, q := range quotas {
+		status[i].Remaining = q.Calls - status[i].Used
+		if status[i].Remaining < 0 {
+			status[i].Remaining = 0
+		}
+	}
+
+	return status, allowed, nil
+}
+
+// Status returns the consumption of the consumer quotas without counting a call
+func (m *Meter) Status(ctx context.Context, consumer string, quotas []*Quota, now time.Time) ([]*QuotaStatus, error) {
+	status := make([]*QuotaStatus, len(quotas))
+	for i, q := range quotas {
+		window, end := q.window(now)
+		used, err := m.redis.Get(ctx, QuotaKey(consumer, window)).Int64()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+
+		status[i] = &QuotaStatus{Calls: q.Calls, Period: q.Period, Used: used, Remaining: q.Calls - used, ResetAt: end}
+		if status[i].Remaining < 0 {
+			status[i].Remaining = 0
+		}
+	}
+
+	return status, nil
+}
+
+// Record meters one call of the consumer to the route
+func (m *Meter) Record(ctx context.Context, consumer string, userId int32, route string, now time.Time) error {
+	field := strings.Join([]string{now.UTC().Format("2006-01-02"), consumer, strconv.Itoa(int(userId)), route}, "|")
+	return m.redis.HIncrBy(ctx, KeyUsagePending, field, 1).Err()
+}
+
+// Flush writes the calls counted since the last flush to the usage table, every
+// replica can flush since the pending counters are atomically renamed before they're read
+func (m *Meter) Flush() {
+	err := m.flush(context.Background())
+	if err != nil {
+		m.log.Logger.Errorf("error flushing usage: %v", err)
+	}
+}
+
+func (m *Meter) flush(ctx context.Context) error {
+	key := FlushingKey(uuid.NewString())
+	err := m.redis.Rename(ctx, KeyUsagePending, key).Err()
+	if err != nil {
+		// nothing was counted since the last flush
+		if strings.Contains(err.Error(), "no such key") {
+			return nil
+		}
+		return err
+	}
+
+	fields, err := m.redis.HGetAll(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+
+	usages := make([]*model.Usage, 0, len(fields))
+	for field, value := range fields {
+		parts := strings.SplitN(field, "|", 4)
+		calls, err := strconv.ParseInt(value, 10, 64)
+		if len(parts) != 4 || err != nil {
+			m.log.Logger.Errorf("invalid usage counter %s=%s", field, value)
+			continue
+		}
+		userId, _ := strconv.Atoi(parts[2])
+
+		usages = append(usages, &model.Usage{
+			Date:     parts[0],
+			Consumer: parts[1],
+			UserId:   int32(userId),
+			Route:    parts[3],
+			Calls:    calls,
+		})
+	}
+
+	if len(usages) > 0 {
+		err = m.db.Clauses(clause.OnConflict{
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"calls":      gorm.Expr("calls + VALUES(calls)"),
+				"updated_at": gorm.Expr("VALUES(updated_at)"),
+			}),
+		}).CreateInBatches(usages, 500).Error
+		if err != nil {
+			// put the counters back so the next flush retries them
+			pipe := m.redis.Pipeline()
+			for field, value := range fields {
+				calls, _ := strconv.ParseInt(value, 10, 64)
+				pipe.HIncrBy(ctx, KeyUsagePending, field, calls)
+			}
+			pipe.Del(ctx, key)
+			if _, perr := pipe.Exec(ctx); perr != nil {
+				m.log.Logger.Errorf("error restoring usage counters: %v", perr)
+			}
+			return err
+		}
+	}
+
+	return m.redis.Del(ctx, key).Err()
+}
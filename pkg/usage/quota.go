@@ -0,0 +1,131 @@
+// Developer: zeelrupapara@gmail.com
+// Description: Daily and monthly call quotas loaded from the config store
+
+package usage
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+)
+
+// Config store keys, every quota is written as calls/period and several quotas
+// can be combined with a comma e.g. 1000/day,20000/month, an empty value means unlimited
+const (
+	ConfigPrefix = "quota."
+	// default quota per user
+	ConfigUser = "quota.user"
+	// quota.role.<role> quota per user of the role, overrides quota.user
+	ConfigRolePrefix = "quota.role."
+	// quota.user.<user id> quota of one user, overrides the role quota
+	ConfigUserPrefix = "quota.user."
+)
+
+// Quota periods
+const (
+	PeriodDay   = "day"
+	PeriodMonth = "month"
+)
+
+// Quota allows Calls per calendar Period (UTC)
+type Quota struct {
+	Calls  int64
+	Period string
+}
+
+// window returns the id of the period containing t and when it ends
+func (q *Quota) window(t time.Time) (string, time.Time) {
+	t = t.UTC()
+	if q.Period == PeriodDay {
+		start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return start.Format("2006-01-02"), start.AddDate(0, 0, 1)
+	}
+	start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start.Format("2006-01"), start.AddDate(0, 1, 0)
+}
+
+// ParseQuotas parses calls/period[,calls/period] e.g. 1000/day,20000/month
+func ParseQuotas(s string) ([]*Quota, error) {
+	quotas := make([]*Quota, 0)
+	for _, part := range strings.Split(s, ",") {
+		fields := strings.Split(strings.TrimSpace(part), "/")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("quota %q should be in the form calls/day or calls/month", part)
+		}
+
+		calls, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil || calls <= 0 {
+			return nil, fmt.Errorf("quota %q: calls should be a positive integer", part)
+		}
+
+		if fields[1] != PeriodDay && fields[1] != PeriodMonth {
+			return nil, fmt.Errorf("quota %q: period should be day or month", part)
+		}
+
+		quotas = append(quotas, &Quota{Calls: calls, Period: fields[1]})
+	}
+
+	return quotas, nil
+}
+
+type Quotas struct {
+	User  []*Quota
+	Roles map[string][]*Quota
+	Users map[int32][]*Quota
+}
+
+// NewQuotas builds the quotas from the quota.* configs, invalid configs are
+// skipped and returned as an error next to the valid quotas
+func NewQuotas(configs []*model.Config) (*Quotas, error) {
+	q := &Quotas{
+		Roles: make(map[string][]*Quota),
+		Users: make(map[int32][]*Quota),
+	}
+
+	errs := make([]error, 0)
+	for _, cfg := range configs {
+		if !strings.HasPrefix(cfg.Key, ConfigPrefix) || strings.TrimSpace(cfg.Value) == "" {
+			continue
+		}
+
+		quotas, err := ParseQuotas(cfg.Value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", cfg.Key, err))
+			continue
+		}
+
+		switch {
+		case cfg.Key == ConfigUser:
+			q.User = quotas
+		case strings.HasPrefix(cfg.Key, ConfigRolePrefix):
+			q.Roles[strings.TrimPrefix(cfg.Key, ConfigRolePrefix)] = quotas
+		case strings.HasPrefix(cfg.Key, ConfigUserPrefix):
+			id, err := strconv.Atoi(strings.TrimPrefix(cfg.Key, ConfigUserPrefix))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid user id", cfg.Key))
+				continue
+			}
+			q.Users[int32(id)] = quotas
+		default:
+			errs = append(errs, fmt.Errorf("%s: unknown quota key", cfg.Key))
+		}
+	}
+
+	return q, errors.Join(errs...)
+}
+
+// ForUser returns the quotas of the user, the user override wins over the role quotas
+// which win over the default user quotas
+func (q *Quotas) ForUser(userId int32, role string) []*Quota {
+	if quotas, ok := q.Users[userId]; ok {
+		return quotas
+	}
+	if quotas, ok := q.Roles[role]; ok {
+		return quotas
+	}
+	return q.User
+}
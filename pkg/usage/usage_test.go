@@ -0,0 +1,48 @@
+package usage
+
+import (
+	"testing"
+	"time"
+
+	model "greenlync-api-gateway/model/common/v1"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQuotas(t *testing.T) {
+	quotas, err := ParseQuotas("1000/day, 20000/month")
+	require.NoError(t, err)
+	require.Equal(t, []*Quota{{Calls: 1000, Period: PeriodDay}, {Calls: 20000, Period: PeriodMonth}}, quotas)
+
+	for _, s := range []string{"", "1000", "0/day", "10/week", "abc/month", "10/day/1"} {
+		_, err = ParseQuotas(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestNewQuotas(t *testing.T) {
+	quotas, err := NewQuotas([]*model.Config{
+		{Key: ConfigUser, Value: "1000/day"},
+		{Key: ConfigRolePrefix + "Admin", Value: "5000/day,100000/month"},
+		{Key: ConfigUserPrefix + "7", Value: "10/month"},
+		{Key: ConfigUserPrefix + "8", Value: ""},
+		{Key: ConfigUserPrefix + "abc", Value: "10/month"},
+	})
+	require.Error(t, err)
+
+	require.Equal(t, []*Quota{{Calls: 10, Period: PeriodMonth}}, quotas.ForUser(7, "Admin"))
+	require.Len(t, quotas.ForUser(8, "Admin"), 2)
+	require.Equal(t, []*Quota{{Calls: 1000, Period: PeriodDay}}, quotas.ForUser(8, "User"))
+}
+
+func TestQuotaWindow(t *testing.T) {
+	now := time.Date(2024, time.December, 31, 23, 30, 0, 0, time.UTC)
+
+	window, end := (&Quota{Calls: 1, Period: PeriodDay}).window(now)
+	require.Equal(t, "2024-12-31", window)
+	require.Equal(t, time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC), end)
+
+	window, end = (&Quota{Calls: 1, Period: PeriodMonth}).window(now)
+	require.Equal(t, "2024-12", window)
+	require.Equal(t, time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC), end)
+}
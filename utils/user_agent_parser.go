@@ -9,6 +9,8 @@ import (
 )
 
 type UserAgent struct {
+	// browser or app family, without its version
+	Name    string
 	Device  string
 	OS      string
 	Channel model.ChannelType
@@ -29,6 +31,7 @@ func UserAgentParser(s string) *UserAgent {
 	}
 
 	return &UserAgent{
+		Name:    ua.Name,
 		Device:  fmt.Sprintf("%s/%s", ua.Name, ua.Version),
 		OS:      ua.OS,
 		Channel: channel,